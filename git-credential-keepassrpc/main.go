@@ -2,16 +2,34 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/logic/gkp/keepassrpc"
 	"github.com/logic/gkp/keepassrpc/cli"
+	"github.com/logic/gkp/keepassrpc/secret"
 )
 
+// lookupTimeout bounds how long we'll wait on KeePass before letting git
+// carry on without us.
+const lookupTimeout = 30 * time.Second
+
+// dialOptions makes us show up in KeePass under our own name, rather than as
+// a generic gkp client.
+var dialOptions = keepassrpc.Options{
+	ClientID:   "gkp-git-credential",
+	ClientName: "git-credential-keepassrpc",
+	ClientDesc: "A git credential helper backed by KeePassRPC",
+}
+
 // ReadCredential reads a git-credential formatted input block into a URL
 func ReadCredential(f io.Reader) *url.URL {
 	creds := map[string]string{}
@@ -51,33 +69,63 @@ func ReadCredential(f io.Reader) *url.URL {
 	return u
 }
 
-// GetCredentials retrieves a credential based on supplied data.
-func GetCredentials(u *url.URL) {
-	config, err := cli.LoadConfig()
+var profileName = flag.String("profile", os.Getenv(cli.ProfileEnv),
+	"profile from settings.json to use (default $"+cli.ProfileEnv+", or the default profile)")
+
+var storeName = flag.String("store", "",
+	"where to keep the session key (keyring, file, env or memory), overriding settings.json")
+
+// GetCredentials retrieves a credential based on supplied data, filling in
+// the username in u and returning the password, if one was found. The caller
+// must Destroy the password.
+func GetCredentials(u *url.URL) *secret.Value {
+	config, err := cli.LoadProfile(*profileName)
 	if err != nil {
 		log.Println(err)
-		return
+		return nil
 	}
+	defer config.Destroy()
+	if *storeName != "" {
+		store, err := cli.OpenStore(*storeName, config)
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+		config.SetStore(store)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
 
-	// TODO: is there a reasonable way to prompt the user here?
-	client, err := cli.Dial(config, nil)
+	opts := dialOptions
+	config.Apply(&opts)
+	// stdin and stdout belong to git, so pairing has to ask elsewhere.
+	client, err := cli.DialWithOptions(ctx, config, &opts, cli.AutoPrompt())
+	if errors.Is(err, keepassrpc.ErrAuthRequired) {
+		log.Println("Not paired with KeePass, and no terminal or askpass program to pair with; run kp once to pair, then try again")
+		return nil
+	}
 	if err != nil {
 		log.Println(err)
-		return
+		return nil
 	}
+	cache := keepassrpc.NewCachedClient(client, 0)
+	defer cache.Close()
 
-	s := client.NewSearch()
+	s := cache.NewSearch()
 	s.AddURL(u.String())
-	entries, err := s.Execute()
+	entries, err := s.ExecuteContext(ctx)
 	if err != nil {
 		log.Println(err)
-		return
+		return nil
 	}
 
-	if len(entries) > 0 {
-		e := entries[0]
-		u.User = url.UserPassword(e.Username(), e.Password())
+	if len(entries) == 0 {
+		return nil
 	}
+	e := entries[0]
+	u.User = url.User(e.Username())
+	return e.PasswordSecret()
 }
 
 // StoreCredentials stores an update to the supplied credentials.
@@ -91,22 +139,32 @@ func EraseCredentials(u *url.URL) {
 }
 
 func main() {
-	if len(os.Args) != 2 {
+	flag.Parse()
+	if flag.NArg() != 1 {
 		panic("Need a single operation (get/store/erase) as argument")
 	}
 
 	u := ReadCredential(os.Stdin)
+	var password *secret.Value
 
-	switch os.Args[1] {
+	switch flag.Arg(0) {
 	case "get":
-		GetCredentials(u)
+		password = GetCredentials(u)
 	case "store":
 		StoreCredentials(u)
 	case "erase":
 		EraseCredentials(u)
 	default:
-		panic(fmt.Sprintf("Unknown operation '%s'", os.Args[1]))
+		panic(fmt.Sprintf("Unknown operation '%s'", flag.Arg(0)))
 	}
 
 	fmt.Printf("url=%s\n", u)
+	if password != nil {
+		// Written straight from the secret, rather than via the URL,
+		// so that no other copy of it is made.
+		fmt.Print("password=")
+		os.Stdout.Write(password.Bytes())
+		fmt.Println()
+		password.Destroy()
+	}
 }
@@ -0,0 +1,45 @@
+// Package atomicfile writes files so that readers see either the old content
+// or the new, never a mixture, even after a crash.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces the file at path with data, creating it if need be.
+func WriteFile(path string, data []byte) error {
+	return write(path, data, os.Rename)
+}
+
+// WriteNewFile writes data to a new file at path. It fails with an error
+// satisfying errors.Is(err, fs.ErrExist) if the file already exists.
+func WriteNewFile(path string, data []byte) error {
+	return write(path, data, os.Link)
+}
+
+// write fills a temporary file in path's directory with data, flushes it,
+// then uses place to give it the name path.
+func write(path string, data []byte, place func(oldpath, newpath string) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := place(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
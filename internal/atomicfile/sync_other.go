@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package atomicfile
+
+// syncDir does nothing, as directories can't be flushed on every platform
+// this covers.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,57 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2Reference(t *testing.T) {
+	password := []byte("password")
+	salt := []byte("somesalt12345678")
+
+	for _, tc := range []struct {
+		time, memory uint32
+		threads      uint8
+	}{
+		{1, 64, 1},
+		{2, 256, 2},
+		{3, 1024, 4},
+	} {
+		want := argon2.Key(password, salt, tc.time, tc.memory, tc.threads, 32)
+		got := argon2Key(argon2i, password, salt, nil, nil, tc.time, tc.memory, uint32(tc.threads), 32)
+		if !bytes.Equal(got, want) {
+			t.Errorf("argon2i(%v) = %x, want %x", tc, got, want)
+		}
+
+		want = argon2.IDKey(password, salt, tc.time, tc.memory, tc.threads, 32)
+		got = argon2Key(argon2id, password, salt, nil, nil, tc.time, tc.memory, uint32(tc.threads), 32)
+		if !bytes.Equal(got, want) {
+			t.Errorf("argon2id(%v) = %x, want %x", tc, got, want)
+		}
+	}
+}
+
+// Test vectors from RFC 9106, section 5
+func TestArgon2RFC(t *testing.T) {
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	for _, tc := range []struct {
+		mode int
+		tag  string
+	}{
+		{argon2d, "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb"},
+		{argon2i, "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8"},
+		{argon2id, "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659"},
+	} {
+		got := hex.EncodeToString(argon2Key(tc.mode, password, salt, secret, data, 3, 32, 4, 32))
+		if got != tc.tag {
+			t.Errorf("mode %d: got %s, want %s", tc.mode, got, tc.tag)
+		}
+	}
+}
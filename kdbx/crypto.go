@@ -0,0 +1,332 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// ErrInvalidKey is returned when the supplied key doesn't open the database
+var ErrInvalidKey = errors.New("kdbx: invalid password or key file")
+
+// ErrCorrupt is returned when the database fails an integrity check
+var ErrCorrupt = errors.New("kdbx: database is corrupt")
+
+// Outer cipher UUIDs
+var (
+	cipherAES256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	cipherChaCha20 = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+)
+
+// KDF UUIDs, and the VariantDictionary parameter names they use
+var (
+	kdfAES      = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	kdfAESKDBX3 = []byte{0x7c, 0x02, 0xbb, 0x82, 0x79, 0xa7, 0x4a, 0xc0, 0x92, 0x7d, 0x11, 0x4a, 0x00, 0x64, 0x82, 0x38}
+	kdfArgon2d  = []byte{0xef, 0x63, 0x6d, 0xdf, 0x8c, 0x29, 0x44, 0x4b, 0x91, 0xf7, 0xa9, 0xa4, 0x03, 0xe3, 0x0a, 0x0c}
+	kdfArgon2id = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+const (
+	kdfUUID        = "$UUID"
+	kdfAESRounds   = "R"
+	kdfAESSeed     = "S"
+	kdfArgonSalt   = "S"
+	kdfArgonLanes  = "P"
+	kdfArgonMemory = "M"
+	kdfArgonIter   = "I"
+	kdfArgonVer    = "V"
+	kdfArgonSecret = "K"
+	kdfArgonAssoc  = "A"
+)
+
+// Inner random stream IDs
+const (
+	streamSalsa20  = 2
+	streamChaCha20 = 3
+)
+
+// maxArgon2Memory is the most memory, in KiB, that we'll let a database have
+// Argon2 use, lest a damaged or hostile header exhaust ours.
+const maxArgon2Memory = 4 << 20 // 4 GiB
+
+// salsa20Nonce is the fixed nonce KeePass uses for the Salsa20 inner stream
+var salsa20Nonce = []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+
+// transformKey runs the composite key through the KDF described by params.
+func transformKey(composite []byte, params variantDict) ([]byte, error) {
+	id, _ := params.bytes(kdfUUID)
+	switch {
+	case bytes.Equal(id, kdfAES), bytes.Equal(id, kdfAESKDBX3):
+		rounds, ok := params.uint64(kdfAESRounds)
+		seed, ok2 := params.bytes(kdfAESSeed)
+		if !ok || !ok2 || len(seed) != 32 {
+			return nil, errors.New("kdbx: invalid AES-KDF parameters")
+		}
+		return aesKDF(composite, seed, rounds)
+
+	case bytes.Equal(id, kdfArgon2d), bytes.Equal(id, kdfArgon2id):
+		mode := argon2d
+		if bytes.Equal(id, kdfArgon2id) {
+			mode = argon2id
+		}
+		salt, ok := params.bytes(kdfArgonSalt)
+		lanes, ok2 := params.uint64(kdfArgonLanes)
+		memory, ok3 := params.uint64(kdfArgonMemory)
+		iter, ok4 := params.uint64(kdfArgonIter)
+		if !ok || !ok2 || !ok3 || !ok4 {
+			return nil, errors.New("kdbx: invalid Argon2 parameters")
+		}
+		if v, ok := params.uint64(kdfArgonVer); ok && v != argon2Version {
+			return nil, fmt.Errorf("kdbx: unsupported Argon2 version %#x", v)
+		}
+		memory /= 1024
+		if memory > maxArgon2Memory {
+			return nil, fmt.Errorf("kdbx: Argon2 memory of %d KiB exceeds the limit of %d KiB", memory, maxArgon2Memory)
+		}
+		if lanes < 1 || lanes > 1<<24-1 || iter < 1 || iter > 1<<32-1 || memory < 8*lanes {
+			return nil, errors.New("kdbx: Argon2 parameters out of range")
+		}
+		secret, _ := params.bytes(kdfArgonSecret)
+		assoc, _ := params.bytes(kdfArgonAssoc)
+		return argon2Key(mode, composite, salt, secret, assoc,
+			uint32(iter), uint32(memory), uint32(lanes), 32), nil
+	}
+	return nil, fmt.Errorf("kdbx: unsupported key derivation function %x", id)
+}
+
+// aesKDF encrypts each half of key with AES-256-ECB, rounds times, under
+// seed, and hashes the result.
+func aesKDF(key, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(key))
+	copy(out, key)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(out[:16], out[:16])
+		block.Encrypt(out[16:], out[16:])
+	}
+	sum := sha256.Sum256(out)
+	return sum[:], nil
+}
+
+// masterKeys derives the payload encryption key and the HMAC base key from
+// the master seed and transformed key.
+func masterKeys(seed, transformed []byte) (cipherKey, hmacKey []byte) {
+	ck := sha256.New()
+	ck.Write(seed)
+	ck.Write(transformed)
+
+	hk := sha512.New()
+	hk.Write(seed)
+	hk.Write(transformed)
+	hk.Write([]byte{0x01})
+	return ck.Sum(nil), hk.Sum(nil)
+}
+
+// blockHMACKey returns the HMAC key for the block with the given index;
+// the header uses index 2^64-1.
+func blockHMACKey(base []byte, index uint64) []byte {
+	var idx [8]byte
+	binary.LittleEndian.PutUint64(idx[:], index)
+	h := sha512.New()
+	h.Write(idx[:])
+	h.Write(base)
+	return h.Sum(nil)
+}
+
+func blockHMAC(base []byte, index uint64, data []byte) []byte {
+	var hdr [12]byte
+	binary.LittleEndian.PutUint64(hdr[:8], index)
+	binary.LittleEndian.PutUint32(hdr[8:], uint32(len(data)))
+	mac := hmac.New(sha256.New, blockHMACKey(base, index))
+	mac.Write(hdr[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// readBlocks reads the HMAC-authenticated block stream that follows the
+// header, returning the concatenated (still encrypted) payload.
+func readBlocks(r io.Reader, hmacKey []byte) ([]byte, error) {
+	var payload bytes.Buffer
+	for index := uint64(0); ; index++ {
+		var hdr struct {
+			MAC  [32]byte
+			Size int32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+			return nil, ErrCorrupt
+		}
+		if hdr.Size < 0 {
+			return nil, ErrCorrupt
+		}
+		data := make([]byte, hdr.Size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, ErrCorrupt
+		}
+		if !hmac.Equal(hdr.MAC[:], blockHMAC(hmacKey, index, data)) {
+			return nil, ErrCorrupt
+		}
+		if hdr.Size == 0 {
+			return payload.Bytes(), nil
+		}
+		payload.Write(data)
+	}
+}
+
+// blockSize is the payload size of each block we write
+const blockSize = 1 << 20
+
+// writeBlocks writes payload as an HMAC-authenticated block stream,
+// terminated by an empty block.
+func writeBlocks(w io.Writer, hmacKey, payload []byte) error {
+	for index := uint64(0); ; index++ {
+		n := len(payload)
+		if n > blockSize {
+			n = blockSize
+		}
+		data := payload[:n]
+		payload = payload[n:]
+
+		var buf bytes.Buffer
+		buf.Write(blockHMAC(hmacKey, index, data))
+		binary.Write(&buf, binary.LittleEndian, int32(len(data)))
+		buf.Write(data)
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// encryptPayload encrypts the payload with the outer cipher named by the
+// header.
+func encryptPayload(h *header, key, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		out := make([]byte, len(data)+pad)
+		copy(out, data)
+		for i := len(data); i < len(out); i++ {
+			out[i] = byte(pad)
+		}
+		cipher.NewCBCEncrypter(block, h.iv).CryptBlocks(out, out)
+		return out, nil
+
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+	return nil, fmt.Errorf("kdbx: unsupported cipher %x", h.cipherID)
+}
+
+// decryptPayload decrypts the payload with the outer cipher named by the
+// header.
+func decryptPayload(h *header, key, data []byte) ([]byte, error) {
+	switch {
+	case bytes.Equal(h.cipherID, cipherAES256):
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(h.iv) != aes.BlockSize {
+			return nil, errors.New("kdbx: invalid AES IV")
+		}
+		if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+			return nil, ErrCorrupt
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(out, data)
+		pad := int(out[len(out)-1])
+		if pad < 1 || pad > aes.BlockSize {
+			return nil, ErrCorrupt
+		}
+		for _, b := range out[len(out)-pad:] {
+			if int(b) != pad {
+				return nil, ErrCorrupt
+			}
+		}
+		return out[:len(out)-pad], nil
+
+	case bytes.Equal(h.cipherID, cipherChaCha20):
+		c, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+	return nil, fmt.Errorf("kdbx: unsupported cipher %x", h.cipherID)
+}
+
+// stream is the inner random stream protecting individual values.
+type stream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+func newStream(id uint32, key []byte) (stream, error) {
+	switch id {
+	case streamChaCha20:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	case streamSalsa20:
+		return newSalsa20(sha256.Sum256(key)), nil
+	}
+	return nil, fmt.Errorf("kdbx: unsupported inner random stream %d", id)
+}
+
+// salsa20Stream is a Salsa20 keystream which, unlike
+// golang.org/x/crypto/salsa20, keeps its position across calls.
+type salsa20Stream struct {
+	key     [32]byte
+	counter [16]byte
+	block   [64]byte
+	used    int
+}
+
+func newSalsa20(key [32]byte) *salsa20Stream {
+	s := &salsa20Stream{key: key, used: 64}
+	copy(s.counter[:], salsa20Nonce)
+	return s
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == len(s.block) {
+			salsa.XORKeyStream(s.block[:], make([]byte, 64), &s.counter, &s.key)
+			// advance the 64-bit little-endian block counter
+			for j := 8; j < 16; j++ {
+				s.counter[j]++
+				if s.counter[j] != 0 {
+					break
+				}
+			}
+			s.used = 0
+		}
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used++
+	}
+}
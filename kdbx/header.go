@@ -0,0 +1,396 @@
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// File signatures and the format version we understand
+const (
+	signature1   uint32 = 0x9AA2D903
+	signature2   uint32 = 0xB54BFB67
+	majorVersion uint32 = 4
+)
+
+// Outer header field IDs
+const (
+	hdrEndOfHeader      = 0
+	hdrComment          = 1
+	hdrCipherID         = 2
+	hdrCompressionFlags = 3
+	hdrMasterSeed       = 4
+	hdrEncryptionIV     = 7
+	hdrKdfParameters    = 11
+	hdrPublicCustomData = 12
+)
+
+// Inner header field IDs
+const (
+	innerEndOfHeader       = 0
+	innerRandomStreamID    = 1
+	innerRandomStreamKey   = 2
+	innerBinary            = 3
+	innerBinaryFlagProtect = 0x01
+)
+
+// ErrFormat is returned for files which aren't KDBX databases at all
+var ErrFormat = errors.New("kdbx: not a KeePass database")
+
+// header holds the parsed outer header of a KDBX 4 file.
+type header struct {
+	version    uint32
+	cipherID   []byte
+	compressed bool
+	masterSeed []byte
+	iv         []byte
+	kdf        variantDict
+	customData []byte
+	raw        []byte // the header as it appeared on disk, for hashing
+}
+
+// readField reads one type-length-value header field.
+func readField(r io.Reader) (byte, []byte, error) {
+	var id [1]byte
+	if _, err := io.ReadFull(r, id[:]); err != nil {
+		return 0, nil, err
+	}
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, nil, err
+	}
+	if size > 1<<30 {
+		return 0, nil, fmt.Errorf("kdbx: header field %d too large (%d bytes)", id[0], size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, err
+	}
+	return id[0], data, nil
+}
+
+func writeField(w *bytes.Buffer, id byte, data []byte) {
+	w.WriteByte(id)
+	binary.Write(w, binary.LittleEndian, uint32(len(data)))
+	w.Write(data)
+}
+
+// readHeader parses the outer header, keeping a copy of the raw bytes so
+// that the caller can verify its hash and HMAC.
+func readHeader(r io.Reader) (*header, error) {
+	var raw bytes.Buffer
+	tr := io.TeeReader(r, &raw)
+
+	var sig [3]uint32
+	if err := binary.Read(tr, binary.LittleEndian, &sig); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	if sig[0] != signature1 || sig[1] != signature2 {
+		return nil, ErrFormat
+	}
+	h := &header{version: sig[2]}
+	if major := h.version >> 16; major != majorVersion {
+		return nil, fmt.Errorf("kdbx: unsupported file version %d.%d", major, h.version&0xffff)
+	}
+
+	for {
+		id, data, err := readField(tr)
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case hdrEndOfHeader:
+			h.raw = raw.Bytes()
+			return h, h.validate()
+		case hdrCipherID:
+			h.cipherID = data
+		case hdrCompressionFlags:
+			if len(data) != 4 {
+				return nil, errors.New("kdbx: invalid compression flags")
+			}
+			switch binary.LittleEndian.Uint32(data) {
+			case 0:
+				h.compressed = false
+			case 1:
+				h.compressed = true
+			default:
+				return nil, errors.New("kdbx: unsupported compression algorithm")
+			}
+		case hdrMasterSeed:
+			h.masterSeed = data
+		case hdrEncryptionIV:
+			h.iv = data
+		case hdrKdfParameters:
+			if h.kdf, err = readVariantDict(data); err != nil {
+				return nil, err
+			}
+		case hdrPublicCustomData:
+			h.customData = data
+		case hdrComment:
+			// ignored
+		default:
+			return nil, fmt.Errorf("kdbx: unknown header field %d", id)
+		}
+	}
+}
+
+func (h *header) validate() error {
+	switch {
+	case h.cipherID == nil:
+		return errors.New("kdbx: header is missing the cipher ID")
+	case len(h.masterSeed) != 32:
+		return errors.New("kdbx: header has an invalid master seed")
+	case h.iv == nil:
+		return errors.New("kdbx: header is missing the encryption IV")
+	case h.kdf == nil:
+		return errors.New("kdbx: header is missing the KDF parameters")
+	}
+	return nil
+}
+
+// marshal serializes the outer header, storing the result in h.raw.
+func (h *header) marshal() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, [3]uint32{signature1, signature2, h.version})
+	writeField(&buf, hdrCipherID, h.cipherID)
+	flags := make([]byte, 4)
+	if h.compressed {
+		flags[0] = 1
+	}
+	writeField(&buf, hdrCompressionFlags, flags)
+	writeField(&buf, hdrMasterSeed, h.masterSeed)
+	writeField(&buf, hdrEncryptionIV, h.iv)
+	writeField(&buf, hdrKdfParameters, h.kdf.marshal())
+	if h.customData != nil {
+		writeField(&buf, hdrPublicCustomData, h.customData)
+	}
+	writeField(&buf, hdrEndOfHeader, []byte("\r\n\r\n"))
+	h.raw = buf.Bytes()
+	return h.raw
+}
+
+// innerHeader holds the parsed inner header found at the start of the
+// decrypted payload.
+type innerHeader struct {
+	streamID  uint32
+	streamKey []byte
+	binaries  []poolBinary
+}
+
+// poolBinary is a single attachment from the inner header's binary pool.
+type poolBinary struct {
+	protect bool
+	data    []byte
+}
+
+func readInnerHeader(r io.Reader) (*innerHeader, error) {
+	h := &innerHeader{}
+	for {
+		id, data, err := readField(r)
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case innerEndOfHeader:
+			return h, nil
+		case innerRandomStreamID:
+			if len(data) != 4 {
+				return nil, errors.New("kdbx: invalid inner random stream ID")
+			}
+			h.streamID = binary.LittleEndian.Uint32(data)
+		case innerRandomStreamKey:
+			h.streamKey = data
+		case innerBinary:
+			if len(data) < 1 {
+				return nil, errors.New("kdbx: invalid binary in inner header")
+			}
+			h.binaries = append(h.binaries, poolBinary{
+				protect: data[0]&innerBinaryFlagProtect != 0,
+				data:    data[1:],
+			})
+		default:
+			return nil, fmt.Errorf("kdbx: unknown inner header field %d", id)
+		}
+	}
+}
+
+func (h *innerHeader) marshal() []byte {
+	var buf bytes.Buffer
+	id := make([]byte, 4)
+	binary.LittleEndian.PutUint32(id, h.streamID)
+	writeField(&buf, innerRandomStreamID, id)
+	writeField(&buf, innerRandomStreamKey, h.streamKey)
+	for _, b := range h.binaries {
+		data := make([]byte, 1+len(b.data))
+		if b.protect {
+			data[0] = innerBinaryFlagProtect
+		}
+		copy(data[1:], b.data)
+		writeField(&buf, innerBinary, data)
+	}
+	writeField(&buf, innerEndOfHeader, nil)
+	return buf.Bytes()
+}
+
+// VariantDictionary value types
+const (
+	vdVersion   uint16 = 0x0100
+	vdEnd              = 0x00
+	vdUInt32           = 0x04
+	vdUInt64           = 0x05
+	vdBool             = 0x08
+	vdInt32            = 0x0C
+	vdInt64            = 0x0D
+	vdString           = 0x18
+	vdByteArray        = 0x42
+)
+
+// variantDict is KeePass's typed key/value serialization, used to carry
+// KDF parameters. Values are uint32, uint64, bool, int32, int64, string or
+// []byte.
+type variantDict map[string]interface{}
+
+func readVariantDict(data []byte) (variantDict, error) {
+	errInvalid := errors.New("kdbx: invalid KDF parameters")
+	r := bytes.NewReader(data)
+
+	var version uint16
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, errInvalid
+	}
+	if version&0xff00 != vdVersion&0xff00 {
+		return nil, fmt.Errorf("kdbx: unsupported KDF parameters version %#x", version)
+	}
+
+	d := variantDict{}
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, errInvalid
+		}
+		if typ == vdEnd {
+			return d, nil
+		}
+		var n int32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil || n < 0 || int(n) > r.Len() {
+			return nil, errInvalid
+		}
+		name := make([]byte, n)
+		r.Read(name)
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil || n < 0 || int(n) > r.Len() {
+			return nil, errInvalid
+		}
+		v := make([]byte, n)
+		r.Read(v)
+
+		switch typ {
+		case vdUInt32, vdInt32:
+			if len(v) != 4 {
+				return nil, errInvalid
+			}
+			if typ == vdUInt32 {
+				d[string(name)] = binary.LittleEndian.Uint32(v)
+			} else {
+				d[string(name)] = int32(binary.LittleEndian.Uint32(v))
+			}
+		case vdUInt64, vdInt64:
+			if len(v) != 8 {
+				return nil, errInvalid
+			}
+			if typ == vdUInt64 {
+				d[string(name)] = binary.LittleEndian.Uint64(v)
+			} else {
+				d[string(name)] = int64(binary.LittleEndian.Uint64(v))
+			}
+		case vdBool:
+			if len(v) != 1 {
+				return nil, errInvalid
+			}
+			d[string(name)] = v[0] != 0
+		case vdString:
+			d[string(name)] = string(v)
+		case vdByteArray:
+			d[string(name)] = v
+		default:
+			return nil, fmt.Errorf("kdbx: unknown KDF parameter type %#x", typ)
+		}
+	}
+}
+
+func (d variantDict) marshal() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, vdVersion)
+	put := func(typ byte, name string, v []byte) {
+		buf.WriteByte(typ)
+		binary.Write(&buf, binary.LittleEndian, int32(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.LittleEndian, int32(len(v)))
+		buf.Write(v)
+	}
+
+	// KeePass writes the KDF UUID first; the rest we sort for stable output
+	names := make([]string, 0, len(d))
+	for name := range d {
+		if name != kdfUUID {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := d[kdfUUID]; ok {
+		names = append([]string{kdfUUID}, names...)
+	}
+
+	for _, name := range names {
+		switch v := d[name].(type) {
+		case uint32:
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, v)
+			put(vdUInt32, name, b)
+		case int32:
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, uint32(v))
+			put(vdInt32, name, b)
+		case uint64:
+			b := make([]byte, 8)
+			binary.LittleEndian.PutUint64(b, v)
+			put(vdUInt64, name, b)
+		case int64:
+			b := make([]byte, 8)
+			binary.LittleEndian.PutUint64(b, uint64(v))
+			put(vdInt64, name, b)
+		case bool:
+			b := []byte{0}
+			if v {
+				b[0] = 1
+			}
+			put(vdBool, name, b)
+		case string:
+			put(vdString, name, []byte(v))
+		case []byte:
+			put(vdByteArray, name, v)
+		}
+	}
+	buf.WriteByte(vdEnd)
+	return buf.Bytes()
+}
+
+func (d variantDict) bytes(name string) ([]byte, bool) {
+	v, ok := d[name].([]byte)
+	return v, ok
+}
+
+func (d variantDict) uint64(name string) (uint64, bool) {
+	switch v := d[name].(type) {
+	case uint64:
+		return v, true
+	case uint32:
+		return uint64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+// Package kdbx reads and writes KeePass KDBX 4 database files directly,
+// without a running KeePass instance.
+//
+// Databases encrypted with AES-256 or ChaCha20, with keys derived by
+// AES-KDF, Argon2d or Argon2id, are supported, as are both inner stream
+// ciphers (Salsa20 and ChaCha20) and binary attachments. Groups and entries
+// are exposed using the keepassrpc types, so that code written against a
+// KeePassRPC connection can be pointed at a database file instead, and
+// entries fetched over KeePassRPC can be written out as a new database.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// Database is the decrypted contents of a KDBX file.
+type Database struct {
+	Name        string
+	Description string
+	Generator   string
+	Root        *Group
+}
+
+// Group is a group in a database, along with its children.
+type Group struct {
+	keepassrpc.Group
+
+	Notes  string
+	IconID int
+
+	Groups  []*Group
+	Entries []*Entry
+}
+
+// Entry is an entry in a database. The embedded keepassrpc.Entry describes
+// it the way KeePassRPC would: title, URLs, and the username, password and
+// any other form fields.
+type Entry struct {
+	keepassrpc.Entry
+
+	Notes  string
+	IconID int
+	Tags   []string
+
+	// Fields holds the entry's custom string fields, by name
+	Fields map[string]string
+
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an entry.
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Open reads a KDBX 4 database from r and decrypts it using key.
+func Open(r io.Reader, key *Key) (*Database, error) {
+	return open(r, key, "")
+}
+
+// OpenFile reads and decrypts the named KDBX 4 database.
+func OpenFile(name string, key *Key) (*Database, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fileName, err := filepath.Abs(name)
+	if err != nil {
+		fileName = name
+	}
+	return open(f, key, fileName)
+}
+
+func open(r io.Reader, key *Key, fileName string) (*Database, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	var sums struct {
+		Hash [sha256.Size]byte
+		HMAC [sha256.Size]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sums); err != nil {
+		return nil, ErrCorrupt
+	}
+	if sha256.Sum256(h.raw) != sums.Hash {
+		return nil, ErrCorrupt
+	}
+
+	composite, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+	transformed, err := transformKey(composite, h.kdf)
+	if err != nil {
+		return nil, err
+	}
+	cipherKey, hmacKey := masterKeys(h.masterSeed, transformed)
+
+	mac := hmac.New(sha256.New, blockHMACKey(hmacKey, math.MaxUint64))
+	mac.Write(h.raw)
+	if !hmac.Equal(mac.Sum(nil), sums.HMAC[:]) {
+		return nil, ErrInvalidKey
+	}
+
+	payload, err := readBlocks(r, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptPayload(h, cipherKey, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = bytes.NewReader(plain)
+	if h.compressed {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	inner, err := readInnerHeader(body)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	s, err := newStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc xmlDocument
+	if err := xml.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if err := doc.unprotect(s); err != nil {
+		return nil, err
+	}
+	return doc.export(inner.binaries, fileName)
+}
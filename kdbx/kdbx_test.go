@@ -0,0 +1,612 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+	"golang.org/x/crypto/chacha20"
+)
+
+// sealer builds KDBX 4 files for tests, independently of any writer.
+type sealer struct {
+	cipherID []byte
+	kdf      variantDict
+	compress bool
+	streamID uint32
+	binaries [][]byte
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func putField(buf *bytes.Buffer, id byte, data []byte) {
+	buf.WriteByte(id)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+}
+
+func putVariantDict(d variantDict) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, vdVersion)
+	for name, v := range d {
+		var typ byte
+		var data bytes.Buffer
+		switch v := v.(type) {
+		case uint32:
+			typ = vdUInt32
+			binary.Write(&data, binary.LittleEndian, v)
+		case uint64:
+			typ = vdUInt64
+			binary.Write(&data, binary.LittleEndian, v)
+		case []byte:
+			typ = vdByteArray
+			data.Write(v)
+		}
+		buf.WriteByte(typ)
+		binary.Write(&buf, binary.LittleEndian, int32(len(name)))
+		buf.WriteString(name)
+		binary.Write(&buf, binary.LittleEndian, int32(data.Len()))
+		buf.Write(data.Bytes())
+	}
+	buf.WriteByte(vdEnd)
+	return buf.Bytes()
+}
+
+// seal encrypts the document produced by doc under key. doc is passed a
+// function which protects a value with the inner stream; it must be called
+// in document order.
+func (s *sealer) seal(t *testing.T, key *Key, doc func(protect func(string) string) string) []byte {
+	seed := randomBytes(t, 32)
+	iv := randomBytes(t, 16)
+	if bytes.Equal(s.cipherID, cipherChaCha20) {
+		iv = iv[:12]
+	}
+
+	var hdr bytes.Buffer
+	binary.Write(&hdr, binary.LittleEndian, [3]uint32{signature1, signature2, 0x00040001})
+	putField(&hdr, hdrCipherID, s.cipherID)
+	compression := make([]byte, 4)
+	if s.compress {
+		compression[0] = 1
+	}
+	putField(&hdr, hdrCompressionFlags, compression)
+	putField(&hdr, hdrMasterSeed, seed)
+	putField(&hdr, hdrEncryptionIV, iv)
+	putField(&hdr, hdrKdfParameters, putVariantDict(s.kdf))
+	putField(&hdr, hdrEndOfHeader, []byte("\r\n\r\n"))
+
+	composite, err := key.composite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transformed, err := transformKey(composite, s.kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipherKey, hmacKey := masterKeys(seed, transformed)
+
+	var out bytes.Buffer
+	out.Write(hdr.Bytes())
+	sum := sha256.Sum256(hdr.Bytes())
+	out.Write(sum[:])
+	mac := hmac.New(sha256.New, blockHMACKey(hmacKey, math.MaxUint64))
+	mac.Write(hdr.Bytes())
+	out.Write(mac.Sum(nil))
+
+	var inner bytes.Buffer
+	streamKey := randomBytes(t, 64)
+	id := make([]byte, 4)
+	binary.LittleEndian.PutUint32(id, s.streamID)
+	putField(&inner, innerRandomStreamID, id)
+	putField(&inner, innerRandomStreamKey, streamKey)
+	for _, b := range s.binaries {
+		putField(&inner, innerBinary, append([]byte{0}, b...))
+	}
+	putField(&inner, innerEndOfHeader, nil)
+
+	st, err := newStream(s.streamID, streamKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner.WriteString(doc(func(v string) string {
+		data := []byte(v)
+		st.XORKeyStream(data, data)
+		return base64.StdEncoding.EncodeToString(data)
+	}))
+
+	payload := inner.Bytes()
+	if s.compress {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write(payload)
+		w.Close()
+		payload = gz.Bytes()
+	}
+
+	switch {
+	case bytes.Equal(s.cipherID, cipherAES256):
+		pad := aes.BlockSize - len(payload)%aes.BlockSize
+		payload = append(payload, bytes.Repeat([]byte{byte(pad)}, pad)...)
+		block, _ := aes.NewCipher(cipherKey)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, payload)
+	case bytes.Equal(s.cipherID, cipherChaCha20):
+		c, _ := chacha20.NewUnauthenticatedCipher(cipherKey, iv)
+		c.XORKeyStream(payload, payload)
+	}
+
+	for i, block := range [][]byte{payload, nil} {
+		out.Write(blockHMAC(hmacKey, uint64(i), block))
+		binary.Write(&out, binary.LittleEndian, int32(len(block)))
+		out.Write(block)
+	}
+	return out.Bytes()
+}
+
+func b64uuid(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 16))
+}
+
+// testDocument is a small database exercising nested groups, protected
+// values (including in history, which must be decrypted in order), custom
+// fields, KeePassRPC form fields and an attachment.
+func testDocument(protect func(string) string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<Generator>gkp test</Generator>
+		<DatabaseName>Test Database</DatabaseName>
+		<DatabaseDescription>For testing</DatabaseDescription>
+		<CustomIcons>
+			<Icon><UUID>%s</UUID><Data>aWNvbg==</Data></Icon>
+		</CustomIcons>
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>%s</UUID>
+			<Name>Root</Name>
+			<IconID>48</IconID>
+			<Entry>
+				<UUID>%s</UUID>
+				<IconID>0</IconID>
+				<CustomIconUUID>%s</CustomIconUUID>
+				<Tags>web;mail</Tags>
+				<String><Key>Title</Key><Value>Mail</Value></String>
+				<String><Key>UserName</Key><Value>alice</Value></String>
+				<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+				<String><Key>URL</Key><Value>https://mail.example.com/</Value></String>
+				<String><Key>Notes</Key><Value>some notes</Value></String>
+				<String><Key>PIN</Key><Value Protected="True">%s</Value></String>
+				<String><Key>Colour</Key><Value>blue</Value></String>
+				<String><Key>KPRPC JSON</Key><Value>{"version":1,"altURLs":["https://webmail.example.com/"],"formFieldList":[{"name":"user","displayName":"User","value":"{USERNAME}","type":"FFTusername","id":"user","page":1},{"name":"pass","displayName":"Pass","value":"{PASSWORD}","type":"FFTpassword","id":"pass","page":1},{"name":"domain","displayName":"Domain","value":"CORP","type":"FFTtext","id":"domain","page":1}],"priority":2}</Value></String>
+				<Binary><Key>hello.txt</Key><Value Ref="0"/></Binary>
+				<History>
+					<Entry>
+						<UUID>%s</UUID>
+						<String><Key>Title</Key><Value>Mail</Value></String>
+						<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+					</Entry>
+				</History>
+			</Entry>
+			<Group>
+				<UUID>%s</UUID>
+				<Name>Work</Name>
+				<Notes>work stuff</Notes>
+				<IconID>1</IconID>
+				<Entry>
+					<UUID>%s</UUID>
+					<String><Key>Title</Key><Value>VPN</Value></String>
+					<String><Key>UserName</Key><Value>bob</Value></String>
+					<String><Key>Password</Key><Value Protected="True">%s</Value></String>
+				</Entry>
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`,
+		b64uuid(0x11), b64uuid(0x22), b64uuid(0x33), b64uuid(0x11),
+		protect("s3cret"), protect("1234"), b64uuid(0x33), protect("old-s3cret"),
+		b64uuid(0x44), b64uuid(0x55), protect("hunter2"))
+}
+
+func checkTestDocument(t *testing.T, db *Database) {
+	if db.Name != "Test Database" || db.Description != "For testing" {
+		t.Errorf("unexpected metadata %q, %q", db.Name, db.Description)
+	}
+
+	root := db.Root
+	if root.Title != "Root" || root.UniqueID != "22222222222222222222222222222222" || root.IconID != 48 {
+		t.Errorf("unexpected root %+v", root.Group)
+	}
+	if len(root.Entries) != 1 || len(root.Groups) != 1 {
+		t.Fatalf("root has %d entries and %d groups", len(root.Entries), len(root.Groups))
+	}
+
+	e := root.Entries[0]
+	if e.Title != "Mail" || e.Username() != "alice" || e.Password() != "s3cret" {
+		t.Errorf("unexpected entry %q: %q/%q", e.Title, e.Username(), e.Password())
+	}
+	if fmt.Sprint(e.URLs) != "[https://mail.example.com/ https://webmail.example.com/]" {
+		t.Errorf("unexpected URLs %v", e.URLs)
+	}
+	if len(e.FormFieldList) != 3 || e.FormFieldList[2].Value != "CORP" || e.FormFieldList[2].Type != keepassrpc.FFTtext {
+		t.Errorf("unexpected form fields %+v", e.FormFieldList)
+	}
+	if e.Priority != 2 || e.IconImageData != "aWNvbg==" || e.Notes != "some notes" {
+		t.Errorf("unexpected entry details %+v", e)
+	}
+	if len(e.Fields) != 2 || e.Fields["PIN"] != "1234" || e.Fields["Colour"] != "blue" {
+		t.Errorf("unexpected custom fields %v", e.Fields)
+	}
+	if fmt.Sprint(e.Tags) != "[web mail]" {
+		t.Errorf("unexpected tags %v", e.Tags)
+	}
+	if len(e.Attachments) != 1 || e.Attachments[0].Name != "hello.txt" || string(e.Attachments[0].Data) != "hello, world\n" {
+		t.Errorf("unexpected attachments %+v", e.Attachments)
+	}
+	if e.Parent.UniqueID != root.UniqueID || e.Db.Name != "Test Database" || e.Db.Root.UniqueID != root.UniqueID {
+		t.Errorf("unexpected parent %+v or database %+v", e.Parent, e.Db)
+	}
+
+	work := root.Groups[0]
+	if work.Title != "Work" || work.Path != "Root/Work" || work.Notes != "work stuff" {
+		t.Errorf("unexpected group %+v", work)
+	}
+	if len(work.Entries) != 1 {
+		t.Fatalf("work group has %d entries", len(work.Entries))
+	}
+	vpn := work.Entries[0]
+	if vpn.Username() != "bob" || vpn.Password() != "hunter2" || vpn.Parent.Path != "Root/Work" {
+		t.Errorf("unexpected entry %q: %q/%q in %q", vpn.Title, vpn.Username(), vpn.Password(), vpn.Parent.Path)
+	}
+}
+
+func aesKDFParams(t *testing.T) variantDict {
+	return variantDict{
+		kdfUUID:      kdfAES,
+		kdfAESRounds: uint64(1000),
+		kdfAESSeed:   randomBytes(t, 32),
+	}
+}
+
+func argon2Params(t *testing.T, id []byte) variantDict {
+	return variantDict{
+		kdfUUID:        id,
+		kdfArgonSalt:   randomBytes(t, 32),
+		kdfArgonLanes:  uint32(2),
+		kdfArgonMemory: uint64(64 * 1024),
+		kdfArgonIter:   uint64(2),
+		kdfArgonVer:    uint32(argon2Version),
+	}
+}
+
+func TestArgon2Limits(t *testing.T) {
+	params := argon2Params(t, kdfArgon2id)
+	params[kdfArgonMemory] = uint64(maxArgon2Memory+1) * 1024
+	if _, err := transformKey(make([]byte, 32), params); err == nil {
+		t.Error("transformKey accepted more than 4 GiB of Argon2 memory")
+	}
+
+	params[kdfArgonMemory] = uint64(8 * 1024)
+	params[kdfArgonLanes] = uint32(2)
+	if _, err := transformKey(make([]byte, 32), params); err == nil {
+		t.Error("transformKey accepted less than 8 KiB of memory per lane")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		s    sealer
+	}{
+		{"aes/aeskdf/salsa20/gzip", sealer{cipherID: cipherAES256, kdf: aesKDFParams(t), compress: true, streamID: streamSalsa20}},
+		{"chacha20/argon2d/chacha20", sealer{cipherID: cipherChaCha20, kdf: argon2Params(t, kdfArgon2d), streamID: streamChaCha20}},
+		{"aes/argon2id/chacha20/gzip", sealer{cipherID: cipherAES256, kdf: argon2Params(t, kdfArgon2id), compress: true, streamID: streamChaCha20}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.s.binaries = [][]byte{[]byte("hello, world\n")}
+			key := NewPasswordKey("correct horse")
+			data := tc.s.seal(t, key, testDocument)
+
+			db, err := Open(bytes.NewReader(data), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTestDocument(t, db)
+			if db.Generator != "gkp test" {
+				t.Errorf("unexpected generator %q", db.Generator)
+			}
+
+			if _, err := Open(bytes.NewReader(data), NewPasswordKey("wrong")); err != ErrInvalidKey {
+				t.Errorf("wrong password: got %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	s := sealer{cipherID: cipherAES256, kdf: aesKDFParams(t), streamID: streamChaCha20}
+	s.binaries = [][]byte{[]byte("hello, world\n")}
+	key := NewPasswordKey("correct horse")
+	data := s.seal(t, key, testDocument)
+
+	if _, err := Open(bytes.NewReader(data[:8]), key); err != ErrFormat {
+		t.Errorf("truncated: got %v, want %v", err, ErrFormat)
+	}
+	if _, err := Open(bytes.NewReader([]byte("not a database at all")), key); err != ErrFormat {
+		t.Errorf("garbage: got %v, want %v", err, ErrFormat)
+	}
+
+	bad := append([]byte(nil), data...)
+	bad[len(bad)-100] ^= 1
+	if _, err := Open(bytes.NewReader(bad), key); err != ErrCorrupt {
+		t.Errorf("flipped payload bit: got %v, want %v", err, ErrCorrupt)
+	}
+}
+
+// TestOpenTestdata opens the databases in testdata, which gen.go writes
+// without any help from this package.
+func TestOpenTestdata(t *testing.T) {
+	key := NewPasswordKey("correct horse battery staple")
+	for _, name := range []string{
+		"aes-aeskdf-salsa20.kdbx",
+		"aes-argon2id-chacha20.kdbx",
+		"chacha20-aeskdf-chacha20.kdbx",
+		"chacha20-argon2id-salsa20.kdbx",
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, err := OpenFile(filepath.Join("testdata", name), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if db.Name != "Tests & Co" || db.Description != "Written by gen.go" || db.Generator != "gkp testdata" {
+				t.Errorf("unexpected metadata %q, %q, %q", db.Name, db.Description, db.Generator)
+			}
+
+			root := db.Root
+			if root.Title != "Root" || root.UniqueID != "01010101010101010101010101010101" || root.IconID != 48 {
+				t.Errorf("unexpected root %+v", root.Group)
+			}
+			if len(root.Entries) != 1 || len(root.Groups) != 1 {
+				t.Fatalf("root has %d entries and %d groups", len(root.Entries), len(root.Groups))
+			}
+
+			e := root.Entries[0]
+			if e.Title != "Mail" || e.Username() != "alice@example.com" || e.Password() != "s3cret <&> pass" {
+				t.Errorf("unexpected entry %q: %q/%q", e.Title, e.Username(), e.Password())
+			}
+			if fmt.Sprint(e.URLs) != "[https://mail.example.com/]" || e.Notes != "First line\nsecond line" || e.IconID != 19 {
+				t.Errorf("unexpected entry details %+v", e)
+			}
+			if len(e.Fields) != 1 || e.Fields["Recovery code"] != "1234-5678" {
+				t.Errorf("unexpected custom fields %v", e.Fields)
+			}
+			if fmt.Sprint(e.Tags) != "[mail personal]" {
+				t.Errorf("unexpected tags %v", e.Tags)
+			}
+			if len(e.Attachments) != 1 || e.Attachments[0].Name != "readme.txt" || string(e.Attachments[0].Data) != "hello, world\n" {
+				t.Errorf("unexpected attachments %+v", e.Attachments)
+			}
+
+			work := root.Groups[0]
+			if work.Title != "Work" || work.Path != "Root/Work" || work.Notes != "Office things" {
+				t.Errorf("unexpected group %+v", work)
+			}
+			if len(work.Entries) != 1 || len(work.Groups) != 1 {
+				t.Fatalf("work group has %d entries and %d groups", len(work.Entries), len(work.Groups))
+			}
+			vpn := work.Entries[0]
+			if vpn.Username() != "bob" || vpn.Password() != "hunter2 ünïcødé" || vpn.Parent.Path != "Root/Work" {
+				t.Errorf("unexpected entry %q: %q/%q in %q", vpn.Title, vpn.Username(), vpn.Password(), vpn.Parent.Path)
+			}
+
+			servers := work.Groups[0]
+			if servers.Title != "Servers/Prod" || servers.Path != `Root/Work/Servers\/Prod` || len(servers.Entries) != 1 {
+				t.Fatalf("unexpected group %+v", servers)
+			}
+			if db := servers.Entries[0]; db.Title != "db" || db.Username() != "postgres" || db.Password() != "tr0ub4dor&3" {
+				t.Errorf("unexpected entry %q: %q/%q", db.Title, db.Username(), db.Password())
+			}
+
+			if _, err := OpenFile(filepath.Join("testdata", name), NewPasswordKey("wrong")); err != ErrInvalidKey {
+				t.Errorf("wrong password: got %v, want %v", err, ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, 32)
+	rawHex := []byte(fmt.Sprintf("%x", raw))
+	rawSum := sha256.Sum256(raw)
+	other := []byte("any old file can be a key file")
+	otherSum := sha256.Sum256(other)
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{"raw", raw, raw},
+		{"hex", rawHex, raw},
+		{"hashed", other, otherSum[:]},
+		{"xml v1", []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>` + base64.StdEncoding.EncodeToString(raw) + `</Data></Key></KeyFile>`), raw},
+		{"xml v2", []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="` + fmt.Sprintf("%X", rawSum[:4]) + `">
+			ABABABAB ABABABAB ABABABAB ABABABAB
+			ABABABAB ABABABAB ABABABAB ABABABAB
+		</Data>
+	</Key>
+</KeyFile>`), raw},
+	} {
+		var k Key
+		if err := k.SetKeyFile(tc.data); err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(k.keyFile, tc.want) {
+			t.Errorf("%s: got %x, want %x", tc.name, k.keyFile, tc.want)
+		}
+	}
+
+	var k Key
+	bad := []byte(`<KeyFile><Meta><Version>2.0</Version></Meta><Key><Data Hash="00000000">` + string(rawHex) + `</Data></Key></KeyFile>`)
+	if err := k.SetKeyFile(bad); err == nil {
+		t.Error("key file with bad checksum was accepted")
+	}
+
+	// a database protected by both a password and a key file needs both
+	s := sealer{cipherID: cipherChaCha20, kdf: aesKDFParams(t), streamID: streamSalsa20}
+	s.binaries = [][]byte{[]byte("hello, world\n")}
+	key := NewPasswordKey("correct horse")
+	key.SetKeyFile(other)
+	data := s.seal(t, key, testDocument)
+
+	if _, err := Open(bytes.NewReader(data), key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(bytes.NewReader(data), NewPasswordKey("correct horse")); err != ErrInvalidKey {
+		t.Errorf("password only: got %v, want %v", err, ErrInvalidKey)
+	}
+	var fileOnly Key
+	fileOnly.SetKeyFile(other)
+	if _, err := Open(bytes.NewReader(data), &fileOnly); err != ErrInvalidKey {
+		t.Errorf("key file only: got %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	s := sealer{cipherID: cipherAES256, kdf: aesKDFParams(t), compress: true, streamID: streamSalsa20}
+	s.binaries = [][]byte{[]byte("hello, world\n")}
+	key := NewPasswordKey("correct horse")
+	db, err := Open(bytes.NewReader(s.seal(t, key, testDocument)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []*WriteOptions{
+		{Cipher: AES256, KDF: AESKDF, Iterations: 1000},
+		{Cipher: ChaCha20, KDF: Argon2d, Iterations: 2, Memory: 64 << 10, Parallelism: 2},
+		{Cipher: AES256, KDF: Argon2id, Iterations: 1, Memory: 32 << 10, Parallelism: 1},
+	} {
+		var buf bytes.Buffer
+		newKey := NewPasswordKey("battery staple")
+		if err := db.Write(&buf, newKey, opts); err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		data := buf.Bytes()
+
+		got, err := Open(bytes.NewReader(data), newKey)
+		if err != nil {
+			t.Fatalf("%+v: %v", opts, err)
+		}
+		checkTestDocument(t, got)
+		if got.Generator != generator {
+			t.Errorf("unexpected generator %q", got.Generator)
+		}
+
+		if _, err := Open(bytes.NewReader(data), key); err != ErrInvalidKey {
+			t.Errorf("%+v: old password: got %v, want %v", opts, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	s := sealer{cipherID: cipherAES256, kdf: aesKDFParams(t), streamID: streamChaCha20}
+	s.binaries = [][]byte{[]byte("hello, world\n")}
+	key := NewPasswordKey("correct horse")
+	db, err := Open(bytes.NewReader(s.seal(t, key, testDocument)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &WriteOptions{Cipher: AES256, KDF: AESKDF, Iterations: 1000}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "db.kdbx")
+	if err := os.WriteFile(name, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WriteFile(name, key, opts, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("existing file without overwrite: got %v, want %v", err, fs.ErrExist)
+	}
+	if err := (&Database{}).WriteFile(name, key, opts, true); err == nil {
+		t.Error("wrote a database with no root group")
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != "old" {
+		t.Errorf("failed writes changed the file to %q (%v)", data, err)
+	}
+
+	if err := db.WriteFile(name, key, opts, true); err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenFile(name, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestDocument(t, got)
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("left %d files behind, want 1", len(files))
+	}
+}
+
+func TestWriteLarge(t *testing.T) {
+	big := randomBytes(t, blockSize+blockSize/2)
+	db := &Database{
+		Name: "Large",
+		Root: &Group{
+			Group: keepassrpc.Group{Title: "Root", UniqueID: "not a uuid"},
+			Entries: []*Entry{{
+				Entry: keepassrpc.Entry{
+					Title: "Big",
+					FormFieldList: []keepassrpc.FormField{
+						{Name: "pw", Type: keepassrpc.FFTpassword, Value: "<&\"pass\">"},
+					},
+				},
+				Attachments: []Attachment{{Name: "a", Data: big}, {Name: "b", Data: big}},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	key := NewPasswordKey("")
+	if err := db.Write(&buf, key, &WriteOptions{KDF: AESKDF, Iterations: 10}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Open(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Root.UniqueID) != 32 {
+		t.Errorf("invalid UUID was not replaced: %q", got.Root.UniqueID)
+	}
+	e := got.Root.Entries[0]
+	if e.Password() != "<&\"pass\">" {
+		t.Errorf("got password %q", e.Password())
+	}
+	if len(e.Attachments) != 2 || !bytes.Equal(e.Attachments[0].Data, big) || !bytes.Equal(e.Attachments[1].Data, big) {
+		t.Error("attachments did not survive")
+	}
+}
@@ -0,0 +1,117 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+// Key is the composite master key of a database: a password, a key file,
+// or both.
+type Key struct {
+	password []byte // SHA-256 of the password, or nil
+	keyFile  []byte // 32-byte key derived from the key file, or nil
+}
+
+// NewPasswordKey returns a key consisting of just a password.
+func NewPasswordKey(password string) *Key {
+	k := &Key{}
+	k.SetPassword(password)
+	return k
+}
+
+// SetPassword adds a password to the key, replacing any existing one.
+func (k *Key) SetPassword(password string) {
+	sum := sha256.Sum256([]byte(password))
+	k.password = sum[:]
+}
+
+// SetKeyFile adds a key file to the key, given its contents. All of the
+// formats KeePass understands are accepted: XML key files (versions 1.0 and
+// 2.0), 32 raw bytes, 64 hex digits, or any other file, which is hashed.
+func (k *Key) SetKeyFile(data []byte) error {
+	key, err := parseKeyFile(data)
+	if err != nil {
+		return err
+	}
+	k.keyFile = key
+	return nil
+}
+
+// ReadKeyFile is SetKeyFile for the named file.
+func (k *Key) ReadKeyFile(name string) error {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return k.SetKeyFile(data)
+}
+
+// composite returns the combined hash of the key's components.
+func (k *Key) composite() ([]byte, error) {
+	if k.password == nil && k.keyFile == nil {
+		return nil, errors.New("kdbx: key has neither a password nor a key file")
+	}
+	h := sha256.New()
+	h.Write(k.password)
+	h.Write(k.keyFile)
+	return h.Sum(nil), nil
+}
+
+type xmlKeyFile struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+func parseKeyFile(data []byte) ([]byte, error) {
+	if bytes.Contains(data, []byte("<KeyFile")) {
+		var kf xmlKeyFile
+		if err := xml.Unmarshal(data, &kf); err == nil {
+			return parseXMLKeyFile(&kf)
+		}
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func parseXMLKeyFile(kf *xmlKeyFile) ([]byte, error) {
+	value := strings.Join(strings.Fields(kf.Data.Value), "")
+	switch {
+	case strings.HasPrefix(kf.Version, "1."):
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.New("kdbx: invalid key file data")
+		}
+		return key, nil
+	case strings.HasPrefix(kf.Version, "2."):
+		key, err := hex.DecodeString(value)
+		if err != nil || len(key) != 32 {
+			return nil, errors.New("kdbx: invalid key file data")
+		}
+		if kf.Data.Hash != "" {
+			sum := sha256.Sum256(key)
+			if !strings.EqualFold(hex.EncodeToString(sum[:4]), kf.Data.Hash) {
+				return nil, errors.New("kdbx: key file checksum mismatch")
+			}
+		}
+		return key, nil
+	}
+	return nil, errors.New("kdbx: unsupported key file version " + kf.Version)
+}
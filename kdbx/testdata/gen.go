@@ -0,0 +1,310 @@
+//go:build ignore
+
+// This program writes the KDBX 4 databases in this directory, which
+// TestOpenTestdata opens with the password "correct horse battery staple".
+//
+// It's written from the KDBX 4 format description using only the standard
+// library and golang.org/x/crypto, and shares no code with package kdbx, so
+// that the tests don't merely check the package against itself. Run it from
+// this directory with
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+)
+
+const password = "correct horse battery staple"
+
+var (
+	aes256   = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	chacha   = []byte{0xd6, 0x03, 0x8a, 0x2b, 0x8b, 0x6f, 0x4c, 0xb5, 0xa5, 0x24, 0x33, 0x9a, 0x31, 0xdb, 0xb5, 0x9a}
+	aesKDF   = []byte{0xc9, 0xd9, 0xf3, 0x9a, 0x62, 0x8a, 0x44, 0x60, 0xbf, 0x74, 0x0d, 0x08, 0xc1, 0x8a, 0x4f, 0xea}
+	argon2ID = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+const (
+	salsa20Stream  = 2
+	chacha20Stream = 3
+)
+
+type database struct {
+	name     string
+	cipher   []byte
+	kdf      []byte
+	stream   uint32
+	compress bool
+}
+
+func main() {
+	for _, db := range []database{
+		{"aes-aeskdf-salsa20.kdbx", aes256, aesKDF, salsa20Stream, true},
+		{"aes-argon2id-chacha20.kdbx", aes256, argon2ID, chacha20Stream, false},
+		{"chacha20-aeskdf-chacha20.kdbx", chacha, aesKDF, chacha20Stream, false},
+		{"chacha20-argon2id-salsa20.kdbx", chacha, argon2ID, salsa20Stream, true},
+	} {
+		if err := os.WriteFile(db.name, db.build(), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return b
+}
+
+func u32(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+func u64(v uint64) []byte { return binary.LittleEndian.AppendUint64(nil, v) }
+
+// field appends a type-length-value header field.
+func field(buf *bytes.Buffer, id byte, data []byte) {
+	buf.WriteByte(id)
+	buf.Write(u32(uint32(len(data))))
+	buf.Write(data)
+}
+
+// variant appends one VariantDictionary item.
+func variant(buf *bytes.Buffer, typ byte, key string, value []byte) {
+	buf.WriteByte(typ)
+	buf.Write(u32(uint32(len(key))))
+	buf.WriteString(key)
+	buf.Write(u32(uint32(len(value))))
+	buf.Write(value)
+}
+
+func (db *database) build() []byte {
+	composite := sha256.Sum256([]byte(password))
+	composite = sha256.Sum256(composite[:])
+
+	// KDF parameters, and the key they derive.
+	var kdf bytes.Buffer
+	kdf.Write([]byte{0x00, 0x01})
+	variant(&kdf, 0x42, "$UUID", db.kdf)
+	var transformed []byte
+	if bytes.Equal(db.kdf, aesKDF) {
+		seed := random(32)
+		const rounds = 10000
+		variant(&kdf, 0x05, "R", u64(rounds))
+		variant(&kdf, 0x42, "S", seed)
+		block, err := aes.NewCipher(seed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		k := composite
+		for i := 0; i < rounds; i++ {
+			block.Encrypt(k[:16], k[:16])
+			block.Encrypt(k[16:], k[16:])
+		}
+		sum := sha256.Sum256(k[:])
+		transformed = sum[:]
+	} else {
+		salt := random(32)
+		variant(&kdf, 0x42, "S", salt)
+		variant(&kdf, 0x04, "P", u32(2))
+		variant(&kdf, 0x05, "M", u64(1<<20))
+		variant(&kdf, 0x05, "I", u64(2))
+		variant(&kdf, 0x04, "V", u32(0x13))
+		transformed = argon2.IDKey(composite[:], salt, 2, 1<<10, 2, 32)
+	}
+	kdf.WriteByte(0)
+
+	seed := random(32)
+	iv := random(16)
+	if bytes.Equal(db.cipher, chacha) {
+		iv = random(12)
+	}
+	flags := uint32(0)
+	if db.compress {
+		flags = 1
+	}
+
+	var header bytes.Buffer
+	header.Write(u32(0x9AA2D903))
+	header.Write(u32(0xB54BFB67))
+	header.Write(u32(0x00040000))
+	field(&header, 2, db.cipher)
+	field(&header, 3, u32(flags))
+	field(&header, 4, seed)
+	field(&header, 7, iv)
+	field(&header, 11, kdf.Bytes())
+	field(&header, 0, []byte("\r\n\r\n"))
+
+	key := sha256.Sum256(append(append([]byte{}, seed...), transformed...))
+	hmacBase := sha512.Sum512(append(append(append([]byte{}, seed...), transformed...), 1))
+	blockKey := func(index uint64) []byte {
+		sum := sha512.Sum512(append(u64(index), hmacBase[:]...))
+		return sum[:]
+	}
+
+	// The inner header and the XML document form the plaintext.
+	var plain bytes.Buffer
+	streamKey := random(64)
+	if db.stream == salsa20Stream {
+		streamKey = random(32)
+	}
+	field(&plain, 1, u32(db.stream))
+	field(&plain, 2, streamKey)
+	field(&plain, 3, append([]byte{0}, "hello, world\n"...))
+	field(&plain, 0, nil)
+	plain.WriteString(document(keystream(db.stream, streamKey)))
+
+	payload := plain.Bytes()
+	if db.compress {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		w.Write(payload)
+		w.Close()
+		payload = gz.Bytes()
+	}
+
+	if bytes.Equal(db.cipher, aes256) {
+		pad := aes.BlockSize - len(payload)%aes.BlockSize
+		payload = append(payload, bytes.Repeat([]byte{byte(pad)}, pad)...)
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, payload)
+	} else {
+		c, err := chacha20.NewUnauthenticatedCipher(key[:], iv)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.XORKeyStream(payload, payload)
+	}
+
+	var out bytes.Buffer
+	out.Write(header.Bytes())
+	sum := sha256.Sum256(header.Bytes())
+	out.Write(sum[:])
+	mac := hmac.New(sha256.New, blockKey(^uint64(0)))
+	mac.Write(header.Bytes())
+	out.Write(mac.Sum(nil))
+
+	// One block holding the payload, then the empty final block.
+	for i, data := range [][]byte{payload, nil} {
+		mac := hmac.New(sha256.New, blockKey(uint64(i)))
+		mac.Write(u64(uint64(i)))
+		mac.Write(u32(uint32(len(data))))
+		mac.Write(data)
+		out.Write(mac.Sum(nil))
+		out.Write(u32(uint32(len(data))))
+		out.Write(data)
+	}
+	return out.Bytes()
+}
+
+// keystream returns enough of the inner stream cipher's output to protect
+// every value in the document.
+func keystream(id uint32, key []byte) []byte {
+	out := make([]byte, 4096)
+	if id == salsa20Stream {
+		k := sha256.Sum256(key)
+		nonce := []byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}
+		salsa20.XORKeyStream(out, out, nonce, &k)
+		return out
+	}
+	sum := sha512.Sum512(key)
+	c, err := chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.XORKeyStream(out, out)
+	return out
+}
+
+// document returns the XML document, protecting values with ks in the
+// order they appear.
+func document(ks []byte) string {
+	var b strings.Builder
+	text := func(s string) string {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+	uuid := func(n byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{n}, 16))
+	}
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	stamp := base64.StdEncoding.EncodeToString(u64(uint64(when.Unix() + 62135596800)))
+	times := "<Times><CreationTime>" + stamp + "</CreationTime><LastModificationTime>" + stamp +
+		"</LastModificationTime><LastAccessTime>" + stamp + "</LastAccessTime><ExpiryTime>" + stamp +
+		"</ExpiryTime><Expires>False</Expires><UsageCount>0</UsageCount><LocationChanged>" + stamp +
+		"</LocationChanged></Times>"
+	str := func(key, value string) {
+		b.WriteString("<String><Key>" + text(key) + "</Key><Value>" + text(value) + "</Value></String>")
+	}
+	protected := func(key, value string) {
+		data := []byte(value)
+		for i := range data {
+			data[i] ^= ks[0]
+			ks = ks[1:]
+		}
+		b.WriteString("<String><Key>" + text(key) + "</Key><Value Protected=\"True\">" +
+			base64.StdEncoding.EncodeToString(data) + "</Value></String>")
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>`)
+	b.WriteString("<KeePassFile><Meta><Generator>gkp testdata</Generator>")
+	b.WriteString("<DatabaseName>" + text("Tests & Co") + "</DatabaseName>")
+	b.WriteString("<DatabaseDescription>Written by gen.go</DatabaseDescription>")
+	b.WriteString("<MemoryProtection><ProtectTitle>False</ProtectTitle><ProtectUserName>False</ProtectUserName>" +
+		"<ProtectPassword>True</ProtectPassword><ProtectURL>False</ProtectURL><ProtectNotes>False</ProtectNotes></MemoryProtection>")
+	b.WriteString("</Meta><Root>")
+
+	b.WriteString("<Group><UUID>" + uuid(1) + "</UUID><Name>Root</Name><Notes></Notes><IconID>48</IconID>" + times + "<IsExpanded>True</IsExpanded>")
+	b.WriteString("<Entry><UUID>" + uuid(2) + "</UUID><IconID>19</IconID><Tags>mail;personal</Tags>" + times)
+	str("Title", "Mail")
+	str("UserName", "alice@example.com")
+	protected("Password", "s3cret <&> pass")
+	str("URL", "https://mail.example.com/")
+	str("Notes", "First line\nsecond line")
+	protected("Recovery code", "1234-5678")
+	b.WriteString("<Binary><Key>readme.txt</Key><Value Ref=\"0\"/></Binary>")
+	b.WriteString("<History><Entry><UUID>" + uuid(2) + "</UUID><IconID>19</IconID><Tags></Tags>" + times)
+	str("Title", "Mail")
+	str("UserName", "alice@example.com")
+	protected("Password", "an older password")
+	b.WriteString("</Entry></History></Entry>")
+
+	b.WriteString("<Group><UUID>" + uuid(3) + "</UUID><Name>Work</Name><Notes>Office things</Notes><IconID>1</IconID>" + times)
+	b.WriteString("<Entry><UUID>" + uuid(4) + "</UUID><IconID>0</IconID><Tags></Tags>" + times)
+	str("Title", "VPN")
+	str("UserName", "bob")
+	protected("Password", "hunter2 ünïcødé")
+	str("URL", "")
+	str("Notes", "")
+	b.WriteString("</Entry>")
+	b.WriteString("<Group><UUID>" + uuid(5) + "</UUID><Name>Servers/Prod</Name><Notes></Notes><IconID>1</IconID>" + times)
+	b.WriteString("<Entry><UUID>" + uuid(6) + "</UUID><IconID>0</IconID><Tags></Tags>" + times)
+	str("Title", "db")
+	str("UserName", "postgres")
+	protected("Password", "tr0ub4dor&3")
+	b.WriteString("</Entry></Group></Group></Group>")
+
+	b.WriteString("<DeletedObjects/></Root></KeePassFile>")
+	return b.String()
+}
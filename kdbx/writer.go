@@ -0,0 +1,438 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/logic/gkp/internal/atomicfile"
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// fileVersion is the format version we write: KDBX 4.0
+const fileVersion uint32 = 0x00040000
+
+// generator is the Generator we record in databases we write
+const generator = "gkp"
+
+// Cipher selects the algorithm used to encrypt a database.
+type Cipher int
+
+const (
+	// AES256 is AES-256 in CBC mode
+	AES256 Cipher = iota
+
+	// ChaCha20 is the ChaCha20 stream cipher
+	ChaCha20
+)
+
+// KDF selects the function used to derive the encryption key from the
+// master key.
+type KDF int
+
+const (
+	// Argon2d is the KeePass default
+	Argon2d KDF = iota
+
+	// Argon2id is the hybrid Argon2 variant
+	Argon2id
+
+	// AESKDF is the older AES-based transformation
+	AESKDF
+)
+
+// Default key derivation parameters
+const (
+	defaultArgon2Iterations  = 8
+	defaultArgon2Memory      = 64 << 20
+	defaultArgon2Parallelism = 2
+	defaultAESRounds         = 6000000
+)
+
+// WriteOptions controls how Write encrypts a database. Zero values select
+// the defaults: AES-256, and Argon2d with 64 MiB of memory.
+type WriteOptions struct {
+	Cipher Cipher
+	KDF    KDF
+
+	// Iterations is the number of Argon2 passes, or AES-KDF rounds
+	Iterations uint64
+
+	// Memory is the amount of memory Argon2 uses, in bytes
+	Memory uint64
+
+	// Parallelism is the number of Argon2 lanes
+	Parallelism uint32
+}
+
+func readRandom(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (o *WriteOptions) kdfParams() (variantDict, error) {
+	seed, err := readRandom(32)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.KDF {
+	case AESKDF:
+		rounds := o.Iterations
+		if rounds == 0 {
+			rounds = defaultAESRounds
+		}
+		return variantDict{
+			kdfUUID:      kdfAES,
+			kdfAESRounds: rounds,
+			kdfAESSeed:   seed,
+		}, nil
+
+	case Argon2d, Argon2id:
+		id := kdfArgon2d
+		if o.KDF == Argon2id {
+			id = kdfArgon2id
+		}
+		iter, memory, lanes := o.Iterations, o.Memory, o.Parallelism
+		if iter == 0 {
+			iter = defaultArgon2Iterations
+		}
+		if memory == 0 {
+			memory = defaultArgon2Memory
+		}
+		if lanes == 0 {
+			lanes = defaultArgon2Parallelism
+		}
+		return variantDict{
+			kdfUUID:        id,
+			kdfArgonSalt:   seed,
+			kdfArgonLanes:  lanes,
+			kdfArgonMemory: memory,
+			kdfArgonIter:   iter,
+			kdfArgonVer:    uint32(argon2Version),
+		}, nil
+	}
+	return nil, errors.New("kdbx: unknown key derivation function")
+}
+
+// Write encrypts the database under key and writes it to w as a KDBX 4
+// file. opts may be nil to use the defaults.
+func (db *Database) Write(w io.Writer, key *Key, opts *WriteOptions) error {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+	composite, err := key.composite()
+	if err != nil {
+		return err
+	}
+
+	h := &header{version: fileVersion, compressed: true}
+	switch opts.Cipher {
+	case AES256:
+		h.cipherID = cipherAES256
+		h.iv, err = readRandom(16)
+	case ChaCha20:
+		h.cipherID = cipherChaCha20
+		h.iv, err = readRandom(12)
+	default:
+		return errors.New("kdbx: unknown cipher")
+	}
+	if err != nil {
+		return err
+	}
+	if h.masterSeed, err = readRandom(32); err != nil {
+		return err
+	}
+	if h.kdf, err = opts.kdfParams(); err != nil {
+		return err
+	}
+
+	transformed, err := transformKey(composite, h.kdf)
+	if err != nil {
+		return err
+	}
+	cipherKey, hmacKey := masterKeys(h.masterSeed, transformed)
+
+	doc, binaries, err := db.document()
+	if err != nil {
+		return err
+	}
+	inner := &innerHeader{streamID: streamChaCha20, binaries: binaries}
+	if inner.streamKey, err = readRandom(64); err != nil {
+		return err
+	}
+	s, err := newStream(inner.streamID, inner.streamKey)
+	if err != nil {
+		return err
+	}
+	doc.protect(s)
+
+	var payload bytes.Buffer
+	gz := gzip.NewWriter(&payload)
+	gz.Write(inner.marshal())
+	gz.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(gz)
+	enc.Indent("", "\t")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	data, err := encryptPayload(h, cipherKey, payload.Bytes())
+	if err != nil {
+		return err
+	}
+
+	raw := h.marshal()
+	sum := sha256.Sum256(raw)
+	mac := hmac.New(sha256.New, blockHMACKey(hmacKey, math.MaxUint64))
+	mac.Write(raw)
+
+	var out bytes.Buffer
+	out.Write(raw)
+	out.Write(sum[:])
+	out.Write(mac.Sum(nil))
+	if _, err := w.Write(out.Bytes()); err != nil {
+		return err
+	}
+	return writeBlocks(w, hmacKey, data)
+}
+
+// WriteFile writes the database to the named file, which must not already
+// exist unless overwrite is set. The file is replaced atomically, so a failed
+// write leaves any existing one intact.
+func (db *Database) WriteFile(name string, key *Key, opts *WriteOptions, overwrite bool) error {
+	var buf bytes.Buffer
+	if err := db.Write(&buf, key, opts); err != nil {
+		return err
+	}
+	if overwrite {
+		return atomicfile.WriteFile(name, buf.Bytes())
+	}
+	return atomicfile.WriteNewFile(name, buf.Bytes())
+}
+
+// formatTime encodes t the way KDBX 4 does: base64 of the little-endian
+// count of seconds since 0001-01-01.
+func formatTime(t time.Time) string {
+	const epoch = 62135596800 // seconds from 0001-01-01 to 1970-01-01
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(t.Unix()+epoch))
+	return base64.StdEncoding.EncodeToString(b[:])
+}
+
+// importer converts the package's public types into an XML document.
+type importer struct {
+	doc      *xmlDocument
+	icons    map[string]string // image data -> custom icon UUID
+	binaries []poolBinary
+	pool     map[string]int // attachment data -> binary pool index
+	times    xmlTimes
+}
+
+// document builds the XML document and binary pool for db.
+func (db *Database) document() (*xmlDocument, []poolBinary, error) {
+	if db.Root == nil {
+		return nil, nil, errors.New("kdbx: database has no root group")
+	}
+	now := formatTime(time.Now())
+	x := &importer{
+		doc: &xmlDocument{
+			Meta: xmlMeta{
+				Generator:    generator,
+				DatabaseName: db.Name,
+				Description:  db.Description,
+				MemoryProtection: &xmlMemoryProtection{
+					ProtectTitle:    "False",
+					ProtectUserName: "False",
+					ProtectPassword: "True",
+					ProtectURL:      "False",
+					ProtectNotes:    "False",
+				},
+			},
+		},
+		icons: map[string]string{},
+		pool:  map[string]int{},
+		times: xmlTimes{
+			CreationTime:         now,
+			LastModificationTime: now,
+			LastAccessTime:       now,
+			ExpiryTime:           now,
+			Expires:              "False",
+			LocationChanged:      now,
+		},
+	}
+	root, err := x.group(db.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	x.doc.Root = root
+	return x.doc, x.binaries, nil
+}
+
+// uuid converts a KeePassRPC hex UUID to the base64 form KDBX uses, making
+// up a new one if id isn't a valid UUID.
+func (x *importer) uuid(id string) (string, error) {
+	b, err := hex.DecodeString(id)
+	if err != nil || len(b) != 16 {
+		if b, err = readRandom(16); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// icon returns the UUID of the custom icon with the given image data,
+// adding it to the document if it's new.
+func (x *importer) icon(data string) (string, error) {
+	if data == "" {
+		return "", nil
+	}
+	if id, ok := x.icons[data]; ok {
+		return id, nil
+	}
+	id, err := x.uuid("")
+	if err != nil {
+		return "", err
+	}
+	x.icons[data] = id
+	x.doc.Meta.CustomIcons = append(x.doc.Meta.CustomIcons, xmlIcon{UUID: id, Data: data})
+	return id, nil
+}
+
+func (x *importer) group(g *Group) (xmlGroup, error) {
+	var xg xmlGroup
+	var err error
+	if xg.UUID, err = x.uuid(g.UniqueID); err != nil {
+		return xg, err
+	}
+	if xg.CustomIconUUID, err = x.icon(g.IconImageData); err != nil {
+		return xg, err
+	}
+	times := x.times
+	xg.Name = g.Title
+	xg.Notes = g.Notes
+	xg.IconID = g.IconID
+	xg.Times = &times
+	xg.IsExpanded = "True"
+
+	for _, e := range g.Entries {
+		xe, err := x.entry(e)
+		if err != nil {
+			return xg, err
+		}
+		xg.Entries = append(xg.Entries, xe)
+	}
+	for _, c := range g.Groups {
+		xc, err := x.group(c)
+		if err != nil {
+			return xg, err
+		}
+		xg.Groups = append(xg.Groups, xc)
+	}
+	return xg, nil
+}
+
+func (x *importer) entry(e *Entry) (xmlEntry, error) {
+	var xe xmlEntry
+	var err error
+	if xe.UUID, err = x.uuid(e.UniqueID); err != nil {
+		return xe, err
+	}
+	if xe.CustomIconUUID, err = x.icon(e.IconImageData); err != nil {
+		return xe, err
+	}
+	times := x.times
+	xe.IconID = e.IconID
+	xe.Tags = strings.Join(e.Tags, ";")
+	xe.Times = &times
+
+	add := func(key, value string, protected bool) {
+		xe.Strings = append(xe.Strings, xmlString{
+			Key:   key,
+			Value: xmlValue{Text: value, Protected: protected},
+		})
+	}
+	username, password := e.Username(), e.Password()
+	var url string
+	altURLs := []string{}
+	if len(e.URLs) > 0 {
+		url = e.URLs[0]
+		altURLs = append(altURLs, e.URLs[1:]...)
+	}
+	add(fieldTitle, e.Title, false)
+	add(fieldUserName, username, false)
+	add(fieldPassword, password, true)
+	add(fieldURL, url, false)
+	add(fieldNotes, e.Notes, false)
+
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, e.Fields[name], false)
+	}
+
+	// Form fields go in KeePassRPC's own configuration string, with the
+	// username and password referring back to the standard strings.
+	c := kprpcConfig{
+		Version:          1,
+		AltURLs:          altURLs,
+		FormFieldList:    []keepassrpc.FormField{},
+		HTTPRealm:        e.HTTPRealm,
+		AlwaysAutoFill:   e.AlwaysAutoFill,
+		NeverAutoFill:    e.NeverAutoFill,
+		AlwaysAutoSubmit: e.AlwaysAutoSubmit,
+		NeverAutoSubmit:  e.NeverAutoSubmit,
+		Priority:         e.Priority,
+	}
+	var haveUsername, havePassword bool
+	for _, f := range e.FormFieldList {
+		switch {
+		case f.Type == keepassrpc.FFTusername && !haveUsername:
+			f.Value = placeholderUsername
+			haveUsername = true
+		case f.Type == keepassrpc.FFTpassword && !havePassword:
+			f.Value, f.Secret = placeholderPassword, nil
+			havePassword = true
+		}
+		c.FormFieldList = append(c.FormFieldList, f)
+	}
+	config, err := json.Marshal(&c)
+	if err != nil {
+		return xe, err
+	}
+	add(fieldKPRPC, string(config), false)
+
+	for _, a := range e.Attachments {
+		idx, ok := x.pool[string(a.Data)]
+		if !ok {
+			idx = len(x.binaries)
+			x.binaries = append(x.binaries, poolBinary{data: a.Data})
+			x.pool[string(a.Data)] = idx
+		}
+		ref := xmlBinaryRef{Key: a.Name}
+		ref.Value.Ref = idx
+		xe.Binaries = append(xe.Binaries, ref)
+	}
+	return xe, nil
+}
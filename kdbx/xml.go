@@ -0,0 +1,385 @@
+package kdbx
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// Names of the standard entry strings
+const (
+	fieldTitle    = "Title"
+	fieldUserName = "UserName"
+	fieldPassword = "Password"
+	fieldURL      = "URL"
+	fieldNotes    = "Notes"
+
+	// fieldKPRPC holds KeePassRPC's per-entry configuration, including any
+	// form fields beyond the username and password.
+	fieldKPRPC = "KPRPC JSON"
+)
+
+// Placeholders KeePassRPC uses in its stored form fields to refer to the
+// standard username and password strings
+const (
+	placeholderUsername = "{USERNAME}"
+	placeholderPassword = "{PASSWORD}"
+)
+
+type xmlDocument struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    xmlGroup `xml:"Root>Group"`
+}
+
+type xmlMeta struct {
+	Generator        string               `xml:"Generator"`
+	DatabaseName     string               `xml:"DatabaseName"`
+	Description      string               `xml:"DatabaseDescription"`
+	MemoryProtection *xmlMemoryProtection `xml:"MemoryProtection,omitempty"`
+	CustomIcons      []xmlIcon            `xml:"CustomIcons>Icon"`
+}
+
+// xmlMemoryProtection says which standard strings are protected. KeePass
+// compares booleans literally, so they're kept as "True" and "False".
+type xmlMemoryProtection struct {
+	ProtectTitle    string `xml:"ProtectTitle"`
+	ProtectUserName string `xml:"ProtectUserName"`
+	ProtectPassword string `xml:"ProtectPassword"`
+	ProtectURL      string `xml:"ProtectURL"`
+	ProtectNotes    string `xml:"ProtectNotes"`
+}
+
+// xmlTimes are an item's timestamps, each encoded with formatTime.
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+type xmlIcon struct {
+	UUID string `xml:"UUID"`
+	Data string `xml:"Data"`
+}
+
+type xmlGroup struct {
+	UUID           string     `xml:"UUID"`
+	Name           string     `xml:"Name"`
+	Notes          string     `xml:"Notes"`
+	IconID         int        `xml:"IconID"`
+	CustomIconUUID string     `xml:"CustomIconUUID,omitempty"`
+	Times          *xmlTimes  `xml:"Times,omitempty"`
+	IsExpanded     string     `xml:"IsExpanded,omitempty"`
+	Entries        []xmlEntry `xml:"Entry"`
+	Groups         []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID           string         `xml:"UUID"`
+	IconID         int            `xml:"IconID"`
+	CustomIconUUID string         `xml:"CustomIconUUID,omitempty"`
+	Tags           string         `xml:"Tags"`
+	Times          *xmlTimes      `xml:"Times,omitempty"`
+	Strings        []xmlString    `xml:"String"`
+	Binaries       []xmlBinaryRef `xml:"Binary"`
+	History        []xmlEntry     `xml:"History>Entry"`
+}
+
+type xmlString struct {
+	Key   string   `xml:"Key"`
+	Value xmlValue `xml:"Value"`
+}
+
+// xmlValue is a possibly-protected string value. Protected values have to
+// be decrypted in document order, so we remember where each one was found.
+type xmlValue struct {
+	Text      string
+	Protected bool
+	offset    int64
+}
+
+func (v *xmlValue) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	v.offset = d.InputOffset()
+	for _, a := range start.Attr {
+		if a.Name.Local == "Protected" {
+			v.Protected, _ = strconv.ParseBool(a.Value)
+		}
+	}
+	var s struct {
+		Text string `xml:",chardata"`
+	}
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	v.Text = s.Text
+	return nil
+}
+
+func (v xmlValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if v.Protected {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "Protected"}, Value: "True"})
+	}
+	return e.EncodeElement(v.Text, start)
+}
+
+type xmlBinaryRef struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Ref int `xml:"Ref,attr"`
+	} `xml:"Value"`
+}
+
+// kprpcConfig is the part of the "KPRPC JSON" entry configuration we
+// understand.
+type kprpcConfig struct {
+	Version          int                    `json:"version"`
+	AltURLs          []string               `json:"altURLs"`
+	FormFieldList    []keepassrpc.FormField `json:"formFieldList"`
+	HTTPRealm        string                 `json:"hTTPRealm"`
+	AlwaysAutoFill   bool                   `json:"alwaysAutoFill"`
+	NeverAutoFill    bool                   `json:"neverAutoFill"`
+	AlwaysAutoSubmit bool                   `json:"alwaysAutoSubmit"`
+	NeverAutoSubmit  bool                   `json:"neverAutoSubmit"`
+	Priority         int                    `json:"priority"`
+}
+
+// protectedValues returns the protected values in the document, in the
+// order they would be marshaled.
+func (doc *xmlDocument) protectedValues() []*xmlValue {
+	var values []*xmlValue
+	var visitEntry func(*xmlEntry)
+	visitEntry = func(e *xmlEntry) {
+		for i := range e.Strings {
+			if e.Strings[i].Value.Protected {
+				values = append(values, &e.Strings[i].Value)
+			}
+		}
+		for i := range e.History {
+			visitEntry(&e.History[i])
+		}
+	}
+	var visitGroup func(*xmlGroup)
+	visitGroup = func(g *xmlGroup) {
+		for i := range g.Entries {
+			visitEntry(&g.Entries[i])
+		}
+		for i := range g.Groups {
+			visitGroup(&g.Groups[i])
+		}
+	}
+	visitGroup(&doc.Root)
+	return values
+}
+
+// unprotect decrypts all protected values in place, in the order they
+// appear in the document.
+func (doc *xmlDocument) unprotect(s stream) error {
+	values := doc.protectedValues()
+	sort.Slice(values, func(i, j int) bool { return values[i].offset < values[j].offset })
+	for _, v := range values {
+		data, err := base64.StdEncoding.DecodeString(v.Text)
+		if err != nil {
+			return ErrCorrupt
+		}
+		s.XORKeyStream(data, data)
+		v.Text = string(data)
+	}
+	return nil
+}
+
+// protect encrypts all protected values in place, ready for marshaling.
+func (doc *xmlDocument) protect(s stream) {
+	for _, v := range doc.protectedValues() {
+		data := []byte(v.Text)
+		s.XORKeyStream(data, data)
+		v.Text = base64.StdEncoding.EncodeToString(data)
+	}
+}
+
+// uuidHex converts a base64 XML UUID to the hex form KeePassRPC uses.
+func uuidHex(id string) string {
+	b, err := base64.StdEncoding.DecodeString(id)
+	if err != nil {
+		return id
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// exporter converts the XML document into the package's public types.
+type exporter struct {
+	db       keepassrpc.Database
+	icons    map[string]string
+	binaries []poolBinary
+}
+
+func (doc *xmlDocument) export(binaries []poolBinary, fileName string) (*Database, error) {
+	x := &exporter{icons: map[string]string{}, binaries: binaries}
+	for _, icon := range doc.Meta.CustomIcons {
+		x.icons[icon.UUID] = icon.Data
+	}
+	x.db = keepassrpc.Database{
+		Name:     doc.Meta.DatabaseName,
+		FileName: fileName,
+		Active:   true,
+	}
+	root, err := x.group(&doc.Root, "")
+	if err != nil {
+		return nil, err
+	}
+	x.db.Root = root.Group
+	setDatabase(root, x.db)
+
+	return &Database{
+		Name:        doc.Meta.DatabaseName,
+		Description: doc.Meta.Description,
+		Generator:   doc.Meta.Generator,
+		Root:        root,
+	}, nil
+}
+
+// setDatabase fills in the database each entry reports, once the root
+// group is known.
+func setDatabase(g *Group, db keepassrpc.Database) {
+	for _, e := range g.Entries {
+		e.Db = db
+	}
+	for _, c := range g.Groups {
+		setDatabase(c, db)
+	}
+}
+
+func (x *exporter) group(xg *xmlGroup, parentPath string) (*Group, error) {
+	g := &Group{
+		Group: keepassrpc.Group{
+			Title:         xg.Name,
+			UniqueID:      uuidHex(xg.UUID),
+			IconImageData: x.icons[xg.CustomIconUUID],
+			Path:          keepassrpc.JoinPath(xg.Name),
+		},
+		Notes:  xg.Notes,
+		IconID: xg.IconID,
+	}
+	if parentPath != "" {
+		g.Path = parentPath + "/" + keepassrpc.EscapeTitle(xg.Name)
+	}
+	for i := range xg.Entries {
+		e, err := x.entry(&xg.Entries[i], g.Group)
+		if err != nil {
+			return nil, err
+		}
+		g.Entries = append(g.Entries, e)
+	}
+	for i := range xg.Groups {
+		c, err := x.group(&xg.Groups[i], g.Path)
+		if err != nil {
+			return nil, err
+		}
+		g.Groups = append(g.Groups, c)
+	}
+	return g, nil
+}
+
+func (x *exporter) entry(xe *xmlEntry, parent keepassrpc.Group) (*Entry, error) {
+	e := &Entry{
+		Entry: keepassrpc.Entry{
+			UniqueID:      uuidHex(xe.UUID),
+			IconImageData: x.icons[xe.CustomIconUUID],
+			Parent:        parent,
+		},
+		IconID: xe.IconID,
+		Fields: map[string]string{},
+	}
+	if tags := strings.FieldsFunc(xe.Tags, func(r rune) bool { return r == ';' || r == ',' }); len(tags) > 0 {
+		e.Tags = tags
+	}
+
+	var username, password, url, config string
+	for _, s := range xe.Strings {
+		switch s.Key {
+		case fieldTitle:
+			e.Title = s.Value.Text
+		case fieldUserName:
+			username = s.Value.Text
+		case fieldPassword:
+			password = s.Value.Text
+		case fieldURL:
+			url = s.Value.Text
+		case fieldNotes:
+			e.Notes = s.Value.Text
+		case fieldKPRPC:
+			config = s.Value.Text
+		default:
+			e.Fields[s.Key] = s.Value.Text
+		}
+	}
+
+	if url != "" {
+		e.URLs = append(e.URLs, url)
+	}
+	var c kprpcConfig
+	if config == "" || json.Unmarshal([]byte(config), &c) != nil {
+		c = kprpcConfig{FormFieldList: defaultFormFields()}
+	}
+	e.URLs = append(e.URLs, c.AltURLs...)
+	e.HTTPRealm = c.HTTPRealm
+	e.AlwaysAutoFill = c.AlwaysAutoFill
+	e.NeverAutoFill = c.NeverAutoFill
+	e.AlwaysAutoSubmit = c.AlwaysAutoSubmit
+	e.NeverAutoSubmit = c.NeverAutoSubmit
+	e.Priority = c.Priority
+	for _, f := range c.FormFieldList {
+		switch {
+		case f.Type == keepassrpc.FFTusername && f.Value == placeholderUsername:
+			f.Value = username
+		case f.Type == keepassrpc.FFTpassword && f.Text() == placeholderPassword:
+			f.Secret.Destroy()
+			f.Value, f.Secret = password, nil
+		}
+		e.FormFieldList = append(e.FormFieldList, f)
+	}
+
+	for _, ref := range xe.Binaries {
+		if ref.Value.Ref < 0 || ref.Value.Ref >= len(x.binaries) {
+			return nil, fmt.Errorf("kdbx: entry %s references unknown attachment %d", e.UniqueID, ref.Value.Ref)
+		}
+		e.Attachments = append(e.Attachments, Attachment{
+			Name: ref.Key,
+			Data: x.binaries[ref.Value.Ref].data,
+		})
+	}
+	return e, nil
+}
+
+// defaultFormFields are the form fields KeePassRPC reports for entries it
+// has no stored configuration for.
+func defaultFormFields() []keepassrpc.FormField {
+	return []keepassrpc.FormField{
+		{
+			Name:        "username",
+			DisplayName: "KeePass username",
+			Value:       placeholderUsername,
+			Type:        keepassrpc.FFTusername,
+			ID:          "username",
+			Page:        1,
+		},
+		{
+			Name:        "password",
+			DisplayName: "KeePass password",
+			Value:       placeholderPassword,
+			Type:        keepassrpc.FFTpassword,
+			ID:          "password",
+			Page:        1,
+		},
+	}
+}
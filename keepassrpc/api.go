@@ -2,7 +2,14 @@
 
 package keepassrpc
 
-import "sort"
+import (
+	"context"
+	"encoding/json"
+	"net/rpc"
+	"sort"
+
+	"github.com/logic/gkp/keepassrpc/secret"
+)
 
 /*
 
@@ -71,6 +78,28 @@ const (
 	MatchAccuracyBest = 50
 )
 
+// Values for the urlMergeMode of UpdateLogin and UpdateEntry, which say what
+// becomes of the URLs of the entry being updated.
+const (
+	// URLMergeReplaceKeepOld makes the new URL primary, keeping the old
+	// one as an alternative
+	URLMergeReplaceKeepOld = 1
+
+	// URLMergeReplace makes the new URL primary, dropping the old one
+	URLMergeReplace = 2
+
+	// URLMergeKeepAddNew keeps the old URL primary, adding the new one as
+	// an alternative
+	URLMergeKeepAddNew = 3
+
+	// URLMergeKeep keeps the old URL, ignoring the new one
+	URLMergeKeep = 4
+
+	// URLMergeReplaceAll replaces every URL with those of the new entry.
+	// It requires FeatureEntryURLReplacement.
+	URLMergeReplaceAll = 5
+)
+
 // Search describes a particular search for entries in KeePass.
 type Search struct {
 	UnsanitizedURLs       []string
@@ -83,7 +112,13 @@ type Search struct {
 	FreeTextSearch        string
 	Username              string
 
-	client *Client
+	client searcher
+}
+
+// searcher runs a Search: a *Client, or a *CachedClient.
+type searcher interface {
+	FindLoginsContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry, error)
+	FindEntriesContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry2, error)
 }
 
 // NewSearch returns a fresh Search object.
@@ -101,19 +136,14 @@ func (s *Search) AddURL(url string) {
 
 // Execute runs the composed search against the KeePass database.
 func (s *Search) Execute() ([]Entry, error) {
-	var reply []Entry
-	args := []interface{}{
-		s.UnsanitizedURLs,
-		s.ActionURL,
-		s.HTTPRealm,
-		s.LST,
-		s.RequireFullURLMatches,
-		s.UniqueID,
-		s.DBFileName,
-		s.FreeTextSearch,
-		s.Username,
-	}
-	err := s.client.JSONRPCCtx.r.Call("FindLogins", args, &reply)
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute, but honors ctx for cancellation.
+func (s *Search) ExecuteContext(ctx context.Context) ([]Entry, error) {
+	reply, err := s.client.FindLoginsContext(ctx, s.UnsanitizedURLs,
+		s.ActionURL, s.HTTPRealm, s.LST, s.RequireFullURLMatches,
+		s.UniqueID, s.DBFileName, s.FreeTextSearch, s.Username)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +179,50 @@ type FormField struct {
 	Type        FormFieldType `json:"type"`
 	ID          string        `json:"id"`
 	Page        int           `json:"page"`
+
+	// Secret holds the value of a password field decoded from JSON, in
+	// place of Value, so that the password never lands on the heap. It's
+	// shared by copies of the field, including any a CachedClient keeps.
+	Secret *secret.Value `json:"-"`
+}
+
+// Text returns the field's value, copying it out of Secret if need be.
+func (f *FormField) Text() string {
+	if f.Secret != nil {
+		return string(f.Secret.Bytes())
+	}
+	return f.Value
+}
+
+// MarshalJSON encodes the field, taking its value from Secret if that's set.
+func (f FormField) MarshalJSON() ([]byte, error) {
+	type plain FormField
+	p := plain(f)
+	if f.Secret != nil {
+		p.Value = string(f.Secret.Bytes())
+	}
+	return json.Marshal(p)
+}
+
+// UnmarshalJSON decodes the field, putting a password's value in Secret.
+func (f *FormField) UnmarshalJSON(data []byte) error {
+	type plain FormField
+	var raw struct {
+		plain
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = FormField(raw.plain)
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+	if f.Type == FFTpassword {
+		f.Secret = new(secret.Value)
+		return f.Secret.UnmarshalJSON(raw.Value)
+	}
+	return json.Unmarshal(raw.Value, &f.Value)
 }
 
 // Entry describes a single complete entry in the open KeePass database
@@ -193,12 +267,31 @@ func (e *Entry) Username() string {
 func (e *Entry) Password() string {
 	for _, f := range e.FormFieldList {
 		if f.Type == FFTpassword {
-			return f.Value
+			return f.Text()
 		}
 	}
 	return ""
 }
 
+// PasswordSecret is like Password, but returns a copy of the password as a
+// secret.Value, which the caller must Destroy, or nil if there's none.
+func (e *Entry) PasswordSecret() *secret.Value {
+	return passwordSecret(e.FormFieldList)
+}
+
+// passwordSecret returns a copy of the first password in fields.
+func passwordSecret(fields []FormField) *secret.Value {
+	for _, f := range fields {
+		if f.Type == FFTpassword {
+			if f.Secret != nil {
+				return f.Secret.Clone()
+			}
+			return secret.FromString(f.Value)
+		}
+	}
+	return nil
+}
+
 // ByAccuracy orders a list of Entries by match accuracy, for sort.Sort.
 type ByAccuracy []Entry
 
@@ -223,22 +316,87 @@ type Database struct {
 	IconImageData string `json:"iconImageData"`
 }
 
+// call issues a single JSON-RPC call, giving up if ctx is done before the
+// reply arrives. net/rpc offers no way to withdraw a request once sent, so
+// the reply to an abandoned call is simply discarded when it shows up.
+//
+// Calls which need a feature the server didn't advertise fail with
+// ErrUnsupported without being sent. If the client reconnects automatically
+// and the connection breaks, read-only calls are retried once on the new
+// connection, and others fail with ErrConnectionLost.
+func (c *Client) call(ctx context.Context, method string, args, reply interface{}) error {
+	if err := c.checkMethod(method); err != nil {
+		return err
+	}
+	r, generation, err := c.session()
+	if err == nil {
+		err = c.do(ctx, r, method, args, reply)
+	}
+	if c.opts.Reconnect == nil || c.closed.Load() || !brokenTransport(ctx, err) {
+		return err
+	}
+	c.logger().InfoContext(ctx, "Call failed, reconnecting", "method", method, "error", err)
+	if err := c.reconnect(ctx, generation); err != nil {
+		return err
+	}
+	if !idempotentMethods[method] {
+		return ErrConnectionLost
+	}
+	// Retry once; if the new connection breaks too, that's the caller's
+	// problem.
+	if r, _, err = c.session(); err != nil {
+		return err
+	}
+	return c.do(ctx, r, method, args, reply)
+}
+
+func (c *Client) do(ctx context.Context, r *rpc.Client, method string, args, reply interface{}) error {
+	call := r.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error == rpc.ErrShutdown {
+			return ErrClosed
+		}
+		if msg, ok := call.Error.(rpc.ServerError); ok {
+			return &RPCError{Method: method, Message: string(msg)}
+		}
+		return call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // LaunchGroupEditor opens the editor on a given group
 func (c *Client) LaunchGroupEditor(uuid, dbFileName string) error {
-	return c.JSONRPCCtx.r.Call("LaunchGroupEditor",
+	return c.LaunchGroupEditorContext(context.Background(), uuid, dbFileName)
+}
+
+// LaunchGroupEditorContext is like LaunchGroupEditor, but honors ctx for cancellation.
+func (c *Client) LaunchGroupEditorContext(ctx context.Context, uuid, dbFileName string) error {
+	return c.call(ctx, "LaunchGroupEditor",
 		[]interface{}{uuid, dbFileName}, nil)
 }
 
 // LaunchLoginEditor opens the editor on a given login
 func (c *Client) LaunchLoginEditor(uuid, dbFileName string) error {
-	return c.JSONRPCCtx.r.Call("LaunchLoginEditor",
+	return c.LaunchLoginEditorContext(context.Background(), uuid, dbFileName)
+}
+
+// LaunchLoginEditorContext is like LaunchLoginEditor, but honors ctx for cancellation.
+func (c *Client) LaunchLoginEditorContext(ctx context.Context, uuid, dbFileName string) error {
+	return c.call(ctx, "LaunchLoginEditor",
 		[]string{uuid, dbFileName}, nil)
 }
 
 // GetCurrentKFConfig returns configuration information for the running KeePass
 func (c *Client) GetCurrentKFConfig() (*Configuration, error) {
+	return c.GetCurrentKFConfigContext(context.Background())
+}
+
+// GetCurrentKFConfigContext is like GetCurrentKFConfig, but honors ctx for cancellation.
+func (c *Client) GetCurrentKFConfigContext(ctx context.Context) (*Configuration, error) {
 	var reply Configuration
-	err := c.JSONRPCCtx.r.Call("GetCurrentKFConfig", nil, &reply)
+	err := c.call(ctx, "GetCurrentKFConfig", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -247,8 +405,13 @@ func (c *Client) GetCurrentKFConfig() (*Configuration, error) {
 
 // GetApplicationMetadata retrieves information about the running KeePass
 func (c *Client) GetApplicationMetadata() (*ApplicationMetadata, error) {
+	return c.GetApplicationMetadataContext(context.Background())
+}
+
+// GetApplicationMetadataContext is like GetApplicationMetadata, but honors ctx for cancellation.
+func (c *Client) GetApplicationMetadataContext(ctx context.Context) (*ApplicationMetadata, error) {
 	var reply ApplicationMetadata
-	err := c.JSONRPCCtx.r.Call("GetApplicationMetadata", nil, &reply)
+	err := c.call(ctx, "GetApplicationMetadata", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -257,8 +420,13 @@ func (c *Client) GetApplicationMetadata() (*ApplicationMetadata, error) {
 
 // GetDatabaseName retrieves the name of the currently open database
 func (c *Client) GetDatabaseName() (string, error) {
+	return c.GetDatabaseNameContext(context.Background())
+}
+
+// GetDatabaseNameContext is like GetDatabaseName, but honors ctx for cancellation.
+func (c *Client) GetDatabaseNameContext(ctx context.Context) (string, error) {
 	var reply string
-	err := c.JSONRPCCtx.r.Call("GetDatabaseName", nil, &reply)
+	err := c.call(ctx, "GetDatabaseName", nil, &reply)
 	if err != nil {
 		return "", err
 	}
@@ -267,8 +435,13 @@ func (c *Client) GetDatabaseName() (string, error) {
 
 // GetDatabaseFileName retrieves the filename of the currently open database
 func (c *Client) GetDatabaseFileName() (string, error) {
+	return c.GetDatabaseFileNameContext(context.Background())
+}
+
+// GetDatabaseFileNameContext is like GetDatabaseFileName, but honors ctx for cancellation.
+func (c *Client) GetDatabaseFileNameContext(ctx context.Context) (string, error) {
 	var reply string
-	err := c.JSONRPCCtx.r.Call("GetDatabaseFileName", nil, &reply)
+	err := c.call(ctx, "GetDatabaseFileName", nil, &reply)
 	if err != nil {
 		return "", err
 	}
@@ -277,19 +450,34 @@ func (c *Client) GetDatabaseFileName() (string, error) {
 
 // ChangeDatabase switches the active KeePass database
 func (c *Client) ChangeDatabase(filename string, closeCurrent bool) error {
-	return c.JSONRPCCtx.r.Call("ChangeDatabase",
+	return c.ChangeDatabaseContext(context.Background(), filename, closeCurrent)
+}
+
+// ChangeDatabaseContext is like ChangeDatabase, but honors ctx for cancellation.
+func (c *Client) ChangeDatabaseContext(ctx context.Context, filename string, closeCurrent bool) error {
+	return c.call(ctx, "ChangeDatabase",
 		[]interface{}{filename, closeCurrent}, nil)
 }
 
 // ChangeLocation switches the active KeePass location
 func (c *Client) ChangeLocation(locationID string) error {
-	return c.JSONRPCCtx.r.Call("ChangeLocation", locationID, nil)
+	return c.ChangeLocationContext(context.Background(), locationID)
+}
+
+// ChangeLocationContext is like ChangeLocation, but honors ctx for cancellation.
+func (c *Client) ChangeLocationContext(ctx context.Context, locationID string) error {
+	return c.call(ctx, "ChangeLocation", locationID, nil)
 }
 
 // GetPasswordProfiles retrieves a list of password profiles
 func (c *Client) GetPasswordProfiles() ([]string, error) {
+	return c.GetPasswordProfilesContext(context.Background())
+}
+
+// GetPasswordProfilesContext is like GetPasswordProfiles, but honors ctx for cancellation.
+func (c *Client) GetPasswordProfilesContext(ctx context.Context) ([]string, error) {
 	var reply []string
-	err := c.JSONRPCCtx.r.Call("GetPasswordProfiles", nil, &reply)
+	err := c.call(ctx, "GetPasswordProfiles", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -298,8 +486,13 @@ func (c *Client) GetPasswordProfiles() ([]string, error) {
 
 // GeneratePassword asks KeePass to generate a new password
 func (c *Client) GeneratePassword(profileName, url string) (string, error) {
+	return c.GeneratePasswordContext(context.Background(), profileName, url)
+}
+
+// GeneratePasswordContext is like GeneratePassword, but honors ctx for cancellation.
+func (c *Client) GeneratePasswordContext(ctx context.Context, profileName, url string) (string, error) {
 	var reply string
-	err := c.JSONRPCCtx.r.Call("GeneratePassword",
+	err := c.call(ctx, "GeneratePassword",
 		[]string{profileName, url}, &reply)
 	if err != nil {
 		return "", err
@@ -309,8 +502,13 @@ func (c *Client) GeneratePassword(profileName, url string) (string, error) {
 
 // RemoveEntry removes a specified entry from the active KeePass database
 func (c *Client) RemoveEntry(uuid string) (bool, error) {
+	return c.RemoveEntryContext(context.Background(), uuid)
+}
+
+// RemoveEntryContext is like RemoveEntry, but honors ctx for cancellation.
+func (c *Client) RemoveEntryContext(ctx context.Context, uuid string) (bool, error) {
 	var reply bool
-	err := c.JSONRPCCtx.r.Call("RemoveEntry", uuid, &reply)
+	err := c.call(ctx, "RemoveEntry", uuid, &reply)
 	if err != nil {
 		return false, err
 	}
@@ -319,8 +517,13 @@ func (c *Client) RemoveEntry(uuid string) (bool, error) {
 
 // RemoveGroup removes a specified entry from the active KeePass database
 func (c *Client) RemoveGroup(uuid string) (bool, error) {
+	return c.RemoveGroupContext(context.Background(), uuid)
+}
+
+// RemoveGroupContext is like RemoveGroup, but honors ctx for cancellation.
+func (c *Client) RemoveGroupContext(ctx context.Context, uuid string) (bool, error) {
 	var reply bool
-	err := c.JSONRPCCtx.r.Call("RemoveGroup", uuid, &reply)
+	err := c.call(ctx, "RemoveGroup", uuid, &reply)
 	if err != nil {
 		return false, err
 	}
@@ -329,8 +532,13 @@ func (c *Client) RemoveGroup(uuid string) (bool, error) {
 
 // AddLogin adds a new login to the database
 func (c *Client) AddLogin(login *Entry, parentUUID, dbFileName string) (*Entry, error) {
+	return c.AddLoginContext(context.Background(), login, parentUUID, dbFileName)
+}
+
+// AddLoginContext is like AddLogin, but honors ctx for cancellation.
+func (c *Client) AddLoginContext(ctx context.Context, login *Entry, parentUUID, dbFileName string) (*Entry, error) {
 	var reply Entry
-	err := c.JSONRPCCtx.r.Call("AddLogin",
+	err := c.call(ctx, "AddLogin",
 		[]interface{}{login, parentUUID, dbFileName}, &reply)
 	if err != nil {
 		return nil, err
@@ -340,8 +548,13 @@ func (c *Client) AddLogin(login *Entry, parentUUID, dbFileName string) (*Entry,
 
 // AddGroup adds a new group to the database
 func (c *Client) AddGroup(name, parentUUID string) (*Group, error) {
+	return c.AddGroupContext(context.Background(), name, parentUUID)
+}
+
+// AddGroupContext is like AddGroup, but honors ctx for cancellation.
+func (c *Client) AddGroupContext(ctx context.Context, name, parentUUID string) (*Group, error) {
 	var reply Group
-	err := c.JSONRPCCtx.r.Call("AddGroup", []string{name, parentUUID}, &reply)
+	err := c.call(ctx, "AddGroup", []string{name, parentUUID}, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -350,8 +563,18 @@ func (c *Client) AddGroup(name, parentUUID string) (*Group, error) {
 
 // UpdateLogin updates an existing login in the database
 func (c *Client) UpdateLogin(login *Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*Entry, error) {
+	return c.UpdateLoginContext(context.Background(), login, oldLoginUUID, urlMergeMode, dbFileName)
+}
+
+// UpdateLoginContext is like UpdateLogin, but honors ctx for cancellation.
+func (c *Client) UpdateLoginContext(ctx context.Context, login *Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*Entry, error) {
+	if urlMergeMode == URLMergeReplaceAll {
+		if err := c.checkFeature("UpdateLogin", FeatureEntryURLReplacement); err != nil {
+			return nil, err
+		}
+	}
 	var reply Entry
-	err := c.JSONRPCCtx.r.Call("UpdateLogin",
+	err := c.call(ctx, "UpdateLogin",
 		[]interface{}{login, oldLoginUUID, urlMergeMode, dbFileName},
 		&reply)
 	if err != nil {
@@ -362,8 +585,13 @@ func (c *Client) UpdateLogin(login *Entry, oldLoginUUID string, urlMergeMode int
 
 // GetParent retrieves the parent group of a specified group
 func (c *Client) GetParent(uuid string) (*Group, error) {
+	return c.GetParentContext(context.Background(), uuid)
+}
+
+// GetParentContext is like GetParent, but honors ctx for cancellation.
+func (c *Client) GetParentContext(ctx context.Context, uuid string) (*Group, error) {
 	var reply Group
-	err := c.JSONRPCCtx.r.Call("GetParent", uuid, &reply)
+	err := c.call(ctx, "GetParent", uuid, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -372,8 +600,13 @@ func (c *Client) GetParent(uuid string) (*Group, error) {
 
 // GetRoot retrieves the root group of the database
 func (c *Client) GetRoot() (*Group, error) {
+	return c.GetRootContext(context.Background())
+}
+
+// GetRootContext is like GetRoot, but honors ctx for cancellation.
+func (c *Client) GetRootContext(ctx context.Context) (*Group, error) {
 	var reply Group
-	err := c.JSONRPCCtx.r.Call("GetRoot", nil, &reply)
+	err := c.call(ctx, "GetRoot", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -382,8 +615,13 @@ func (c *Client) GetRoot() (*Group, error) {
 
 // GetAllDatabases returns all of the available KeePass databases
 func (c *Client) GetAllDatabases(fullDetails bool) ([]Database, error) {
+	return c.GetAllDatabasesContext(context.Background(), fullDetails)
+}
+
+// GetAllDatabasesContext is like GetAllDatabases, but honors ctx for cancellation.
+func (c *Client) GetAllDatabasesContext(ctx context.Context, fullDetails bool) ([]Database, error) {
 	var reply []Database
-	err := c.JSONRPCCtx.r.Call("GetAllDataases", fullDetails, &reply)
+	err := c.call(ctx, "GetAllDatabases", fullDetails, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -392,8 +630,13 @@ func (c *Client) GetAllDatabases(fullDetails bool) ([]Database, error) {
 
 // GetAllLogins retrieves all logins in the database
 func (c *Client) GetAllLogins() ([]Entry, error) {
+	return c.GetAllLoginsContext(context.Background())
+}
+
+// GetAllLoginsContext is like GetAllLogins, but honors ctx for cancellation.
+func (c *Client) GetAllLoginsContext(ctx context.Context) ([]Entry, error) {
 	var reply []Entry
-	err := c.JSONRPCCtx.r.Call("GetAllLogins", nil, &reply)
+	err := c.call(ctx, "GetAllLogins", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -402,8 +645,13 @@ func (c *Client) GetAllLogins() ([]Entry, error) {
 
 // GetChildEntries returns all entries under a specified parent
 func (c *Client) GetChildEntries(uuid string) ([]Entry, error) {
+	return c.GetChildEntriesContext(context.Background(), uuid)
+}
+
+// GetChildEntriesContext is like GetChildEntries, but honors ctx for cancellation.
+func (c *Client) GetChildEntriesContext(ctx context.Context, uuid string) ([]Entry, error) {
 	var reply []Entry
-	err := c.JSONRPCCtx.r.Call("GetChildEntries", uuid, &reply)
+	err := c.call(ctx, "GetChildEntries", uuid, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -412,8 +660,13 @@ func (c *Client) GetChildEntries(uuid string) ([]Entry, error) {
 
 // GetChildGroups returns all groups under a specified parent
 func (c *Client) GetChildGroups(uuid string) ([]Group, error) {
+	return c.GetChildGroupsContext(context.Background(), uuid)
+}
+
+// GetChildGroupsContext is like GetChildGroups, but honors ctx for cancellation.
+func (c *Client) GetChildGroupsContext(ctx context.Context, uuid string) ([]Group, error) {
 	var reply []Group
-	err := c.JSONRPCCtx.r.Call("GetChildGroups", uuid, &reply)
+	err := c.call(ctx, "GetChildGroups", uuid, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -425,9 +678,16 @@ func (c *Client) GetChildGroups(uuid string) ([]Group, error) {
 // much sense exported via JSON-RPC. Original C# method signature:
 //
 // public int FindGroups(string name, string uuid, out Group[] groups)
+//
+// Deprecated: Use NewGroupSearch, which searches on the client side.
 func (c *Client) FindGroups(name, uuid string) (int, error) {
+	return c.FindGroupsContext(context.Background(), name, uuid)
+}
+
+// FindGroupsContext is like FindGroups, but honors ctx for cancellation.
+func (c *Client) FindGroupsContext(ctx context.Context, name, uuid string) (int, error) {
 	var reply int
-	err := c.JSONRPCCtx.r.Call("FindGroups", []interface{}{name, uuid, nil}, &reply)
+	err := c.call(ctx, "FindGroups", []interface{}{name, uuid, nil}, &reply)
 	if err != nil {
 		return -1, err
 	}
@@ -436,6 +696,11 @@ func (c *Client) FindGroups(name, uuid string) (int, error) {
 
 // FindLogins searches the database for logins matching a pattern
 func (c *Client) FindLogins(unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry, error) {
+	return c.FindLoginsContext(context.Background(), unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+}
+
+// FindLoginsContext is like FindLogins, but honors ctx for cancellation.
+func (c *Client) FindLoginsContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry, error) {
 	args := []interface{}{
 		unsanitizedURLs,
 		actionURL,
@@ -448,7 +713,7 @@ func (c *Client) FindLogins(unsanitizedURLs []string, actionURL, httpRealm strin
 		username,
 	}
 	var reply []Entry
-	err := c.JSONRPCCtx.r.Call("FindLogins", args, &reply)
+	err := c.call(ctx, "FindLogins", args, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -458,6 +723,11 @@ func (c *Client) FindLogins(unsanitizedURLs []string, actionURL, httpRealm strin
 // CountLogins returns the number of logins that match a pattern. At the
 // time of this writing, this method is unimplemented in the server.
 func (c *Client) CountLogins(URL, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool) (int, error) {
+	return c.CountLoginsContext(context.Background(), URL, actionURL, httpRealm, lst, requireFullURLMatches)
+}
+
+// CountLoginsContext is like CountLogins, but honors ctx for cancellation.
+func (c *Client) CountLoginsContext(ctx context.Context, URL, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool) (int, error) {
 	args := []interface{}{
 		URL,
 		actionURL,
@@ -466,7 +736,7 @@ func (c *Client) CountLogins(URL, actionURL, httpRealm string, lst LoginSearchTy
 		requireFullURLMatches,
 	}
 	var reply int
-	err := c.JSONRPCCtx.r.Call("CountLogins", args, &reply)
+	err := c.call(ctx, "CountLogins", args, &reply)
 	if err != nil {
 		return -1, err
 	}
@@ -477,8 +747,13 @@ func (c *Client) CountLogins(URL, actionURL, httpRealm string, lst LoginSearchTy
 
 // SystemListMethods (system.listMethods) returns all available methods
 func (c *Client) SystemListMethods() ([]string, error) {
+	return c.SystemListMethodsContext(context.Background())
+}
+
+// SystemListMethodsContext is like SystemListMethods, but honors ctx for cancellation.
+func (c *Client) SystemListMethodsContext(ctx context.Context) ([]string, error) {
 	var reply []string
-	err := c.JSONRPCCtx.r.Call("system.listMethods", nil, &reply)
+	err := c.call(ctx, "system.listMethods", nil, &reply)
 	if err != nil {
 		return nil, err
 	}
@@ -487,8 +762,13 @@ func (c *Client) SystemListMethods() ([]string, error) {
 
 // SystemVersion (system.version) returns the server version information
 func (c *Client) SystemVersion() (string, error) {
+	return c.SystemVersionContext(context.Background())
+}
+
+// SystemVersionContext is like SystemVersion, but honors ctx for cancellation.
+func (c *Client) SystemVersionContext(ctx context.Context) (string, error) {
 	var reply string
-	err := c.JSONRPCCtx.r.Call("system.version", nil, &reply)
+	err := c.call(ctx, "system.version", nil, &reply)
 	if err != nil {
 		return "", err
 	}
@@ -497,8 +777,13 @@ func (c *Client) SystemVersion() (string, error) {
 
 // SystemAbout (system.about) returns a summary of information about the service
 func (c *Client) SystemAbout() (string, error) {
+	return c.SystemAboutContext(context.Background())
+}
+
+// SystemAboutContext is like SystemAbout, but honors ctx for cancellation.
+func (c *Client) SystemAboutContext(ctx context.Context) (string, error) {
 	var reply string
-	err := c.JSONRPCCtx.r.Call("system.about", nil, &reply)
+	err := c.call(ctx, "system.about", nil, &reply)
 	if err != nil {
 		return "", err
 	}
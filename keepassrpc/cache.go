@@ -0,0 +1,358 @@
+package keepassrpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a CachedClient keeps results, unless told
+// otherwise.
+const DefaultCacheTTL = 30 * time.Second
+
+// cacheSignals are the signals after which cached results may be stale.
+var cacheSignals = []Signal{
+	SignalDatabaseOpen,
+	SignalDatabaseClosed,
+	SignalDatabaseSaved,
+	SignalDatabaseDeleted,
+	SignalDatabaseSelected,
+}
+
+// CacheStats counts how a CachedClient's reads were served.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+
+	// Invalidations counts how many times the cache was emptied, for
+	// whatever reason
+	Invalidations uint64
+}
+
+// CachedClient is a Client which remembers the results of GetRoot,
+// GetChildGroups, GetChildEntries, GetAllLogins, FindLogins and FindEntries.
+// Searches made with its NewSearch and NewGroupSearch, and walks given it as
+// their Tree, are served from the cache too. The cache is emptied by
+// mutations made through the CachedClient, by the server signalling that a
+// database has changed, and after reconnecting. Results are kept for no
+// longer than the TTL in any case, as the server's signals can't be relied
+// on to cover changes made in KeePass itself.
+//
+// Methods not listed here go straight to the Client. Mutations made through
+// the Client itself, rather than the CachedClient, aren't seen until the
+// server signals them.
+type CachedClient struct {
+	*Client
+
+	ttl      time.Duration
+	sigs     chan Signal
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	mu         sync.Mutex
+	entries    map[cacheKey]cacheEntry
+	epoch      uint64
+	generation int
+	stats      CacheStats
+}
+
+type cacheKey struct {
+	method string
+	arg    string // a UUID, or a search's encoded arguments
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewCachedClient wraps c in a cache which keeps results for ttl, or
+// DefaultCacheTTL if ttl is zero.
+func NewCachedClient(c *Client, ttl time.Duration) *CachedClient {
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	cc := &CachedClient{
+		Client:  c,
+		stop:    make(chan struct{}),
+		sigs:    make(chan Signal, 1),
+		ttl:     ttl,
+		entries: map[cacheKey]cacheEntry{},
+	}
+	_, cc.generation, _ = c.session()
+	c.Notify(cc.sigs, cacheSignals...)
+	go cc.watch()
+	return cc
+}
+
+// watch empties the cache whenever the server signals a change. Any signal
+// empties everything, so one waiting in the buffer is as good as several.
+func (cc *CachedClient) watch() {
+	for {
+		select {
+		case <-cc.sigs:
+			cc.Invalidate()
+		case <-cc.stop:
+			return
+		}
+	}
+}
+
+// Close stops watching for changes and closes the underlying Client.
+func (cc *CachedClient) Close() {
+	cc.Client.StopNotify(cc.sigs)
+	cc.stopOnce.Do(func() { close(cc.stop) })
+	cc.Client.Close()
+}
+
+// Invalidate empties the cache.
+func (cc *CachedClient) Invalidate() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.invalidateLocked()
+}
+
+func (cc *CachedClient) invalidateLocked() {
+	cc.entries = map[cacheKey]cacheEntry{}
+	cc.epoch++
+	cc.stats.Invalidations++
+}
+
+// Stats returns the cache's statistics so far.
+func (cc *CachedClient) Stats() CacheStats {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.stats
+}
+
+// lookup returns the cached value for key, if there is one, along with the
+// epoch to pass to store once a missing value has been fetched.
+func (cc *CachedClient) lookup(key cacheKey) (interface{}, uint64, bool) {
+	_, generation, _ := cc.Client.session()
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if generation != cc.generation {
+		// we may have missed signals while reconnecting
+		cc.generation = generation
+		cc.invalidateLocked()
+	}
+	e, ok := cc.entries[key]
+	if ok && time.Now().Before(e.expires) {
+		cc.stats.Hits++
+		return e.value, cc.epoch, true
+	}
+	if ok {
+		delete(cc.entries, key)
+	}
+	cc.stats.Misses++
+	return nil, cc.epoch, false
+}
+
+// store caches value for key, unless the cache has been emptied since
+// epoch, in which case value may already be stale.
+func (cc *CachedClient) store(key cacheKey, epoch uint64, value interface{}) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if epoch != cc.epoch {
+		return
+	}
+	cc.entries[key] = cacheEntry{value: value, expires: time.Now().Add(cc.ttl)}
+}
+
+// cached returns the value of fetch for key, from the cache if possible.
+// Callers get their own copy of cached slices, so they can sort them.
+func cached[T any](ctx context.Context, cc *CachedClient, key cacheKey, fetch func(context.Context) ([]T, error)) ([]T, error) {
+	v, epoch, ok := cc.lookup(key)
+	if ok {
+		return append([]T(nil), v.([]T)...), nil
+	}
+	reply, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cc.store(key, epoch, append([]T(nil), reply...))
+	return reply, nil
+}
+
+// GetRootContext is like Client.GetRootContext, but cached.
+func (cc *CachedClient) GetRootContext(ctx context.Context) (*Group, error) {
+	key := cacheKey{method: "GetRoot"}
+	v, epoch, ok := cc.lookup(key)
+	if ok {
+		g := v.(Group)
+		return &g, nil
+	}
+	g, err := cc.Client.GetRootContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cc.store(key, epoch, *g)
+	return g, nil
+}
+
+// GetRoot is like Client.GetRoot, but cached.
+func (cc *CachedClient) GetRoot() (*Group, error) {
+	return cc.GetRootContext(context.Background())
+}
+
+// GetChildGroupsContext is like Client.GetChildGroupsContext, but cached.
+func (cc *CachedClient) GetChildGroupsContext(ctx context.Context, uuid string) ([]Group, error) {
+	return cached(ctx, cc, cacheKey{"GetChildGroups", uuid}, func(ctx context.Context) ([]Group, error) {
+		return cc.Client.GetChildGroupsContext(ctx, uuid)
+	})
+}
+
+// GetChildGroups is like Client.GetChildGroups, but cached.
+func (cc *CachedClient) GetChildGroups(uuid string) ([]Group, error) {
+	return cc.GetChildGroupsContext(context.Background(), uuid)
+}
+
+// GetChildEntriesContext is like Client.GetChildEntriesContext, but cached.
+func (cc *CachedClient) GetChildEntriesContext(ctx context.Context, uuid string) ([]Entry, error) {
+	return cached(ctx, cc, cacheKey{"GetChildEntries", uuid}, func(ctx context.Context) ([]Entry, error) {
+		return cc.Client.GetChildEntriesContext(ctx, uuid)
+	})
+}
+
+// GetChildEntries is like Client.GetChildEntries, but cached.
+func (cc *CachedClient) GetChildEntries(uuid string) ([]Entry, error) {
+	return cc.GetChildEntriesContext(context.Background(), uuid)
+}
+
+// GetAllLoginsContext is like Client.GetAllLoginsContext, but cached.
+func (cc *CachedClient) GetAllLoginsContext(ctx context.Context) ([]Entry, error) {
+	return cached(ctx, cc, cacheKey{method: "GetAllLogins"}, cc.Client.GetAllLoginsContext)
+}
+
+// GetAllLogins is like Client.GetAllLogins, but cached.
+func (cc *CachedClient) GetAllLogins() ([]Entry, error) {
+	return cc.GetAllLoginsContext(context.Background())
+}
+
+// searchKey returns the cache key for a search with the given arguments.
+func searchKey(method string, args ...interface{}) cacheKey {
+	raw, _ := json.Marshal(args) // strings, bools and integers always encode
+	return cacheKey{method, string(raw)}
+}
+
+// FindLoginsContext is like Client.FindLoginsContext, but cached.
+func (cc *CachedClient) FindLoginsContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry, error) {
+	key := searchKey("FindLogins", unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+	return cached(ctx, cc, key, func(ctx context.Context) ([]Entry, error) {
+		return cc.Client.FindLoginsContext(ctx, unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+	})
+}
+
+// FindLogins is like Client.FindLogins, but cached.
+func (cc *CachedClient) FindLogins(unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry, error) {
+	return cc.FindLoginsContext(context.Background(), unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+}
+
+// FindEntriesContext is like Client.FindEntriesContext, but cached.
+func (cc *CachedClient) FindEntriesContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry2, error) {
+	key := searchKey("FindEntries", unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+	return cached(ctx, cc, key, func(ctx context.Context) ([]Entry2, error) {
+		return cc.Client.FindEntriesContext(ctx, unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+	})
+}
+
+// FindEntries is like Client.FindEntries, but cached.
+func (cc *CachedClient) FindEntries(unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry2, error) {
+	return cc.FindEntriesContext(context.Background(), unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+}
+
+// NewSearch is like Client.NewSearch, but the search is served from the
+// cache.
+func (cc *CachedClient) NewSearch() *Search {
+	s := cc.Client.NewSearch()
+	s.client = cc
+	return s
+}
+
+// NewGroupSearch is like Client.NewGroupSearch, but the search reads groups
+// from the cache.
+func (cc *CachedClient) NewGroupSearch() *GroupSearch {
+	return &GroupSearch{client: cc}
+}
+
+// The mutations below empty the cache whether or not they succeed, as a call
+// that failed in transit may still have taken effect.
+
+// AddLoginContext is like Client.AddLoginContext, and empties the cache.
+func (cc *CachedClient) AddLoginContext(ctx context.Context, login *Entry, parentUUID, dbFileName string) (*Entry, error) {
+	defer cc.Invalidate()
+	return cc.Client.AddLoginContext(ctx, login, parentUUID, dbFileName)
+}
+
+// AddLogin is like Client.AddLogin, and empties the cache.
+func (cc *CachedClient) AddLogin(login *Entry, parentUUID, dbFileName string) (*Entry, error) {
+	return cc.AddLoginContext(context.Background(), login, parentUUID, dbFileName)
+}
+
+// UpdateLoginContext is like Client.UpdateLoginContext, and empties the cache.
+func (cc *CachedClient) UpdateLoginContext(ctx context.Context, login *Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*Entry, error) {
+	defer cc.Invalidate()
+	return cc.Client.UpdateLoginContext(ctx, login, oldLoginUUID, urlMergeMode, dbFileName)
+}
+
+// UpdateLogin is like Client.UpdateLogin, and empties the cache.
+func (cc *CachedClient) UpdateLogin(login *Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*Entry, error) {
+	return cc.UpdateLoginContext(context.Background(), login, oldLoginUUID, urlMergeMode, dbFileName)
+}
+
+// AddEntryContext is like Client.AddEntryContext, and empties the cache.
+func (cc *CachedClient) AddEntryContext(ctx context.Context, entry *Entry2, parentUUID, dbFileName string) (*Entry2, error) {
+	defer cc.Invalidate()
+	return cc.Client.AddEntryContext(ctx, entry, parentUUID, dbFileName)
+}
+
+// AddEntry is like Client.AddEntry, and empties the cache.
+func (cc *CachedClient) AddEntry(entry *Entry2, parentUUID, dbFileName string) (*Entry2, error) {
+	return cc.AddEntryContext(context.Background(), entry, parentUUID, dbFileName)
+}
+
+// UpdateEntryContext is like Client.UpdateEntryContext, and empties the cache.
+func (cc *CachedClient) UpdateEntryContext(ctx context.Context, entry *Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*Entry2, error) {
+	defer cc.Invalidate()
+	return cc.Client.UpdateEntryContext(ctx, entry, oldUUID, urlMergeMode, dbFileName)
+}
+
+// UpdateEntry is like Client.UpdateEntry, and empties the cache.
+func (cc *CachedClient) UpdateEntry(entry *Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*Entry2, error) {
+	return cc.UpdateEntryContext(context.Background(), entry, oldUUID, urlMergeMode, dbFileName)
+}
+
+// RemoveEntryContext is like Client.RemoveEntryContext, and empties the cache.
+func (cc *CachedClient) RemoveEntryContext(ctx context.Context, uuid string) (bool, error) {
+	defer cc.Invalidate()
+	return cc.Client.RemoveEntryContext(ctx, uuid)
+}
+
+// RemoveEntry is like Client.RemoveEntry, and empties the cache.
+func (cc *CachedClient) RemoveEntry(uuid string) (bool, error) {
+	return cc.RemoveEntryContext(context.Background(), uuid)
+}
+
+// AddGroupContext is like Client.AddGroupContext, and empties the cache.
+func (cc *CachedClient) AddGroupContext(ctx context.Context, name, parentUUID string) (*Group, error) {
+	defer cc.Invalidate()
+	return cc.Client.AddGroupContext(ctx, name, parentUUID)
+}
+
+// AddGroup is like Client.AddGroup, and empties the cache.
+func (cc *CachedClient) AddGroup(name, parentUUID string) (*Group, error) {
+	return cc.AddGroupContext(context.Background(), name, parentUUID)
+}
+
+// RemoveGroupContext is like Client.RemoveGroupContext, and empties the cache.
+func (cc *CachedClient) RemoveGroupContext(ctx context.Context, uuid string) (bool, error) {
+	defer cc.Invalidate()
+	return cc.Client.RemoveGroupContext(ctx, uuid)
+}
+
+// RemoveGroup is like Client.RemoveGroup, and empties the cache.
+func (cc *CachedClient) RemoveGroup(uuid string) (bool, error) {
+	return cc.RemoveGroupContext(context.Background(), uuid)
+}
@@ -0,0 +1,159 @@
+package keepassrpc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestCachedClient(t *testing.T) {
+	srv := newServer(t)
+	root := srv.Root()
+	srv.AddGroup(root.UniqueID, "first")
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	srv.OnCall(func(method string) error {
+		mu.Lock()
+		calls[method]++
+		mu.Unlock()
+		return nil
+	})
+	called := func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+
+	cc := keepassrpc.NewCachedClient(dial(t, srv, "xavier"), time.Minute)
+	defer cc.Close()
+
+	countGroups := func() int {
+		t.Helper()
+		groups, err := cc.GetChildGroups(root.UniqueID)
+		if err != nil {
+			t.Fatal("GetChildGroups:", err)
+		}
+		return len(groups)
+	}
+
+	for i := 0; i < 3; i++ {
+		if n := countGroups(); n != 1 {
+			t.Fatalf("got %d groups, want 1", n)
+		}
+	}
+	if n := called("GetChildGroups"); n != 1 {
+		t.Errorf("GetChildGroups called %d times, want 1", n)
+	}
+	if s := cc.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("got %+v, want 2 hits and 1 miss", s)
+	}
+
+	// Our own mutations invalidate the cache.
+	if _, err := cc.AddGroup("second", root.UniqueID); err != nil {
+		t.Fatal("AddGroup:", err)
+	}
+	if n := countGroups(); n != 2 {
+		t.Errorf("got %d groups after AddGroup, want 2", n)
+	}
+
+	// Other changes aren't seen until the server signals them.
+	srv.AddGroup(root.UniqueID, "third")
+	if n := countGroups(); n != 2 {
+		t.Errorf("got %d groups before signal, want 2 (cached)", n)
+	}
+	if err := srv.Signal(keepassrpc.SignalDatabaseSaved); err != nil {
+		t.Fatal("Signal:", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for countGroups() != 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("cache not invalidated by DATABASE_SAVED signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCachedClientTTL(t *testing.T) {
+	srv := newServer(t)
+	root := srv.Root()
+
+	cc := keepassrpc.NewCachedClient(dial(t, srv, "yvonne"), 50*time.Millisecond)
+	defer cc.Close()
+
+	logins, err := cc.GetAllLogins()
+	if err != nil {
+		t.Fatal("GetAllLogins:", err)
+	}
+	srv.AddEntry(root.UniqueID, keepassrpc.Entry{Title: "new"})
+	if again, _ := cc.GetAllLogins(); len(again) != len(logins) {
+		t.Errorf("got %d logins, want %d (cached)", len(again), len(logins))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	again, err := cc.GetAllLogins()
+	if err != nil {
+		t.Fatal("GetAllLogins:", err)
+	}
+	if len(again) != len(logins)+1 {
+		t.Errorf("got %d logins after TTL, want %d", len(again), len(logins)+1)
+	}
+	if s := cc.Stats(); s.Hits != 1 || s.Misses != 2 {
+		t.Errorf("got %+v, want 1 hit and 2 misses", s)
+	}
+}
+
+func TestCachedClientSearches(t *testing.T) {
+	srv := newServer(t)
+	root := srv.Root()
+	work := srv.AddGroup(root.UniqueID, "Work")
+	srv.AddEntry(work.UniqueID, keepassrpc.Entry{Title: "mail", URLs: []string{"https://mail.example.com/"}})
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	srv.OnCall(func(method string) error {
+		mu.Lock()
+		calls[method]++
+		mu.Unlock()
+		return nil
+	})
+
+	cc := keepassrpc.NewCachedClient(dial(t, srv, "oscar"), time.Minute)
+	defer cc.Close()
+
+	for i := 0; i < 2; i++ {
+		s := cc.NewSearch()
+		s.AddURL("https://mail.example.com/")
+		if entries, err := s.Execute(); err != nil || len(entries) != 1 {
+			t.Fatalf("Search found %d entries (%v), want 1", len(entries), err)
+		}
+
+		gs := cc.NewGroupSearch()
+		gs.Pattern = "Work"
+		if groups, err := gs.Execute(); err != nil || len(groups) != 1 {
+			t.Fatalf("GroupSearch found %d groups (%v), want 1", len(groups), err)
+		}
+
+		r, err := cc.GetRoot()
+		if err != nil {
+			t.Fatal("GetRoot:", err)
+		}
+		if err := keepassrpc.Walk(context.Background(), cc, r, func(*keepassrpc.Node) error { return nil }); err != nil {
+			t.Fatal("Walk:", err)
+		}
+	}
+
+	// Each group's children are fetched once, however many times the
+	// tree is searched or walked.
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{"FindLogins": 1, "GetRoot": 1, "GetChildGroups": 2, "GetChildEntries": 2}
+	for method, n := range want {
+		if calls[method] != n {
+			t.Errorf("%s called %d times, want %d", method, calls[method], n)
+		}
+	}
+}
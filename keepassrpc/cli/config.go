@@ -1,13 +1,11 @@
 package cli
 
 import (
-	"encoding/json"
 	"math/big"
-	"os"
 	"path/filepath"
 
 	"github.com/kirsle/configdir"
-	"github.com/tmc/keyring"
+	"github.com/logic/gkp/keepassrpc/secret"
 )
 
 var (
@@ -17,54 +15,162 @@ var (
 	ConfigID = "gkp"
 )
 
-// Configuration represents our saved username and session key state.
+// Configuration represents our saved username and session key state, for
+// the profile in use.
 type Configuration struct {
-	Username string
+	Profile
 
-	sessionKey *big.Int
+	// ProfileName is the name of the profile in use.
+	ProfileName string
+
+	settings   settings
+	sessionKey *secret.Value // as the 32 bytes of the AES key
+	loaded     bool          // whether sessionKey has been read from store
+	store      SecretStore
 	file       string
 }
 
-// Save checkpoints our configuration to disk, typically called after a
-// successful SRP negotiation.
+// ProfileNames lists the profiles defined in settings.json.
+func (config *Configuration) ProfileNames() []string {
+	return config.settings.names()
+}
+
+// sessionKeyBytes is the size of a session key, in bytes.
+const sessionKeyBytes = 32
+
+// setSessionKey stores a copy of key.
+func (config *Configuration) setSessionKey(key *big.Int) {
+	config.sessionKey.Destroy()
+	config.sessionKey = nil
+	if key != nil && key.BitLen() <= 8*sessionKeyBytes {
+		config.sessionKey = secret.New(key.FillBytes(make([]byte, sessionKeyBytes)))
+	}
+}
+
+// bigSessionKey returns the session key as a big.Int, for which the caller
+// is responsible, or nil if we don't have one.
+func (config *Configuration) bigSessionKey() *big.Int {
+	if config.sessionKey == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(config.sessionKey.Bytes())
+}
+
+// wipeInt zeroes a copy of the session key, including the memory behind it.
+func wipeInt(x *big.Int) {
+	clear(x.Bits())
+	x.SetInt64(0)
+}
+
+// Store returns the secret store holding our session key, opening the one
+// named by SecretStore if SetStore hasn't chosen another.
+func (config *Configuration) Store() (SecretStore, error) {
+	if config.store == nil {
+		store, err := OpenStore(config.SecretStore, config)
+		if err != nil {
+			return nil, err
+		}
+		config.store = store
+	}
+	return config.store, nil
+}
+
+// SetStore overrides the secret store named in the configuration, without
+// changing the saved setting.
+func (config *Configuration) SetStore(store SecretStore) {
+	config.store = store
+	config.sessionKey.Destroy()
+	config.sessionKey = nil
+	config.loaded = false
+}
+
+// loadSessionKey reads our session key from the secret store, if we haven't
+// already.
+func (config *Configuration) loadSessionKey() error {
+	if config.loaded || config.Username == "" {
+		return nil
+	}
+	store, err := config.Store()
+	if err != nil {
+		return err
+	}
+	key, err := store.Get(config.Username)
+	if err != nil && err != ErrNoSecret {
+		return err
+	}
+	config.sessionKey.Destroy()
+	config.sessionKey = key
+	config.loaded = true
+	return nil
+}
+
+// Destroy wipes the session key from memory, along with anything the secret
+// store holds, such as a passphrase. The configuration can still be saved
+// afterwards, but without a session key.
+func (config *Configuration) Destroy() {
+	config.sessionKey.Destroy()
+	config.sessionKey = nil
+	if d, ok := config.store.(interface{ Destroy() }); ok {
+		d.Destroy()
+	}
+}
+
+// Save checkpoints our configuration to disk, and the session key to the
+// secret store, typically called after a successful SRP negotiation. Only
+// our profile is changed; others are left as they are on disk, even if
+// another process has changed them since we loaded ours.
 func (config *Configuration) Save() error {
-	f, err := os.Create(config.file)
+	// The key goes first, so that settings.json never names a user
+	// whose key is missing.
+	if config.sessionKey != nil {
+		store, err := config.Store()
+		if err != nil {
+			return err
+		}
+		if err := store.Set(config.Username, config.sessionKey); err != nil {
+			return err
+		}
+	}
+
+	var latest settings
+	err := updateSettings(config.file, func(s *settings) {
+		s.setProfile(config.ProfileName, config.Profile)
+		latest = *s
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	encoder := json.NewEncoder(f)
-	encoder.Encode(config)
-	return keyring.Set(ConfigID, config.Username, config.sessionKey.Text(16))
+	config.settings = latest
+	return nil
 }
 
-// LoadConfig reads both our on-disk configuration state as well as the
-// secret stored in the keyring.
+// LoadConfig reads our on-disk configuration state, for the default profile.
+// The session key is read from the secret store when it's first needed.
 func LoadConfig() (*Configuration, error) {
-	var config Configuration
+	return LoadProfile("")
+}
 
+// LoadProfile is like LoadConfig, but for the named profile. An empty name
+// means the default profile.
+func LoadProfile(name string) (*Configuration, error) {
 	configPath := configdir.LocalConfig(ConfigID)
 	if err := configdir.MakePath(configPath); err != nil {
 		return nil, err
 	}
+	return loadProfile(filepath.Join(configPath, "settings.json"), name)
+}
 
-	config.file = filepath.Join(configPath, "settings.json")
-	f, err := os.Open(config.file)
+func loadProfile(file, name string) (*Configuration, error) {
+	s, err := readSettings(file)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return &config, nil
-		}
 		return nil, err
 	}
-	defer f.Close()
-	d := json.NewDecoder(f)
-	d.Decode(&config)
-	if config.Username != "" {
-		sessionKey, err := keyring.Get(ConfigID, config.Username)
-		if err != nil {
-			return nil, err
-		}
-		config.sessionKey, _ = new(big.Int).SetString(sessionKey, 16)
+	config := Configuration{file: file, settings: *s}
+	name, p, err := config.settings.profile(name)
+	if err != nil {
+		return nil, err
 	}
+	config.ProfileName = name
+	config.Profile = *p
 	return &config, nil
 }
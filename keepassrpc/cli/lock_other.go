@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package cli
+
+// lockFile does nothing, as this platform has no advisory locks we use;
+// updates are still atomic, but concurrent ones may lose each other's
+// changes.
+func lockFile(path string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/logic/gkp/keepassrpc"
+	"github.com/logic/gkp/keepassrpc/secret"
+)
+
+// Pair is like DialWithOptions, but always negotiates a new session key,
+// asking prompt for a pairing code, even if we have a key already. The
+// username is kept, if we have one.
+func Pair(ctx context.Context, config *Configuration, opts *keepassrpc.Options, prompt keepassrpc.Passworder) (*keepassrpc.Client, error) {
+	if prompt == nil {
+		return nil, fmt.Errorf("%w: no way to ask for a pairing code", keepassrpc.ErrAuthRequired)
+	}
+	config.sessionKey.Destroy()
+	config.sessionKey = nil
+	config.loaded = true
+	return DialWithOptions(ctx, config, opts, prompt)
+}
+
+// Unpair forgets our username and session key, so that the next Dial pairs
+// afresh. KeePass remembers the old pairing until it's removed there.
+func (config *Configuration) Unpair() error {
+	if config.Username != "" {
+		store, err := config.Store()
+		if err != nil {
+			return err
+		}
+		if err := store.Delete(config.Username); err != nil {
+			return err
+		}
+	}
+	config.sessionKey.Destroy()
+	config.sessionKey = nil
+	config.loaded = false
+	config.Username = ""
+	return config.Save()
+}
+
+// Fingerprint identifies our session key without revealing it, in the style
+// of ssh-keygen -l, or returns "" if we don't have one.
+func (config *Configuration) Fingerprint() (string, error) {
+	if err := config.loadSessionKey(); err != nil {
+		return "", err
+	}
+	if config.sessionKey == nil {
+		return "", nil
+	}
+	sum := sha256.Sum256(config.sessionKey.Bytes())
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// PairingPassphrase returns the Passphraser for ExportPairing and
+// ImportPairing, which reads $GKP_PAIRING_PASSPHRASE, or asks on the
+// terminal.
+func PairingPassphrase() Passphraser {
+	return EnvPassphrase(envName("PAIRING_PASSPHRASE"), func() (*secret.Value, error) {
+		return AskPassphrase("Passphrase for the exported pairing: ")
+	})
+}
+
+// exportedPairing is what ExportPairing seals.
+type exportedPairing struct {
+	Profile
+	Key []byte
+}
+
+// ExportPairing seals our username and session key, along with the endpoint
+// and client identity, with pass, for ImportPairing to install on another
+// machine or in a container.
+func (config *Configuration) ExportPairing(pass *secret.Value) ([]byte, error) {
+	if err := config.loadSessionKey(); err != nil {
+		return nil, err
+	}
+	if config.sessionKey == nil {
+		return nil, fmt.Errorf("%w: not paired", ErrNoSecret)
+	}
+	p := exportedPairing{
+		Profile: Profile{
+			URL:        config.URL,
+			Username:   config.Username,
+			ClientID:   config.ClientID,
+			ClientName: config.ClientName,
+			ClientDesc: config.ClientDesc,
+		},
+		Key: config.sessionKey.Bytes(),
+	}
+	plaintext, err := json.Marshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	data, err := seal(pass, plaintext)
+	clear(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(blob, '\n'), nil
+}
+
+// ImportPairing installs a pairing sealed by ExportPairing in the profile in
+// use, replacing its own, and saves it. The profile keeps its secret store.
+func (config *Configuration) ImportPairing(blob []byte, pass *secret.Value) error {
+	var data sealedData
+	if err := json.Unmarshal(blob, &data); err != nil {
+		return fmt.Errorf("not an exported pairing: %v", err)
+	}
+	plaintext, err := unseal(pass, &data)
+	if err != nil {
+		return err
+	}
+	defer clear(plaintext)
+	var p exportedPairing
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return fmt.Errorf("not an exported pairing: %v", err)
+	}
+	defer clear(p.Key)
+	if p.Username == "" || len(p.Key) != sessionKeyBytes {
+		return errors.New("not an exported pairing: no username or key")
+	}
+
+	store, err := config.Store()
+	if err != nil {
+		return err
+	}
+	if config.Username != "" && config.Username != p.Username {
+		err := store.Delete(config.Username)
+		if err != nil && !errors.Is(err, ErrReadOnly) {
+			return err
+		}
+	}
+	config.Username = p.Username
+	if p.URL != "" {
+		config.URL = p.URL
+	}
+	if p.ClientID != "" {
+		config.ClientID, config.ClientName, config.ClientDesc = p.ClientID, p.ClientName, p.ClientDesc
+	}
+	config.sessionKey.Destroy()
+	config.sessionKey = secret.New(bytes.Clone(p.Key))
+	config.loaded = true
+	return config.Save()
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+	"github.com/logic/gkp/keepassrpc/keepassrpctest"
+	"github.com/logic/gkp/keepassrpc/secret"
+)
+
+// testConfig returns an empty configuration, saved in a temporary directory,
+// with its keys in memory.
+func testConfig(t *testing.T) *Configuration {
+	t.Helper()
+	config, err := loadProfile(filepath.Join(t.TempDir(), "settings.json"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.SetStore(NewMemoryStore())
+	return config
+}
+
+func TestPair(t *testing.T) {
+	srv := keepassrpctest.NewServer()
+	defer srv.Close()
+	opts := &keepassrpc.Options{URL: srv.URL}
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+
+	config := testConfig(t)
+	if fp, err := config.Fingerprint(); err != nil || fp != "" {
+		t.Errorf("Fingerprint() before pairing = %q, %v", fp, err)
+	}
+	c, err := DialWithOptions(context.Background(), config, opts, pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	username := config.Username
+	first, err := config.Fingerprint()
+	if err != nil || first == "" {
+		t.Fatalf("Fingerprint() after pairing = %q, %v", first, err)
+	}
+
+	if _, err := Pair(context.Background(), config, opts, nil); !errors.Is(err, keepassrpc.ErrAuthRequired) {
+		t.Errorf("Pair() without a prompt = %v, want ErrAuthRequired", err)
+	}
+	c, err = Pair(context.Background(), config, opts, pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	second, _ := config.Fingerprint()
+	if config.Username != username || second == first {
+		t.Errorf("Pair() kept key %s for %s, was %s for %s", second, config.Username, first, username)
+	}
+
+	// The new key is accepted without pairing again.
+	c, err = DialWithOptions(context.Background(), config, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	store, _ := config.Store()
+	if err := config.Unpair(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(username); err != ErrNoSecret {
+		t.Errorf("key still stored after Unpair(): %v", err)
+	}
+	if fp, _ := config.Fingerprint(); config.Username != "" || fp != "" {
+		t.Errorf("Unpair() left %q, %q", config.Username, fp)
+	}
+}
+
+func TestExportPairing(t *testing.T) {
+	from := testConfig(t)
+	from.Username = "alice"
+	from.URL = "ws://127.0.0.1:12547/"
+	from.sessionKey = secret.New(append([]byte(nil), testKey...))
+	from.loaded = true
+
+	pass := secret.FromString("correct horse")
+	defer pass.Destroy()
+	blob, err := from.ExportPairing(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to := testConfig(t)
+	wrong := secret.FromString("battery staple")
+	defer wrong.Destroy()
+	if err := to.ImportPairing(blob, wrong); err != ErrBadPassphrase {
+		t.Errorf("ImportPairing() with the wrong passphrase = %v, want ErrBadPassphrase", err)
+	}
+	if err := to.ImportPairing(blob, pass); err != nil {
+		t.Fatal(err)
+	}
+	if to.Username != "alice" || to.URL != from.URL {
+		t.Errorf("ImportPairing() gave %+v", to.Profile)
+	}
+	want, _ := from.Fingerprint()
+	if got, _ := to.Fingerprint(); got != want {
+		t.Errorf("imported key %s, want %s", got, want)
+	}
+	store, _ := to.Store()
+	if _, err := store.Get("alice"); err != nil {
+		t.Errorf("imported key not stored: %v", err)
+	}
+
+	if _, err := testConfig(t).ExportPairing(pass); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("ExportPairing() when not paired = %v, want ErrNoSecret", err)
+	}
+}
+
+func TestImportPairingMalformed(t *testing.T) {
+	from := testConfig(t)
+	from.Username = "bob"
+	from.sessionKey = secret.New(append([]byte(nil), testKey...))
+	from.loaded = true
+	pass := secret.FromString("correct horse")
+	defer pass.Destroy()
+	blob, err := from.ExportPairing(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		edit func(*sealKDF)
+	}{
+		{"no threads", func(k *sealKDF) { k.Threads = 0 }},
+		{"no time", func(k *sealKDF) { k.Time = 0 }},
+		{"too much time", func(k *sealKDF) { k.Time = 11 }},
+		{"too little memory", func(k *sealKDF) { k.Memory = 8*uint32(k.Threads) - 1 }},
+		{"too much memory", func(k *sealKDF) { k.Memory = 1<<20 + 1 }},
+	} {
+		var data sealedData
+		if err := json.Unmarshal(blob, &data); err != nil {
+			t.Fatal(err)
+		}
+		tc.edit(&data.KDF)
+		bad, err := json.Marshal(&data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := testConfig(t).ImportPairing(bad, pass); err == nil || err == ErrBadPassphrase {
+			t.Errorf("ImportPairing() with %s = %v, want a parameter error", tc.name, err)
+		}
+	}
+}
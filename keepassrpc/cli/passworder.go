@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// pairingPrompt is what we ask when KeePass shows a pairing code.
+const pairingPrompt = "Enter the code provided by KeePass: "
+
+// AutoPrompt returns the Passworder best suited to how we were run, or nil
+// if there's no way to ask, in which case dialing fails with
+// keepassrpc.ErrAuthRequired unless we're already paired. In order, it
+// reads from the file descriptor in $GKP_PAIRING_CODE_FD; runs the program
+// in $GKP_ASKPASS, or the pinentry in $GKP_PINENTRY; runs $GIT_ASKPASS or
+// $SSH_ASKPASS; asks on the terminal; or runs pinentry, if it's installed.
+func AutoPrompt() keepassrpc.Passworder {
+	if v := os.Getenv(envName("PAIRING_CODE_FD")); v != "" {
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			return func() (string, error) {
+				return "", fmt.Errorf("%s: %v", envName("PAIRING_CODE_FD"), err)
+			}
+		}
+		return FDPrompt(fd)
+	}
+	if program := os.Getenv(envName("ASKPASS")); program != "" {
+		return AskpassPrompt(program)
+	}
+	if program := os.Getenv(envName("PINENTRY")); program != "" {
+		return PinentryPrompt(program)
+	}
+	for _, name := range []string{"GIT_ASKPASS", "SSH_ASKPASS"} {
+		if program := os.Getenv(name); program != "" {
+			return AskpassPrompt(program)
+		}
+	}
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		tty.Close()
+		return TTYPrompt
+	}
+	if program, err := exec.LookPath("pinentry"); err == nil {
+		return PinentryPrompt(program)
+	}
+	return nil
+}
+
+// readCode reads a line holding a pairing code from r.
+func readCode(r io.Reader) (string, error) {
+	text, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && (err != io.EOF || text == "") {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// TTYPrompt is a keepassrpc.Passworder which asks on the controlling
+// terminal, leaving stdin and stdout alone.
+func TTYPrompt() (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to ask for the pairing code on: %v", err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, pairingPrompt)
+	return readCode(tty)
+}
+
+// FDPrompt returns a keepassrpc.Passworder which reads a line from the file
+// descriptor fd, for use by scripts.
+func FDPrompt(fd int) keepassrpc.Passworder {
+	return func() (string, error) {
+		f := os.NewFile(uintptr(fd), "pairing code")
+		if f == nil {
+			return "", fmt.Errorf("bad file descriptor %d", fd)
+		}
+		defer f.Close()
+		return readCode(f)
+	}
+}
+
+// AskpassPrompt returns a keepassrpc.Passworder which runs program, in the
+// manner of SSH_ASKPASS, with the prompt as its argument, and takes the code
+// from its output.
+func AskpassPrompt(program string) keepassrpc.Passworder {
+	return func() (string, error) {
+		cmd := exec.Command(program, pairingPrompt)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", program, err)
+		}
+		return readCode(bytes.NewReader(out))
+	}
+}
+
+// PinentryPrompt returns a keepassrpc.Passworder which asks with program,
+// speaking the Assuan protocol of GnuPG's pinentry.
+func PinentryPrompt(program string) keepassrpc.Passworder {
+	return func() (string, error) {
+		cmd := exec.Command(program)
+		in, err := cmd.StdinPipe()
+		if err != nil {
+			return "", err
+		}
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return "", err
+		}
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			return "", fmt.Errorf("%s: %v", program, err)
+		}
+		defer cmd.Wait()
+		defer in.Close()
+
+		p := &pinentry{in: in, out: bufio.NewReader(out)}
+		if _, err := p.response(); err != nil {
+			return "", fmt.Errorf("%s: %v", program, err)
+		}
+		commands := []string{
+			"SETTITLE KeePass pairing",
+			"SETDESC " + assuanEscape("KeePass is showing a code to pair this program with it."),
+			"SETPROMPT Code:",
+		}
+		if tty := os.Getenv("GPG_TTY"); tty != "" {
+			commands = append(commands, "OPTION ttyname="+tty)
+		}
+		for _, c := range commands {
+			if _, err := p.command(c); err != nil {
+				return "", fmt.Errorf("%s: %v", program, err)
+			}
+		}
+		code, err := p.command("GETPIN")
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", program, err)
+		}
+		p.command("BYE")
+		return strings.TrimSpace(code), nil
+	}
+}
+
+// pinentry is a connection to a pinentry program.
+type pinentry struct {
+	in  io.Writer
+	out *bufio.Reader
+}
+
+// command sends line, returning the data in the response.
+func (p *pinentry) command(line string) (string, error) {
+	if _, err := io.WriteString(p.in, line+"\n"); err != nil {
+		return "", err
+	}
+	return p.response()
+}
+
+// response reads lines up to the OK or ERR which ends a response, returning
+// the data sent along the way.
+func (p *pinentry) response() (string, error) {
+	var data strings.Builder
+	for {
+		line, err := p.out.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "OK" || strings.HasPrefix(line, "OK "):
+			return data.String(), nil
+		case strings.HasPrefix(line, "ERR "):
+			return "", fmt.Errorf("pinentry: %s", line[len("ERR "):])
+		case strings.HasPrefix(line, "D "):
+			s, err := url.PathUnescape(line[len("D "):])
+			if err != nil {
+				return "", err
+			}
+			data.WriteString(s)
+		}
+		// Status lines and comments are ignored.
+	}
+}
+
+// assuanEscape percent-escapes the characters an Assuan command can't carry.
+func assuanEscape(s string) string {
+	r := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	return r.Replace(s)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// script writes an executable shell script, skipping the test if there's no
+// shell to run it.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+	path := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFDPrompt(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteString("1234\n")
+	w.Close()
+	if code, err := FDPrompt(int(r.Fd()))(); err != nil || code != "1234" {
+		t.Errorf("FDPrompt() = %q, %v", code, err)
+	}
+}
+
+func TestAskpassPrompt(t *testing.T) {
+	askpass := script(t, `test "$1" = "`+pairingPrompt+`" && echo 5678`)
+	if code, err := AskpassPrompt(askpass)(); err != nil || code != "5678" {
+		t.Errorf("AskpassPrompt() = %q, %v", code, err)
+	}
+	if _, err := AskpassPrompt(script(t, "exit 1"))(); err == nil {
+		t.Error("AskpassPrompt() succeeded when the program failed")
+	}
+}
+
+func TestPinentryPrompt(t *testing.T) {
+	pinentry := script(t, `
+echo "OK Pleased to meet you"
+while read cmd rest; do
+	case "$cmd" in
+	GETPIN) echo "# a comment"; echo "D 90%2512"; echo OK ;;
+	BYE) echo "OK closing connection"; exit 0 ;;
+	SETPROMPT) test "$rest" = "Code:" && echo OK || echo "ERR 1 bad prompt" ;;
+	*) echo OK ;;
+	esac
+done
+`)
+	if code, err := PinentryPrompt(pinentry)(); err != nil || code != "90%12" {
+		t.Errorf("PinentryPrompt() = %q, %v", code, err)
+	}
+
+	cancelled := script(t, `
+echo OK
+while read cmd rest; do
+	case "$cmd" in
+	GETPIN) echo "ERR 83886179 Operation cancelled" ;;
+	*) echo OK ;;
+	esac
+done
+`)
+	if _, err := PinentryPrompt(cancelled)(); err == nil {
+		t.Error("PinentryPrompt() succeeded when cancelled")
+	}
+}
+
+func TestAutoPrompt(t *testing.T) {
+	t.Setenv("GKP_PAIRING_CODE_FD", "stdin")
+	t.Setenv("GKP_ASKPASS", script(t, "echo 4321"))
+	if _, err := AutoPrompt()(); err == nil {
+		t.Error("AutoPrompt() accepted a bad GKP_PAIRING_CODE_FD")
+	}
+	t.Setenv("GKP_PAIRING_CODE_FD", "")
+	if code, err := AutoPrompt()(); err != nil || code != "4321" {
+		t.Errorf("AutoPrompt() with GKP_ASKPASS = %q, %v", code, err)
+	}
+}
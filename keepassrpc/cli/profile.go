@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// DefaultProfileName names the profile held at the top level of
+// settings.json, which is all there was before profiles.
+const DefaultProfileName = "default"
+
+// ProfileEnv is the environment variable programs should consult for the
+// profile to use, if not told on the command line.
+const ProfileEnv = "KP_PROFILE"
+
+// ErrNoProfile is returned when asked for a profile settings.json doesn't
+// define.
+var ErrNoProfile = errors.New("cli: no such profile")
+
+// Profile describes how to reach one KeePass instance, and who we are to it.
+type Profile struct {
+	// URL is the KeePassRPC endpoint, if not keepassrpc.DefaultURL.
+	URL string `json:",omitempty"`
+
+	Username string
+
+	// SecretStore names where the session key is kept: StoreKeyring
+	// (the default), StoreFile, StoreEnv or StoreMemory.
+	SecretStore string `json:",omitempty"`
+
+	// SecretFile is the file used by StoreFile, if not secrets.json
+	// beside settings.json.
+	SecretFile string `json:",omitempty"`
+
+	// ClientID, ClientName and ClientDesc, if set, override how the
+	// program identifies itself to KeePass.
+	ClientID   string `json:",omitempty"`
+	ClientName string `json:",omitempty"`
+	ClientDesc string `json:",omitempty"`
+}
+
+// Apply overrides opts with whichever of the endpoint and client identity
+// the profile sets.
+func (p *Profile) Apply(opts *keepassrpc.Options) {
+	if p.URL != "" {
+		opts.URL = p.URL
+	}
+	if p.ClientID != "" {
+		opts.ClientID = p.ClientID
+	}
+	if p.ClientName != "" {
+		opts.ClientName = p.ClientName
+	}
+	if p.ClientDesc != "" {
+		opts.ClientDesc = p.ClientDesc
+	}
+}
+
+// settings is the content of settings.json. The default profile's fields sit
+// at the top level, where older versions expect them.
+type settings struct {
+	// Version is the schema version; see settingsVersion.
+	Version int
+
+	Profile
+
+	// DefaultProfile is the profile used when none is asked for, if not
+	// the top-level one.
+	DefaultProfile string `json:",omitempty"`
+
+	Profiles map[string]*Profile `json:",omitempty"`
+}
+
+// profile returns the profile called name, or the default one if name is
+// empty.
+func (s *settings) profile(name string) (string, *Profile, error) {
+	if name == "" {
+		name = s.DefaultProfile
+	}
+	if name == "" || name == DefaultProfileName {
+		return DefaultProfileName, &s.Profile, nil
+	}
+	p, ok := s.Profiles[name]
+	if !ok || p == nil {
+		return "", nil, fmt.Errorf("%w '%s'", ErrNoProfile, name)
+	}
+	return name, p, nil
+}
+
+// setProfile replaces the profile called name, adding it if need be.
+func (s *settings) setProfile(name string, p Profile) {
+	if name == "" || name == DefaultProfileName {
+		s.Profile = p
+		return
+	}
+	if s.Profiles == nil {
+		s.Profiles = map[string]*Profile{}
+	}
+	s.Profiles[name] = &p
+}
+
+// names lists the profiles defined, the top-level one first.
+func (s *settings) names() []string {
+	names := make([]string, 0, len(s.Profiles)+1)
+	for name := range s.Profiles {
+		if name != DefaultProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfileName}, names...)
+}
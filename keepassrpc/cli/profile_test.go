@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestProfiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "settings.json")
+	old := `{"Username":"alice","Profiles":{"team":{"URL":"ws://127.0.0.1:12547/","Username":"bob","ClientName":"kp (team)"}}}`
+	if err := os.WriteFile(file, []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadProfile(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ProfileName != DefaultProfileName || config.Username != "alice" {
+		t.Errorf("default profile = %s, %+v", config.ProfileName, config.Profile)
+	}
+	if names := config.ProfileNames(); !reflect.DeepEqual(names, []string{"default", "team"}) {
+		t.Errorf("ProfileNames() = %v", names)
+	}
+
+	config, err = loadProfile(file, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Username != "bob" {
+		t.Errorf("team profile = %+v", config.Profile)
+	}
+	opts := keepassrpc.Options{ClientID: "gkp", ClientName: "kp"}
+	config.Apply(&opts)
+	if opts.URL != "ws://127.0.0.1:12547/" || opts.ClientID != "gkp" || opts.ClientName != "kp (team)" {
+		t.Errorf("Apply() = %+v", opts)
+	}
+
+	// Saving one profile leaves the others alone.
+	config.Username = "carol"
+	if err := config.Save(); err != nil {
+		t.Fatal(err)
+	}
+	config, err = loadProfile(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Username != "alice" {
+		t.Errorf("default profile after saving team = %+v", config.Profile)
+	}
+	if config, err = loadProfile(file, "team"); err != nil || config.Username != "carol" {
+		t.Errorf("team profile after saving = %+v, %v", config, err)
+	}
+
+	if _, err := loadProfile(file, "personal"); !errors.Is(err, ErrNoProfile) {
+		t.Errorf("loading an unknown profile = %v, want ErrNoProfile", err)
+	}
+	if config, err := loadProfile(filepath.Join(t.TempDir(), "settings.json"), ""); err != nil || config.Username != "" {
+		t.Errorf("loading without settings.json = %+v, %v", config, err)
+	}
+}
@@ -5,15 +5,44 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"github.com/logic/gkp/keepassrpc/secret"
+	"golang.org/x/term"
 )
 
-// Prompt is a simple implementation of keepassrpc.Passworder.
+// Prompt is a simple implementation of keepassrpc.Passworder, which asks on
+// stdin and stdout. See AutoPrompt for alternatives.
 func Prompt() (string, error) {
 	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter the code provided by KeePass: ")
+	fmt.Print(pairingPrompt)
 	text, err := reader.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
 	return strings.TrimSpace(text), nil
 }
+
+// PassphrasePrompt is a Passphraser which asks on the controlling terminal,
+// so that it works even when stdin and stdout are in use, as they are for a
+// git credential helper.
+func PassphrasePrompt() (*secret.Value, error) {
+	return AskPassphrase("Passphrase for stored KeePass session keys: ")
+}
+
+// AskPassphrase asks for a passphrase on the controlling terminal, without
+// echoing it.
+func AskPassphrase(prompt string) (*secret.Value, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to ask for a passphrase on: %v", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, err
+	}
+	return secret.New(pass), nil
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/logic/gkp/keepassrpc/secret"
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters for newly sealed data, as RFC 9106 recommends where
+// memory is constrained.
+const (
+	sealTime    = 3
+	sealMemory  = 64 * 1024 // KiB
+	sealThreads = 4
+)
+
+// Bounds on the Argon2id parameters we'll unseal with, lest a damaged or
+// hostile blob make us panic or exhaust memory.
+const (
+	sealMaxTime   = 10
+	sealMaxMemory = 1 << 20 // KiB
+)
+
+// sealKDF describes how the key for sealed data is derived. It is
+// authenticated along with the ciphertext.
+type sealKDF struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// sealedData is data encrypted with AES-GCM under a key derived from a
+// passphrase with Argon2id, as kept by a FileStore or exported by
+// ExportPairing.
+type sealedData struct {
+	Version    int     `json:"version"`
+	KDF        sealKDF `json:"kdf"`
+	Nonce      []byte  `json:"nonce"`
+	Ciphertext []byte  `json:"ciphertext"`
+}
+
+// aead returns the cipher for data sealed with pass and the given key
+// derivation, along with the additional data to authenticate.
+func (kdf *sealKDF) aead(pass *secret.Value) (cipher.AEAD, []byte, error) {
+	if kdf.Name != "argon2id" {
+		return nil, nil, fmt.Errorf("unknown key derivation '%s'", kdf.Name)
+	}
+	if kdf.Time < 1 || kdf.Time > sealMaxTime || kdf.Threads < 1 ||
+		kdf.Memory < 8*uint32(kdf.Threads) || kdf.Memory > sealMaxMemory {
+		return nil, nil, errors.New("argon2id parameters out of range")
+	}
+	ad, err := json.Marshal(kdf)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := argon2.IDKey(pass.Bytes(), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, 32)
+	defer clear(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, ad, err
+}
+
+// seal encrypts plaintext with pass, under a fresh salt and nonce.
+func seal(pass *secret.Value, plaintext []byte) (*sealedData, error) {
+	data := &sealedData{
+		Version: 1,
+		KDF: sealKDF{
+			Name:    "argon2id",
+			Salt:    make([]byte, 16),
+			Time:    sealTime,
+			Memory:  sealMemory,
+			Threads: sealThreads,
+		},
+	}
+	if _, err := io.ReadFull(rand.Reader, data.KDF.Salt); err != nil {
+		return nil, err
+	}
+	aead, ad, err := data.KDF.aead(pass)
+	if err != nil {
+		return nil, err
+	}
+	data.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, data.Nonce); err != nil {
+		return nil, err
+	}
+	data.Ciphertext = aead.Seal(nil, data.Nonce, plaintext, ad)
+	return data, nil
+}
+
+// unseal decrypts data with pass. The caller should clear the plaintext
+// when done with it.
+func unseal(pass *secret.Value, data *sealedData) ([]byte, error) {
+	if data.Version != 1 {
+		return nil, fmt.Errorf("unknown version %d", data.Version)
+	}
+	aead, ad, err := data.KDF.aead(pass)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.Nonce) != aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	plaintext, err := aead.Open(nil, data.Nonce, data.Ciphertext, ad)
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/logic/gkp/internal/atomicfile"
+)
+
+// settingsVersion is the schema version of the settings.json we write.
+// Files from before versioning have no version, which reads as zero.
+const settingsVersion = 1
+
+// ErrBadSettings is returned when settings.json can't be read, rather than
+// carrying on as though it were empty, which would mean pairing afresh.
+var ErrBadSettings = errors.New("cli: settings.json is damaged")
+
+// migrations[i] upgrades settings from version i to version i+1. They work
+// on the raw JSON, so that they needn't know every past layout of settings.
+var migrations = []func(map[string]json.RawMessage) error{
+	// 0 to 1: unversioned files, perhaps with profiles, need only the
+	// version number added.
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+// parseSettings decodes the content of settings.json, upgrading it to the
+// current version.
+func parseSettings(raw []byte) (*settings, error) {
+	var fields map[string]json.RawMessage
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("file holds null")
+	}
+
+	version := 0
+	if v, ok := fields["Version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("bad version: %v", err)
+		}
+	}
+	switch {
+	case version > settingsVersion:
+		return nil, fmt.Errorf("version %d is newer than the %d we understand; upgrade, or use a separate ConfigID",
+			version, settingsVersion)
+	case version < 0:
+		return nil, fmt.Errorf("bad version %d", version)
+	}
+	for ; version < settingsVersion; version++ {
+		if err := migrations[version](fields); err != nil {
+			return nil, fmt.Errorf("upgrading from version %d: %v", version, err)
+		}
+	}
+	fields["Version"] = json.RawMessage(fmt.Sprint(settingsVersion))
+
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var s settings
+	if err := json.Unmarshal(upgraded, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// readSettings reads settings.json from file, which needn't exist yet.
+func readSettings(file string) (*settings, error) {
+	raw, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &settings{Version: settingsVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseSettings(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v; fix or remove it (and pair again)", ErrBadSettings, file, err)
+	}
+	return s, nil
+}
+
+// updateSettings applies fn to the settings in file and writes them back,
+// holding a lock so that concurrent updates, say from git running several
+// credential helpers at once, don't lose each other's changes.
+func updateSettings(file string, fn func(*settings)) error {
+	unlock, err := lockFile(file + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s, err := readSettings(file)
+	if err != nil {
+		return err
+	}
+	fn(s)
+	s.Version = settingsVersion
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(file, append(raw, '\n'))
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSettingsMigration(t *testing.T) {
+	s, err := parseSettings([]byte(`{"Username":"alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != settingsVersion || s.Username != "alice" {
+		t.Errorf("unversioned settings read as %+v", s)
+	}
+
+	if _, err := parseSettings([]byte(fmt.Sprintf(`{"Version":%d}`, settingsVersion+1))); err == nil ||
+		!strings.Contains(err.Error(), "newer") {
+		t.Errorf("newer settings = %v", err)
+	}
+}
+
+func TestSettingsDamaged(t *testing.T) {
+	for _, content := range []string{"", "  \n", `{"Username":"ali`, "null", `{"Username":5}`, `{"Version":"one"}`} {
+		file := filepath.Join(t.TempDir(), "settings.json")
+		if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProfile(file, ""); !errors.Is(err, ErrBadSettings) {
+			t.Errorf("loading %q = %v, want ErrBadSettings", content, err)
+		}
+		config := &Configuration{file: file, ProfileName: DefaultProfileName}
+		if err := config.Save(); !errors.Is(err, ErrBadSettings) {
+			t.Errorf("saving over %q = %v, want ErrBadSettings", content, err)
+		}
+	}
+}
+
+func TestSettingsConcurrentSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "settings.json")
+	names := []string{"default", "alice", "bob", "carol", "dave", "erin", "frank", "grace"}
+	profiles := map[string]*Profile{}
+	for _, name := range names[1:] {
+		profiles[name] = &Profile{}
+	}
+	if err := updateSettings(file, func(s *settings) { s.Profiles = profiles }); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		config, err := loadProfile(file, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config.Username = "user-" + name
+			if err := config.Save(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range names {
+		config, err := loadProfile(file, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Username != "user-"+name {
+			t.Errorf("profile %s has username %q; a concurrent save was lost", name, config.Username)
+		}
+	}
+	if matches, _ := filepath.Glob(file + ".*[0-9]"); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+}
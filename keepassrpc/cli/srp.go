@@ -1,31 +1,58 @@
 package cli
 
 import (
-	"math/big"
+	"context"
+	"crypto/subtle"
 
 	"github.com/logic/gkp/keepassrpc"
 	"github.com/satori/go.uuid"
 )
 
 // Dial connects to the KeePassRPC service, given a valid configuration.
-func Dial(config *Configuration, prompt keepassrpc.Passworder) (client *keepassrpc.Client, err error) {
-	var value *big.Int
+func Dial(config *Configuration, prompt keepassrpc.Passworder) (*keepassrpc.Client, error) {
+	return DialContext(context.Background(), config, prompt)
+}
 
-	if config.Username == "" {
-		if value, err = keepassrpc.GenKey(32); err != nil {
-			return nil, err
-		}
+// DialContext is like Dial, but gives up if ctx is done before the session
+// has been established.
+func DialContext(ctx context.Context, config *Configuration, prompt keepassrpc.Passworder) (*keepassrpc.Client, error) {
+	return DialWithOptions(ctx, config, nil, prompt)
+}
+
+// DialWithOptions is like DialContext, but connects as described by opts.
+// With a nil prompt it never pairs, only checking our session key, as
+// keepassrpc.Dial describes.
+func DialWithOptions(ctx context.Context, config *Configuration, opts *keepassrpc.Options, prompt keepassrpc.Passworder) (client *keepassrpc.Client, err error) {
+	newUser := config.Username == ""
+	if newUser {
 		config.Username = uuid.NewV4().String()
+	} else if err = config.loadSessionKey(); err != nil {
+		return nil, err
 	}
 
-	client, err = keepassrpc.NewClient(config.Username, value, config.sessionKey, prompt)
+	key := config.bigSessionKey()
+	client, err = keepassrpc.Dial(ctx, opts, config.Username, key, prompt)
+	if key != nil {
+		// The client takes its own copy.
+		wipeInt(key)
+	}
 	if err != nil {
 		return nil, err
 	}
-	config.sessionKey = client.SessionKey
+	old := config.sessionKey
+	config.sessionKey = nil
+	config.loaded = true
+	// The client wipes its key when closed, so keep a copy of our own.
+	config.setSessionKey(client.SessionKey)
+	changed := old == nil || config.sessionKey == nil ||
+		subtle.ConstantTimeCompare(old.Bytes(), config.sessionKey.Bytes()) != 1
+	old.Destroy()
 
-	if err = config.Save(); err != nil {
-		return nil, err
+	if newUser || changed {
+		if err = config.Save(); err != nil {
+			client.Close()
+			return nil, err
+		}
 	}
 
 	return client, nil
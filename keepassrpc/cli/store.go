@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kirsle/configdir"
+	"github.com/logic/gkp/keepassrpc/secret"
+	"github.com/tmc/keyring"
+)
+
+// SecretStore keeps session keys, by username, between runs. Keys are the
+// 32 bytes of the AES key negotiated with KeePassRPC.
+type SecretStore interface {
+	// Get returns the key stored for username, which the caller must
+	// Destroy, or ErrNoSecret if there isn't one.
+	Get(username string) (*secret.Value, error)
+
+	// Set stores key for username, replacing any key already stored.
+	Set(username string, key *secret.Value) error
+
+	// Delete forgets the key stored for username, if any.
+	Delete(username string) error
+}
+
+// ErrNoSecret is returned by a SecretStore which has no key for a user.
+var ErrNoSecret = errors.New("cli: no session key stored")
+
+// ErrReadOnly is returned by a SecretStore which can't store new keys.
+var ErrReadOnly = errors.New("cli: secret store is read-only")
+
+// Names of the secret stores, for the SecretStore setting and OpenStore.
+const (
+	StoreKeyring = "keyring"
+	StoreFile    = "file"
+	StoreEnv     = "env"
+	StoreMemory  = "memory"
+)
+
+// OpenStore returns the secret store with the given name, as configured by
+// config. An empty name means StoreKeyring.
+func OpenStore(name string, config *Configuration) (SecretStore, error) {
+	switch name {
+	case "", StoreKeyring:
+		return &KeyringStore{Service: ConfigID}, nil
+	case StoreFile:
+		path := config.SecretFile
+		if path == "" {
+			path = filepath.Join(configdir.LocalConfig(ConfigID), "secrets.json")
+		}
+		return NewFileStore(path, EnvPassphrase(envName("PASSPHRASE"), PassphrasePrompt)), nil
+	case StoreEnv:
+		return NewEnvStore(envName("SESSION_KEY")), nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown secret store '%s'", name)
+}
+
+// envName returns the name of one of our environment variables, such as
+// GKP_SESSION_KEY.
+func envName(suffix string) string {
+	return strings.ToUpper(ConfigID) + "_" + suffix
+}
+
+// keyFromText decodes a key in the hex form the keyring has always held.
+func keyFromText(text string) (*secret.Value, error) {
+	k, ok := new(big.Int).SetString(strings.TrimSpace(text), 16)
+	if !ok || k.Sign() < 0 || k.BitLen() > 8*sessionKeyBytes {
+		return nil, fmt.Errorf("stored session key is malformed")
+	}
+	defer wipeInt(k)
+	return secret.New(k.FillBytes(make([]byte, sessionKeyBytes))), nil
+}
+
+// keyToText encodes a key as keyFromText expects.
+func keyToText(key *secret.Value) string {
+	k := new(big.Int).SetBytes(key.Bytes())
+	defer wipeInt(k)
+	return k.Text(16)
+}
+
+// KeyringStore keeps keys in the platform keyring: the keychain on macOS,
+// and the Secret Service or GNOME Keyring on Linux.
+type KeyringStore struct {
+	Service string
+}
+
+// Get implements SecretStore.
+func (s *KeyringStore) Get(username string) (*secret.Value, error) {
+	text, err := keyring.Get(s.Service, username)
+	if err == keyring.ErrNotFound || (err == nil && text == "") {
+		return nil, ErrNoSecret
+	}
+	if err != nil {
+		return nil, err
+	}
+	return keyFromText(text)
+}
+
+// Set implements SecretStore.
+func (s *KeyringStore) Set(username string, key *secret.Value) error {
+	return keyring.Set(s.Service, username, keyToText(key))
+}
+
+// Delete implements SecretStore. The keyring can't remove entries, so the
+// key is overwritten with an empty one instead.
+func (s *KeyringStore) Delete(username string) error {
+	return keyring.Set(s.Service, username, "")
+}
+
+// EnvStore reads a single key, whatever the username, from an environment
+// variable, for use in CI. The variable holds the key in hex, as the keyring
+// does; alternatively, the same variable with the suffix _FD names a file
+// descriptor to read it from, which keeps it out of the environment. It
+// can't store keys, so pairing must be done elsewhere.
+type EnvStore struct {
+	Var string
+
+	once sync.Once
+	key  *secret.Value
+	err  error
+}
+
+// NewEnvStore returns an EnvStore which reads the variable name, or
+// name_FD.
+func NewEnvStore(name string) *EnvStore {
+	return &EnvStore{Var: name}
+}
+
+// read fetches the key, once; a file descriptor can only be read once.
+func (s *EnvStore) read() (*secret.Value, error) {
+	s.once.Do(func() {
+		var text []byte
+		if v, ok := os.LookupEnv(s.Var); ok {
+			text = []byte(v)
+		} else if v, ok := os.LookupEnv(s.Var + "_FD"); ok {
+			fd, err := strconv.Atoi(v)
+			if err != nil {
+				s.err = fmt.Errorf("%s_FD: %v", s.Var, err)
+				return
+			}
+			f := os.NewFile(uintptr(fd), s.Var+"_FD")
+			defer f.Close()
+			if text, s.err = io.ReadAll(f); s.err != nil {
+				return
+			}
+		} else {
+			s.err = ErrNoSecret
+			return
+		}
+		defer clear(text)
+		s.key, s.err = keyFromText(string(text))
+	})
+	return s.key, s.err
+}
+
+// Get implements SecretStore.
+func (s *EnvStore) Get(username string) (*secret.Value, error) {
+	key, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return secret.New(bytes.Clone(key.Bytes())), nil
+}
+
+// Set implements SecretStore. It only succeeds if key is the one we already
+// have.
+func (s *EnvStore) Set(username string, key *secret.Value) error {
+	if have, err := s.read(); err == nil && bytes.Equal(have.Bytes(), key.Bytes()) {
+		return nil
+	}
+	return fmt.Errorf("%w: set %s to store a new session key", ErrReadOnly, s.Var)
+}
+
+// Delete implements SecretStore.
+func (s *EnvStore) Delete(username string) error {
+	return fmt.Errorf("%w: unset %s to forget the session key", ErrReadOnly, s.Var)
+}
+
+// MemoryStore keeps keys in memory, for tests.
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]*secret.Value
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: map[string]*secret.Value{}}
+}
+
+// Get implements SecretStore.
+func (s *MemoryStore) Get(username string) (*secret.Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[username]
+	if !ok {
+		return nil, ErrNoSecret
+	}
+	return secret.New(bytes.Clone(key.Bytes())), nil
+}
+
+// Set implements SecretStore.
+func (s *MemoryStore) Set(username string, key *secret.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[username].Destroy()
+	s.keys[username] = secret.New(bytes.Clone(key.Bytes()))
+	return nil
+}
+
+// Delete implements SecretStore.
+func (s *MemoryStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[username].Destroy()
+	delete(s.keys, username)
+	return nil
+}
@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/logic/gkp/internal/atomicfile"
+	"github.com/logic/gkp/keepassrpc/secret"
+)
+
+// ErrBadPassphrase is returned when sealed data, such as a FileStore's file,
+// can't be decrypted.
+var ErrBadPassphrase = errors.New("cli: wrong passphrase, or sealed data damaged")
+
+// Passphraser returns the passphrase protecting a FileStore.
+type Passphraser func() (*secret.Value, error)
+
+// EnvPassphrase returns a Passphraser which reads the environment variable
+// name, or asks fallback if it isn't set.
+func EnvPassphrase(name string, fallback Passphraser) Passphraser {
+	return func() (*secret.Value, error) {
+		if v, ok := os.LookupEnv(name); ok {
+			return secret.FromString(v), nil
+		}
+		if fallback == nil {
+			return nil, fmt.Errorf("%s is not set", name)
+		}
+		return fallback()
+	}
+}
+
+// FileStore keeps keys in a file, encrypted with AES-GCM under a key derived
+// from a passphrase with Argon2id. It suits machines without a keyring. The
+// passphrase is asked for once, and kept until Destroy. Changes are made
+// under a lock on the file, so concurrent ones aren't lost.
+type FileStore struct {
+	Path       string
+	Passphrase Passphraser
+
+	mu   sync.Mutex
+	pass *secret.Value
+}
+
+// NewFileStore returns a FileStore keeping keys in path.
+func NewFileStore(path string, passphrase Passphraser) *FileStore {
+	return &FileStore{Path: path, Passphrase: passphrase}
+}
+
+// Get implements SecretStore.
+func (s *FileStore) Get(username string) (*secret.Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	defer destroyKeys(keys)
+	key, ok := keys[username]
+	if !ok {
+		return nil, ErrNoSecret
+	}
+	delete(keys, username)
+	return key, nil
+}
+
+// Set implements SecretStore.
+func (s *FileStore) Set(username string, key *secret.Value) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	defer destroyKeys(keys)
+	keys[username].Destroy()
+	keys[username] = secret.New(append([]byte(nil), key.Bytes()...))
+	return s.save(keys)
+}
+
+// Delete implements SecretStore.
+func (s *FileStore) Delete(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	defer destroyKeys(keys)
+	if _, ok := keys[username]; !ok {
+		return nil
+	}
+	keys[username].Destroy()
+	delete(keys, username)
+	return s.save(keys)
+}
+
+// Destroy forgets the passphrase.
+func (s *FileStore) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pass.Destroy()
+	s.pass = nil
+}
+
+func destroyKeys(keys map[string]*secret.Value) {
+	for _, k := range keys {
+		k.Destroy()
+	}
+}
+
+func (s *FileStore) passphrase() (*secret.Value, error) {
+	if s.pass == nil {
+		if s.Passphrase == nil {
+			return nil, fmt.Errorf("no passphrase for %s", s.Path)
+		}
+		pass, err := s.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		s.pass = pass
+	}
+	return s.pass, nil
+}
+
+// load decrypts the keys in the file, which needn't exist yet.
+func (s *FileStore) load() (map[string]*secret.Value, error) {
+	keys := map[string]*secret.Value{}
+	raw, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data sealedData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	pass, err := s.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := unseal(pass, &data)
+	if err == ErrBadPassphrase {
+		// Ask again next time.
+		s.pass.Destroy()
+		s.pass = nil
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	defer clear(plaintext)
+
+	var stored map[string][]byte
+	if err := json.Unmarshal(plaintext, &stored); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.Path, err)
+	}
+	for username, key := range stored {
+		keys[username] = secret.New(key)
+	}
+	return keys, nil
+}
+
+// save encrypts keys into the file, replacing it atomically.
+func (s *FileStore) save(keys map[string]*secret.Value) error {
+	pass, err := s.passphrase()
+	if err != nil {
+		return err
+	}
+	stored := map[string][]byte{}
+	for username, key := range keys {
+		stored[username] = key.Bytes()
+	}
+	plaintext, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	data, err := seal(pass, plaintext)
+	clear(plaintext)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.Path, raw)
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc/secret"
+)
+
+// testKey is a session key whose first byte is zero, to check that keys
+// keep their length through the hex the keyring holds.
+var testKey = append([]byte{0}, bytes.Repeat([]byte{0xa5}, sessionKeyBytes-1)...)
+
+func checkStore(t *testing.T, s SecretStore) {
+	t.Helper()
+	if _, err := s.Get("alice"); err != ErrNoSecret {
+		t.Fatalf("Get() from an empty store = %v, want ErrNoSecret", err)
+	}
+	if err := s.Set("alice", secret.New(bytes.Clone(testKey))); err != nil {
+		t.Fatal(err)
+	}
+	key, err := s.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Bytes(), testKey) {
+		t.Errorf("Get() = %x, want %x", key.Bytes(), testKey)
+	}
+	key.Destroy()
+	if _, err := s.Get("bob"); err != ErrNoSecret {
+		t.Errorf("Get() for another user = %v, want ErrNoSecret", err)
+	}
+	if err := s.Delete("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("alice"); err != ErrNoSecret {
+		t.Errorf("Get() after Delete() = %v, want ErrNoSecret", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	checkStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	asks := 0
+	pass := func(p string) Passphraser {
+		return func() (*secret.Value, error) {
+			asks++
+			return secret.FromString(p), nil
+		}
+	}
+
+	s := NewFileStore(path, pass("correct horse"))
+	checkStore(t, s)
+	if asks != 1 {
+		t.Errorf("passphrase asked for %d times, want once", asks)
+	}
+	if err := s.Set("alice", secret.New(bytes.Clone(testKey))); err != nil {
+		t.Fatal(err)
+	}
+
+	s = NewFileStore(path, pass("battery staple"))
+	if _, err := s.Get("alice"); err != ErrBadPassphrase {
+		t.Errorf("Get() with the wrong passphrase = %v, want ErrBadPassphrase", err)
+	}
+	s.Passphrase = pass("correct horse")
+	key, err := s.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	if !bytes.Equal(key.Bytes(), testKey) {
+		t.Errorf("Get() = %x, want %x", key.Bytes(), testKey)
+	}
+}
+
+func TestEnvStore(t *testing.T) {
+	t.Setenv("GKP_TEST_KEY", keyToText(secret.New(bytes.Clone(testKey))))
+	s := NewEnvStore("GKP_TEST_KEY")
+	key, err := s.Get("anyone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	if !bytes.Equal(key.Bytes(), testKey) {
+		t.Errorf("Get() = %x, want %x", key.Bytes(), testKey)
+	}
+	if err := s.Set("anyone", key); err != nil {
+		t.Errorf("Set() of the same key = %v", err)
+	}
+	if err := s.Set("anyone", secret.FromString("something else")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Set() of a new key = %v, want ErrReadOnly", err)
+	}
+
+	if _, err := NewEnvStore("GKP_TEST_UNSET").Get("anyone"); err != ErrNoSecret {
+		t.Errorf("Get() with nothing set = %v, want ErrNoSecret", err)
+	}
+}
+
+func TestFileStoreConcurrentSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	pass := func() (*secret.Value, error) { return secret.FromString("correct horse"), nil }
+	names := []string{"alice", "bob", "carol", "dave"}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		s := NewFileStore(path, pass)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Set(name, secret.New(bytes.Clone(testKey))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s := NewFileStore(path, pass)
+	for _, name := range names {
+		key, err := s.Get(name)
+		if err != nil {
+			t.Errorf("Get(%q) = %v; a concurrent Set was lost", name, err)
+			continue
+		}
+		key.Destroy()
+	}
+}
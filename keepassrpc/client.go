@@ -1,14 +1,24 @@
 package keepassrpc
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// DebugClient controls whether protocol debugging will be logged
+// DebugClient controls whether protocol debugging will be logged, for
+// clients without Options.Logger.
+//
+// Deprecated: Set Options.Logger, with a level of LevelTransport.
 var DebugClient = false
 
 // DefaultURL is the canonical local location of the KeePassRPC service
@@ -23,6 +33,63 @@ const ClientName = "gkp-KeePassRPC"
 // ClientDesc is a longer human-readable client description
 const ClientDesc = "A Go KeePassRPC implementation"
 
+// Options controls how a Client reaches the KeePassRPC service and how it
+// introduces itself there. The zero value reproduces NewClient's behavior.
+type Options struct {
+	// URL is the websocket endpoint to dial; defaults to DefaultURL.
+	URL string
+
+	// Dialer is used to open the websocket; defaults to
+	// websocket.DefaultDialer. It is copied, never modified.
+	Dialer *websocket.Dialer
+
+	// HandshakeTimeout, if non-zero, overrides the dialer's websocket
+	// handshake timeout.
+	HandshakeTimeout time.Duration
+
+	// TLSClientConfig, if set, overrides the dialer's TLS configuration
+	// for wss:// endpoints.
+	TLSClientConfig *tls.Config
+
+	// Header holds extra headers (such as Origin) for the websocket
+	// upgrade request.
+	Header http.Header
+
+	// ClientID, ClientName and ClientDesc are how KeePass will identify
+	// us to the user; they default to the package-level constants.
+	ClientID   string
+	ClientName string
+	ClientDesc string
+
+	// Logger, if set, receives the client's logs, such as of failed
+	// reconnection attempts; protocol detail is logged at LevelHandshake,
+	// LevelTransport and LevelRPC. Passwords, keys and other secrets are
+	// redacted. If nil, nothing is logged, unless DebugClient or
+	// DebugJSONRPC is set.
+	Logger *slog.Logger
+
+	// Reconnect, if set, makes the client re-dial and re-authenticate
+	// when the connection breaks, such as when KeePass is restarted.
+	// Calls which only read are then retried transparently; others
+	// fail with ErrConnectionLost.
+	Reconnect *ReconnectPolicy
+}
+
+// dialer returns the websocket dialer described by the options.
+func (o *Options) dialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	if o.Dialer != nil {
+		d = *o.Dialer
+	}
+	if o.HandshakeTimeout != 0 {
+		d.HandshakeTimeout = o.HandshakeTimeout
+	}
+	if o.TLSClientConfig != nil {
+		d.TLSClientConfig = o.TLSClientConfig
+	}
+	return &d
+}
+
 // Passworder is expected to return either a string password (the nonce provided
 // by KeePass) or an error
 type Passworder func() (string, error)
@@ -31,41 +98,152 @@ type Passworder func() (string, error)
 type Client struct {
 	Username   string
 	SessionKey *big.Int
-	Value      *big.Int
 	Password   Passworder
 
+	// Deprecated: Value is ignored. A fresh private value is generated
+	// for each SRP negotiation, as RFC 5054 requires.
+	Value *big.Int
+
 	WS *websocket.Conn
 
+	opts Options
+	log  *slog.Logger
+
 	SRPCtx     *SRPContext
 	KeyCtx     *KeyContext
 	JSONRPCCtx *JSONRPCContext
+
+	connMu     sync.Mutex // guards WS and JSONRPCCtx once established
+	generation int        // counts reconnections
+	closed     atomic.Bool
+	quit       chan struct{} // closed by Close; see closing
+	quitOnce   sync.Once
+
+	notifier notifier
+	server   serverInfo
 }
 
-// NewClient instantiates a new KeePassRPC client for the given user
+// NewClient instantiates a new KeePassRPC client for the given user. The value
+// argument is ignored, as is Client.Value.
+//
+// Deprecated: Use Dial, which has no value argument.
 func NewClient(username string, value, sessionKey *big.Int, pwd Passworder) (*Client, error) {
-	wsc, _, err := websocket.DefaultDialer.Dial(DefaultURL, nil)
-	if err != nil {
-		return nil, err
-	}
+	return Dial(context.Background(), nil, username, sessionKey, pwd)
+}
 
+// Dial connects to KeePassRPC as described by opts, and authenticates as
+// username with sessionKey, or by pairing with a code from pwd if there's no
+// session key or it's rejected. It aborts if ctx is cancelled or expires
+// first. A nil opts is equivalent to the zero Options.
+//
+// With a nil pwd, Dial only tries the session key, and never begins pairing:
+// if there's no key, or the server rejects it, the error wraps both
+// ErrKeyRejected and ErrAuthRequired. This makes it a passive check of
+// whether we're still paired.
+func Dial(ctx context.Context, opts *Options, username string, sessionKey *big.Int, pwd Passworder) (*Client, error) {
 	c := &Client{
-		Username:   username,
-		SessionKey: sessionKey,
-		Value:      value,
-		Password:   pwd,
-		WS:         wsc,
+		Username: username,
+		Password: pwd,
+	}
+	if sessionKey != nil {
+		// Ours to wipe on Close.
+		c.SessionKey = new(big.Int).Set(sessionKey)
+	}
+	if opts != nil {
+		c.opts = *opts
+	}
+	c.log = c.opts.Logger
+	if c.log == nil {
+		c.log = defaultLogger()
 	}
 
-	if err := c.EstablishSession(); err != nil {
+	wsc, _, err := c.opts.dialer().DialContext(ctx, c.url(), c.opts.Header)
+	if err != nil {
+		return nil, err
+	}
+	c.WS = wsc
+
+	if err := c.EstablishSessionContext(ctx); err != nil {
+		wsc.Close()
 		return nil, err
 	}
 
 	return c, nil
 }
 
+// closing returns a channel which is closed once Close is called.
+func (c *Client) closing() chan struct{} {
+	c.quitOnce.Do(func() { c.quit = make(chan struct{}) })
+	return c.quit
+}
+
+// logger returns where the client logs to.
+func (c *Client) logger() *slog.Logger {
+	if c.log == nil {
+		return defaultLogger()
+	}
+	return c.log
+}
+
+// url returns the websocket endpoint to dial.
+func (c *Client) url() string {
+	if c.opts.URL == "" {
+		return DefaultURL
+	}
+	return c.opts.URL
+}
+
+// watchContext applies the deadline of ctx to the websocket, and arranges for
+// any pending websocket read or write to be interrupted if ctx is done. The
+// returned function must be called to release the websocket from ctx; it
+// reports false if ctx finished first, in which case the websocket is no
+// longer usable.
+func watchContext(ctx context.Context, ws *websocket.Conn) func() bool {
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetReadDeadline(deadline)
+		ws.SetWriteDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// A deadline in the past forces blocked calls to return.
+		ws.SetReadDeadline(time.Unix(1, 0))
+		ws.SetWriteDeadline(time.Unix(1, 0))
+	})
+	return func() bool {
+		if !stop() {
+			return false
+		}
+		ws.SetReadDeadline(time.Time{})
+		ws.SetWriteDeadline(time.Time{})
+		return true
+	}
+}
+
+// setupMessage returns the skeleton of a setup protocol message which
+// introduces this client to the server.
+func (c *Client) setupMessage() *Message {
+	msg := &Message{
+		Protocol:   "setup",
+		Version:    ProtocolVersion(),
+		ClientID:   c.opts.ClientID,
+		ClientName: c.opts.ClientName,
+		ClientDesc: c.opts.ClientDesc,
+		Features:   ClientFeatures,
+	}
+	if msg.ClientID == "" {
+		msg.ClientID = ClientID
+	}
+	if msg.ClientName == "" {
+		msg.ClientName = ClientName
+	}
+	if msg.ClientDesc == "" {
+		msg.ClientDesc = ClientDesc
+	}
+	return msg
+}
+
 // DispatchResponse is the general server response handler
 func (c *Client) DispatchResponse() error {
-	msg, err := ReadMessage(c.WS)
+	msg, err := readMessage(c.logger(), c.WS)
 	if err != nil {
 		return err
 	}
@@ -77,6 +255,9 @@ func (c *Client) DispatchResponse() error {
 
 	switch msg.Protocol {
 	case "setup":
+		if err := c.recordServer(msg); err != nil {
+			return err
+		}
 		if msg.SRP != nil && msg.Key == nil {
 			return DispatchSRP(c, msg.SRP)
 		}
@@ -95,14 +276,52 @@ func (c *Client) DispatchResponse() error {
 // EstablishSession starts a new KeePassRPC session, either via a new SRP
 // negotiation, or via challenge/response with an established key.
 func (c *Client) EstablishSession() error {
+	return c.EstablishSessionContext(context.Background())
+}
+
+// EstablishSessionContext is like EstablishSession, but aborts the handshake
+// if ctx is cancelled or expires before the session is established. The
+// websocket should be considered unusable after an aborted handshake.
+//
+// Without a Password to ask for a pairing code, only the session key is
+// tried, as pairing couldn't succeed.
+func (c *Client) EstablishSessionContext(ctx context.Context) error {
+	if c.Password == nil {
+		err := c.establishSessionContext(ctx, false)
+		if errors.Is(err, ErrKeyRejected) {
+			err = fmt.Errorf("%w: %w", ErrAuthRequired, err)
+		}
+		return err
+	}
+	return c.establishSessionContext(ctx, true)
+}
+
+// establishSessionContext is EstablishSessionContext, but only pairs if
+// pair is set; otherwise a missing or rejected session key is an error.
+func (c *Client) establishSessionContext(ctx context.Context, pair bool) error {
+	stop := watchContext(ctx, c.WS)
+	err := c.establishSession(ctx, pair)
+	if !stop() {
+		return ctx.Err()
+	}
+	return err
+}
+
+func (c *Client) establishSession(ctx context.Context, pair bool) error {
+	log := c.logger()
 	if c.SessionKey != nil {
+		log.Log(ctx, LevelHandshake, "Authenticating with stored session key", "username", c.Username)
 		if err := EstablishKeySession(c); err != nil {
-			// Treat an initial failure as temporary; the key might
-			// have simply expired or been revoked, so we need to
-			// go through a new SRP phase.
-			if DebugClient {
-				log.Println("Couldn't establish session with existing key:", err)
+			// Only a rejected key calls for pairing again; anything
+			// else, like an aborted handshake, says nothing about
+			// the key.
+			if ctx.Err() != nil || !errors.Is(err, ErrKeyRejected) || !pair {
+				return err
 			}
+			// The key might have simply expired or been revoked, so
+			// we need to go through a new SRP phase.
+			log.Log(ctx, LevelHandshake, "Session key rejected, pairing again", "error", err)
+			wipe(c.SessionKey)
 			c.SessionKey = nil
 		}
 	}
@@ -110,22 +329,38 @@ func (c *Client) EstablishSession() error {
 	// If we don't have a valid session key (or it was just rejected), try
 	// a fresh SRP session to negotiate a new session key.
 	if c.SessionKey == nil {
+		if !pair {
+			return fmt.Errorf("%w: no session key", ErrKeyRejected)
+		}
+		log.Log(ctx, LevelHandshake, "Pairing with SRP", "username", c.Username)
 		if err := EstablishSRPSession(c); err != nil {
 			return err
 		}
 	}
+	log.Log(ctx, LevelHandshake, "Session established", "username", c.Username)
 
 	// Post-authentication, establish our JSON-RPC session.
 	EstablishJSONRPCSession(c)
 	return nil
 }
 
-// Close closes the client's underlying websocket, if it exists
+// Close shuts down the client's JSON-RPC session and its underlying
+// websocket, if they exist. Calls still in progress fail with ErrClosed, and
+// the client won't reconnect. The session key is wiped from memory, so copy
+// SessionKey first if it is still needed.
 func (c *Client) Close() {
-	if c.WS != nil {
+	if c.closed.CompareAndSwap(false, true) {
+		close(c.closing())
+	}
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.JSONRPCCtx != nil {
+		c.JSONRPCCtx.r.Close()
+	} else if c.WS != nil {
 		c.WS.WriteMessage(websocket.CloseMessage,
 			websocket.FormatCloseMessage(
 				websocket.CloseNormalClosure, "goodbye"))
 		c.WS.Close()
 	}
+	wipe(c.SessionKey)
 }
@@ -0,0 +1,103 @@
+package keepassrpc_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestShortKey(t *testing.T) {
+	srv := newServer(t)
+
+	// A damaged stored key is never offered to the server; we pair again.
+	short := big.NewInt(12345)
+	c, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "amy", short,
+		func() (string, error) { return srv.PairingCode, nil })
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+	if c.SessionKey.Cmp(short) == 0 {
+		t.Error("client kept the short key")
+	}
+	if short.Int64() != 12345 {
+		t.Error("client wiped the caller's copy of the key")
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLoggingRedacts(t *testing.T) {
+	srv := newServer(t)
+	srv.AddEntry("", keepassrpc.Entry{
+		Title: "deploy-bot",
+		URLs:  []string{"https://github.com/login"},
+		FormFieldList: []keepassrpc.FormField{
+			{Name: "login", Type: keepassrpc.FFTusername, Value: "deploy-bot"},
+			{Name: "pass", Type: keepassrpc.FFTpassword, Value: "hunter2"},
+		},
+	})
+
+	var out syncBuffer
+	opts := &keepassrpc.Options{
+		URL: srv.URL,
+		Logger: slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{
+			Level: keepassrpc.LevelRPC,
+		})),
+	}
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(), opts, "aaron", nil, pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	// Again with the stored key, for the challenge-response handshake.
+	c, err = keepassrpc.Dial(context.Background(), opts, "aaron", srv.SessionKey("aaron"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := c.NewSearch()
+	s.AddURL("https://github.com/login")
+	entries, err := s.Execute()
+	if err != nil || len(entries) != 1 || entries[0].Password() != "hunter2" {
+		t.Fatalf("search returned %+v, %v", entries, err)
+	}
+	c.Close()
+
+	logged := out.String()
+	for _, want := range []string{"Pairing with SRP", "Authenticating with stored session key",
+		"level=DEBUG-2", "FindLogins", "deploy-bot", "[REDACTED]"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log lacks %q", want)
+		}
+	}
+	for _, secret := range []string{"hunter2", srv.SessionKey("aaron").Text(16)} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("log reveals %q:\n%s", secret, logged)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package keepassrpc
+
+import (
+	"context"
+	"sort"
+
+	"github.com/logic/gkp/keepassrpc/secret"
+)
+
+/*
+
+The DTO-based API is what current KeePassRPC releases offer clients which
+advertise FeatureDTOV2 (as the Kee browser extension does). Entries carry
+notes, tags and matching configuration that the older Entry can't represent.
+
+Reads fall back to the older methods when the server doesn't offer the newer
+ones, so Entry2 can be used throughout; writes require the newer API, rather
+than silently dropping what the older one can't store.
+
+*/
+
+// MatcherType selects what an EntryMatcherConfig controls
+type MatcherType string
+
+const (
+	// MatcherURL matches the entry against a page by its URLs
+	MatcherURL MatcherType = "Url"
+
+	// MatcherHide hides the entry from matching altogether
+	MatcherHide MatcherType = "Hide"
+)
+
+// URLMatchMethod is how closely a page URL must match an entry's URLs
+type URLMatchMethod string
+
+const (
+	// URLMatchExact requires the whole URL to match
+	URLMatchExact URLMatchMethod = "Exact"
+
+	// URLMatchHostname requires the hostname to match
+	URLMatchHostname URLMatchMethod = "Hostname"
+
+	// URLMatchDomain requires the registrable domain to match
+	URLMatchDomain URLMatchMethod = "Domain"
+)
+
+// EntryMatcherConfig is one of an entry's rules for matching web pages
+type EntryMatcherConfig struct {
+	MatcherType    MatcherType    `json:"matcherType"`
+	URLMatchMethod URLMatchMethod `json:"urlMatchMethod,omitempty"`
+}
+
+// Entry2 describes a single complete entry, as the DTO-based API sees it
+type Entry2 struct {
+	URLs          []string `json:"uRLs"`
+	Title         string   `json:"title"`
+	UniqueID      string   `json:"uniqueID"`
+	IconImageData string   `json:"iconImageData"`
+	HTTPRealm     string   `json:"hTTPRealm"`
+
+	Notes string   `json:"notes"`
+	Tags  []string `json:"tags"`
+
+	// Fields holds the username, password and any other form or custom
+	// fields of the entry
+	Fields []FormField `json:"fields"`
+
+	MatcherConfigs []EntryMatcherConfig `json:"matcherConfigs"`
+
+	MatchAccuracy    int  `json:"matchAccuracy"`
+	AlwaysAutoFill   bool `json:"alwaysAutoFill"`
+	NeverAutoFill    bool `json:"neverAutoFill"`
+	AlwaysAutoSubmit bool `json:"alwaysAutoSubmit"`
+	NeverAutoSubmit  bool `json:"neverAutoSubmit"`
+	Priority         int  `json:"priority"`
+
+	Parent Group    `json:"parent"`
+	Db     Database `json:"db"`
+}
+
+// Username is a helper function that retrieves the first username field
+func (e *Entry2) Username() string {
+	for _, f := range e.Fields {
+		if f.Type == FFTusername {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Password is a helper function that retrieves the first password field
+func (e *Entry2) Password() string {
+	for _, f := range e.Fields {
+		if f.Type == FFTpassword {
+			return f.Text()
+		}
+	}
+	return ""
+}
+
+// PasswordSecret is like Password, but returns a copy of the password as a
+// secret.Value, which the caller must Destroy, or nil if there's none.
+func (e *Entry2) PasswordSecret() *secret.Value {
+	return passwordSecret(e.Fields)
+}
+
+// Field returns the value of the first field with the given name or display
+// name, and whether there was one.
+func (e *Entry2) Field(name string) (string, bool) {
+	for _, f := range e.Fields {
+		if f.Name == name || f.DisplayName == name {
+			return f.Text(), true
+		}
+	}
+	return "", false
+}
+
+// Entry2FromEntry converts an Entry from the older API.
+func Entry2FromEntry(e *Entry) Entry2 {
+	return Entry2{
+		URLs:             e.URLs,
+		Title:            e.Title,
+		UniqueID:         e.UniqueID,
+		IconImageData:    e.IconImageData,
+		HTTPRealm:        e.HTTPRealm,
+		Fields:           e.FormFieldList,
+		MatchAccuracy:    e.MatchAccuracy,
+		AlwaysAutoFill:   e.AlwaysAutoFill,
+		NeverAutoFill:    e.NeverAutoFill,
+		AlwaysAutoSubmit: e.AlwaysAutoSubmit,
+		NeverAutoSubmit:  e.NeverAutoSubmit,
+		Priority:         e.Priority,
+		Parent:           e.Parent,
+		Db:               e.Db,
+	}
+}
+
+// Entry converts e for use with the older API, which drops its notes, tags
+// and matcher configuration.
+func (e *Entry2) Entry() Entry {
+	return Entry{
+		URLs:             e.URLs,
+		Title:            e.Title,
+		UniqueID:         e.UniqueID,
+		IconImageData:    e.IconImageData,
+		HTTPRealm:        e.HTTPRealm,
+		FormFieldList:    e.Fields,
+		MatchAccuracy:    e.MatchAccuracy,
+		AlwaysAutoFill:   e.AlwaysAutoFill,
+		NeverAutoFill:    e.NeverAutoFill,
+		AlwaysAutoSubmit: e.AlwaysAutoSubmit,
+		NeverAutoSubmit:  e.NeverAutoSubmit,
+		Priority:         e.Priority,
+		Parent:           e.Parent,
+		Db:               e.Db,
+	}
+}
+
+// ByAccuracy2 orders a list of Entry2s by match accuracy, for sort.Sort.
+type ByAccuracy2 []Entry2
+
+func (g ByAccuracy2) Len() int           { return len(g) }
+func (g ByAccuracy2) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
+func (g ByAccuracy2) Less(i, j int) bool { return g[i].MatchAccuracy > g[j].MatchAccuracy }
+
+// GroupDto is a group along with, when full details were requested, its
+// children
+type GroupDto struct {
+	Group
+
+	ChildGroups  []GroupDto `json:"childGroups"`
+	ChildEntries []Entry2   `json:"childEntries"`
+}
+
+// DatabaseDto describes a database open in KeePass
+type DatabaseDto struct {
+	Name          string   `json:"name"`
+	FileName      string   `json:"fileName"`
+	Root          GroupDto `json:"root"`
+	Active        bool     `json:"active"`
+	IconImageData string   `json:"iconImageData"`
+}
+
+// ExecuteEntries is like Execute, but returns Entry2s, using FindEntries if
+// the server supports it.
+func (s *Search) ExecuteEntries() ([]Entry2, error) {
+	return s.ExecuteEntriesContext(context.Background())
+}
+
+// ExecuteEntriesContext is like ExecuteEntries, but honors ctx for cancellation.
+func (s *Search) ExecuteEntriesContext(ctx context.Context) ([]Entry2, error) {
+	reply, err := s.client.FindEntriesContext(ctx, s.UnsanitizedURLs,
+		s.ActionURL, s.HTTPRealm, s.LST, s.RequireFullURLMatches,
+		s.UniqueID, s.DBFileName, s.FreeTextSearch, s.Username)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.UnsanitizedURLs) > 0 {
+		sort.Sort(ByAccuracy2(reply))
+	}
+	return reply, nil
+}
+
+// FindEntries searches the database for entries matching a pattern. If the
+// server doesn't support FindEntries, it falls back to FindLogins.
+func (c *Client) FindEntries(unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry2, error) {
+	return c.FindEntriesContext(context.Background(), unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+}
+
+// FindEntriesContext is like FindEntries, but honors ctx for cancellation.
+func (c *Client) FindEntriesContext(ctx context.Context, unsanitizedURLs []string, actionURL, httpRealm string, lst LoginSearchType, requireFullURLMatches bool, uniqueID, dbFileName, freeTextSearch, username string) ([]Entry2, error) {
+	if unsanitizedURLs == nil {
+		unsanitizedURLs = []string{} // cannot be null
+	}
+	if !c.HasFeature(FeatureDTOV2) {
+		legacy, err := c.FindLoginsContext(ctx, unsanitizedURLs, actionURL, httpRealm, lst, requireFullURLMatches, uniqueID, dbFileName, freeTextSearch, username)
+		if err != nil {
+			return nil, err
+		}
+		reply := make([]Entry2, len(legacy))
+		for i := range legacy {
+			reply[i] = Entry2FromEntry(&legacy[i])
+		}
+		return reply, nil
+	}
+
+	args := []interface{}{
+		unsanitizedURLs,
+		actionURL,
+		httpRealm,
+		lst,
+		requireFullURLMatches,
+		uniqueID,
+		dbFileName,
+		freeTextSearch,
+		username,
+	}
+	var reply []Entry2
+	err := c.call(ctx, "FindEntries", args, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// AddEntry adds a new entry to the database
+func (c *Client) AddEntry(entry *Entry2, parentUUID, dbFileName string) (*Entry2, error) {
+	return c.AddEntryContext(context.Background(), entry, parentUUID, dbFileName)
+}
+
+// AddEntryContext is like AddEntry, but honors ctx for cancellation.
+func (c *Client) AddEntryContext(ctx context.Context, entry *Entry2, parentUUID, dbFileName string) (*Entry2, error) {
+	var reply Entry2
+	err := c.call(ctx, "AddEntry",
+		[]interface{}{entry, parentUUID, dbFileName}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// UpdateEntry updates an existing entry in the database
+func (c *Client) UpdateEntry(entry *Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*Entry2, error) {
+	return c.UpdateEntryContext(context.Background(), entry, oldUUID, urlMergeMode, dbFileName)
+}
+
+// UpdateEntryContext is like UpdateEntry, but honors ctx for cancellation.
+func (c *Client) UpdateEntryContext(ctx context.Context, entry *Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*Entry2, error) {
+	var reply Entry2
+	err := c.call(ctx, "UpdateEntry",
+		[]interface{}{entry, oldUUID, urlMergeMode, dbFileName}, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// GetDatabases is like GetAllDatabases, but describes each database as a
+// DatabaseDto. With fullDetails, and a server which supports it, each root
+// group comes with all of its descendants.
+func (c *Client) GetDatabases(fullDetails bool) ([]DatabaseDto, error) {
+	return c.GetDatabasesContext(context.Background(), fullDetails)
+}
+
+// GetDatabasesContext is like GetDatabases, but honors ctx for cancellation.
+func (c *Client) GetDatabasesContext(ctx context.Context, fullDetails bool) ([]DatabaseDto, error) {
+	var reply []DatabaseDto
+	err := c.call(ctx, "GetAllDatabases", fullDetails, &reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
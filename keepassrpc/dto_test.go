@@ -0,0 +1,118 @@
+package keepassrpc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestEntry2(t *testing.T) {
+	srv := newServer(t)
+
+	srv.AddEntry2("", keepassrpc.Entry2{
+		Title: "mail",
+		URLs:  []string{"https://mail.example.com/"},
+		Notes: "recovery codes are in the safe",
+		Tags:  []string{"work"},
+		Fields: []keepassrpc.FormField{
+			{Name: "user", Type: keepassrpc.FFTusername, Value: "mallory"},
+			{Name: "pass", Type: keepassrpc.FFTpassword, Value: "s3cret"},
+			{Name: "pin", DisplayName: "PIN", Type: keepassrpc.FFTtext, Value: "1234"},
+		},
+		MatcherConfigs: []keepassrpc.EntryMatcherConfig{
+			{MatcherType: keepassrpc.MatcherURL, URLMatchMethod: keepassrpc.URLMatchHostname},
+		},
+	})
+
+	c := dial(t, srv, "sybil")
+	defer c.Close()
+
+	entries, err := c.FindEntries(nil, "", "", keepassrpc.LSTall, false, "", "", "mail", "")
+	if err != nil {
+		t.Fatal("FindEntries:", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("FindEntries returned %+v", entries)
+	}
+	e := entries[0]
+	if pin, _ := e.Field("PIN"); pin != "1234" || e.Notes == "" || len(e.Tags) != 1 ||
+		len(e.MatcherConfigs) != 1 || e.Password() != "s3cret" {
+		t.Errorf("FindEntries returned %+v", e)
+	}
+	if f := e.Fields[1]; f.Value != "" || string(f.Secret.Bytes()) != "s3cret" {
+		t.Errorf("password decoded as %q, with secret %q", f.Value, f.Secret.Bytes())
+	}
+	pass := e.PasswordSecret()
+	if string(pass.Bytes()) != "s3cret" {
+		t.Errorf("PasswordSecret returned %q", pass.Bytes())
+	}
+	pass.Destroy()
+
+	e.Notes = "moved"
+	updated, err := c.UpdateEntry(&e, e.UniqueID, 0, "")
+	if err != nil {
+		t.Fatal("UpdateEntry:", err)
+	}
+	if updated.Notes != "moved" || updated.UniqueID != e.UniqueID || updated.Password() != "s3cret" {
+		t.Errorf("UpdateEntry returned %+v", updated)
+	}
+	added, err := c.AddEntry(&keepassrpc.Entry2{Title: "new", Tags: []string{"t"}}, "", "")
+	if err != nil {
+		t.Fatal("AddEntry:", err)
+	}
+	if len(added.Tags) != 1 || added.UniqueID == "" {
+		t.Errorf("AddEntry returned %+v", added)
+	}
+
+	dbs, err := c.GetDatabases(false)
+	if err != nil {
+		t.Fatal("GetDatabases:", err)
+	}
+	if len(dbs) != 1 || dbs[0].Root.UniqueID != srv.Root().UniqueID {
+		t.Errorf("GetDatabases returned %+v", dbs)
+	}
+
+	// Without FeatureDTOV2, reads fall back and writes fail early.
+	srv.SetFeatures(keepassrpc.FeatureVersion16)
+	old := dial(t, srv, "trent")
+	defer old.Close()
+	entries, err = old.FindEntries(nil, "", "", keepassrpc.LSTall, false, "", "", "mail", "")
+	if err != nil {
+		t.Fatal("FindEntries on an older server:", err)
+	}
+	if len(entries) != 1 || entries[0].Password() != "s3cret" || entries[0].Notes != "" {
+		t.Errorf("FindEntries on an older server returned %+v", entries)
+	}
+	if _, err := old.AddEntry(&keepassrpc.Entry2{Title: "new"}, "", ""); !errors.Is(err, keepassrpc.ErrUnsupported) {
+		t.Errorf("AddEntry on an older server returned %v, want %v", err, keepassrpc.ErrUnsupported)
+	}
+}
+
+func TestFormFieldJSON(t *testing.T) {
+	in := `[{"name":"user","value":"mallory","type":"FFTusername"},` +
+		`{"name":"pass","value":"s3cr\u00e9t","type":"FFTpassword"}]`
+	var fields []keepassrpc.FormField
+	if err := json.Unmarshal([]byte(in), &fields); err != nil {
+		t.Fatal("Unmarshal:", err)
+	}
+	if fields[0].Value != "mallory" || fields[0].Secret != nil {
+		t.Errorf("username decoded as %+v", fields[0])
+	}
+	if fields[1].Value != "" || string(fields[1].Secret.Bytes()) != "s3crét" {
+		t.Errorf("password decoded as %q, with secret %q", fields[1].Value, fields[1].Secret.Bytes())
+	}
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal("Marshal:", err)
+	}
+	var again []map[string]interface{}
+	if err := json.Unmarshal(out, &again); err != nil {
+		t.Fatal("Unmarshal:", err)
+	}
+	if again[0]["value"] != "mallory" || again[1]["value"] != "s3crét" {
+		t.Errorf("fields encoded as %s", out)
+	}
+}
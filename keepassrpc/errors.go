@@ -0,0 +1,76 @@
+package keepassrpc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors reported while establishing or using a session. Errors returned by
+// Client may wrap these, so test for them with errors.Is.
+var (
+	// ErrAuthRequired means the server wants us to authenticate afresh,
+	// or that we'd need to pair but have no way to ask for the code.
+	ErrAuthRequired = errors.New("keepassrpc: authentication required")
+
+	// ErrVersionMismatch means the server doesn't support our version
+	// of the protocol, or we don't support its version.
+	ErrVersionMismatch = errors.New("keepassrpc: protocol version mismatch")
+
+	// ErrKeyRejected means challenge/response with a stored session
+	// key failed, and the client needs to pair again.
+	ErrKeyRejected = errors.New("keepassrpc: session key rejected")
+
+	// ErrEvidenceMismatch means an SRP negotiation failed because one
+	// side's proof didn't match, usually due to a mistyped pairing code.
+	ErrEvidenceMismatch = errors.New("keepassrpc: SRP evidence mismatch")
+
+	// ErrHMAC means a JSON-RPC message failed authentication.
+	ErrHMAC = errors.New("keepassrpc: HMAC authentication failed")
+)
+
+// ProtocolError is an error message sent by the other end of a connection,
+// such as "AUTH_FAILED" or "VERSION_CLIENT_TOO_LOW".
+type ProtocolError struct {
+	Code   string
+	Params []string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, strings.Join(e.Params, "\n"))
+}
+
+// Is matches the error codes which have a sentinel error above.
+func (e *ProtocolError) Is(target error) bool {
+	switch e.Code {
+	case "AUTH_RESTART", "AUTH_EXPIRED":
+		return target == ErrAuthRequired
+	case "VERSION_CLIENT_TOO_LOW", "VERSION_CLIENT_TOO_HIGH":
+		return target == ErrVersionMismatch
+	}
+	return false
+}
+
+// authFailure reports whether err is the server turning down our
+// credentials, as opposed to anything else going wrong.
+func authFailure(err error) bool {
+	var perr *ProtocolError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	switch perr.Code {
+	case "AUTH_FAILED", "AUTH_RESTART", "AUTH_EXPIRED":
+		return true
+	}
+	return false
+}
+
+// RPCError is an error returned by the server in reply to a JSON-RPC call.
+type RPCError struct {
+	Method  string
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Method, e.Message)
+}
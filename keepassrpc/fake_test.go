@@ -0,0 +1,30 @@
+package keepassrpc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+	"github.com/logic/gkp/keepassrpc/keepassrpctest"
+)
+
+// newServer starts a fake KeePassRPC server, which is shut down when the
+// test ends.
+func newServer(t *testing.T) *keepassrpctest.Server {
+	t.Helper()
+	srv := keepassrpctest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dial pairs a fresh client with srv via SRP.
+func dial(t *testing.T, srv *keepassrpctest.Server, username string) *keepassrpc.Client {
+	t.Helper()
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, username, nil, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	return c
+}
@@ -0,0 +1,152 @@
+package keepassrpc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Features are capabilities that each end of a KeePassRPC connection
+// advertises to the other during setup.
+const (
+	// FeatureVersion16 is the baseline feature set of protocol 1.6 on
+	FeatureVersion16 = "KPRPC_FEATURE_VERSION_1_6"
+
+	// FeatureWarnUserWhenFeatureMissing asks the server to tell the
+	// user, rather than just failing, if we lack a feature it needs
+	FeatureWarnUserWhenFeatureMissing = "KPRPC_FEATURE_WARN_USER_WHEN_FEATURE_MISSING"
+
+	// FeatureEntryURLReplacement means UpdateLogin accepts
+	// URLMergeReplaceAll
+	FeatureEntryURLReplacement = "KPRPC_FEATURE_ENTRY_URL_REPLACEMENT"
+
+	// FeatureDTOV2 means the server offers the DTO-based API, such as
+	// FindEntries and AddEntry
+	FeatureDTOV2 = "KPRPC_FEATURE_DTO_V2"
+
+	// FeatureGeneralClients means the server accepts clients other than
+	// the Kee browser extension
+	FeatureGeneralClients = "KPRPC_GENERAL_CLIENTS"
+)
+
+// ClientFeatures lists the features a Client advertises to the server.
+var ClientFeatures = []string{
+	FeatureVersion16,
+	FeatureWarnUserWhenFeatureMissing,
+	FeatureEntryURLReplacement,
+	FeatureDTOV2,
+}
+
+// ServerFeatures lists the features a Server advertises by default.
+var ServerFeatures = []string{
+	FeatureVersion16,
+	FeatureGeneralClients,
+	FeatureEntryURLReplacement,
+	FeatureDTOV2,
+}
+
+// methodFeatures maps calls onto the server feature they depend on.
+var methodFeatures = map[string]string{
+	"AddEntry":    FeatureDTOV2,
+	"FindEntries": FeatureDTOV2,
+	"UpdateEntry": FeatureDTOV2,
+}
+
+// ErrUnsupported is returned, without contacting the server, for calls
+// which depend on a feature the server didn't advertise.
+var ErrUnsupported = errors.New("keepassrpc: not supported by server")
+
+// Version is a KeePassRPC protocol version.
+type Version struct {
+	Major, Minor, Patch uint8
+}
+
+// ParseVersion unpacks a version as sent in a Message.
+func ParseVersion(v uint32) Version {
+	return Version{uint8(v >> 16), uint8(v >> 8), uint8(v)}
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// serverInfo is what the server told us about itself during setup.
+type serverInfo struct {
+	mu       sync.Mutex
+	version  Version
+	features map[string]bool
+}
+
+// recordServer notes the version and features in a setup message from the
+// server, and checks that we can talk to it.
+func (c *Client) recordServer(msg *Message) error {
+	if msg.Version != 0 {
+		v := ParseVersion(msg.Version)
+		if v.Major != protocolVersion[0] {
+			return fmt.Errorf("%w: server speaks %s, we speak %s",
+				ErrVersionMismatch, v, ParseVersion(ProtocolVersion()))
+		}
+		c.server.mu.Lock()
+		c.server.version = v
+		c.server.mu.Unlock()
+	}
+	if msg.Features != nil {
+		features := map[string]bool{}
+		for _, f := range msg.Features {
+			features[f] = true
+		}
+		c.server.mu.Lock()
+		c.server.features = features
+		c.server.mu.Unlock()
+	}
+	return nil
+}
+
+// ServerVersion returns the protocol version the server reported during
+// setup, or the zero Version if it didn't report one.
+func (c *Client) ServerVersion() Version {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	return c.server.version
+}
+
+// Features returns the features the server advertised during setup.
+func (c *Client) Features() []string {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	var features []string
+	for f := range c.server.features {
+		features = append(features, f)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// HasFeature reports whether the server advertised feature during setup.
+func (c *Client) HasFeature(feature string) bool {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	return c.server.features[feature]
+}
+
+// checkMethod fails calls that depend on a feature the server lacks.
+func (c *Client) checkMethod(method string) error {
+	feature, ok := methodFeatures[method]
+	if !ok {
+		return nil
+	}
+	return c.checkFeature(method, feature)
+}
+
+// checkFeature fails method if the server lacks feature. If the server
+// advertised no features at all, we assume it predates negotiation, and let
+// it decide for itself.
+func (c *Client) checkFeature(method, feature string) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if c.server.features == nil || c.server.features[feature] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s requires %s", ErrUnsupported, method, feature)
+}
@@ -0,0 +1,39 @@
+package keepassrpc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestFeatures(t *testing.T) {
+	srv := newServer(t)
+
+	c := dial(t, srv, "peggy")
+	defer c.Close()
+	if v := c.ServerVersion(); v.String() != "1.7.2" {
+		t.Errorf("ServerVersion returned %v", v)
+	}
+	if !c.HasFeature(keepassrpc.FeatureEntryURLReplacement) {
+		t.Errorf("server features %v lack %s", c.Features(), keepassrpc.FeatureEntryURLReplacement)
+	}
+
+	srv.SetFeatures(keepassrpc.FeatureVersion16)
+	old := dial(t, srv, "rupert")
+	defer old.Close()
+	if f := old.Features(); len(f) != 1 || f[0] != keepassrpc.FeatureVersion16 {
+		t.Errorf("Features returned %v", f)
+	}
+	e := srv.AddEntry("", keepassrpc.Entry{Title: "old"})
+	_, err := old.UpdateLogin(&e, e.UniqueID, keepassrpc.URLMergeReplaceAll, "")
+	if !errors.Is(err, keepassrpc.ErrUnsupported) {
+		t.Errorf("UpdateLogin returned %v, want %v", err, keepassrpc.ErrUnsupported)
+	}
+	if _, err := old.UpdateLogin(&e, e.UniqueID, keepassrpc.URLMergeKeepAddNew, ""); err != nil {
+		t.Error("UpdateLogin without replacement:", err)
+	}
+	if _, err := c.UpdateLogin(&e, e.UniqueID, keepassrpc.URLMergeReplaceAll, ""); err != nil {
+		t.Error("UpdateLogin:", err)
+	}
+}
@@ -0,0 +1,203 @@
+package keepassrpc
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// GroupMatch is how a GroupSearch compares group titles with its pattern
+type GroupMatch int
+
+const (
+	// GroupMatchExact matches titles equal to the pattern
+	GroupMatchExact GroupMatch = iota
+
+	// GroupMatchPrefix matches titles starting with the pattern
+	GroupMatchPrefix
+
+	// GroupMatchGlob matches titles against a shell pattern, as in
+	// path.Match
+	GroupMatchGlob
+
+	// GroupMatchRegexp matches titles against a regular expression, as
+	// in package regexp
+	GroupMatchRegexp
+)
+
+// ParseGroupMatch returns the GroupMatch named "exact", "prefix", "glob" or
+// "regexp" (or "regex").
+func ParseGroupMatch(name string) (GroupMatch, error) {
+	switch name {
+	case "exact":
+		return GroupMatchExact, nil
+	case "prefix":
+		return GroupMatchPrefix, nil
+	case "glob":
+		return GroupMatchGlob, nil
+	case "regexp", "regex":
+		return GroupMatchRegexp, nil
+	}
+	return 0, fmt.Errorf("unknown group match type '%s'", name)
+}
+
+// GroupSearch describes a search for groups in KeePass. KeePassRPC has no
+// usable method for this (see FindGroups), so the search walks the group
+// tree from GetRoot instead with a Walker, fetching only groups.
+type GroupSearch struct {
+	// Pattern is compared with each group's title, as directed by Match
+	Pattern string
+	Match   GroupMatch
+
+	// IgnoreCase makes the comparison case-insensitive
+	IgnoreCase bool
+
+	// UniqueID, if set, restricts the search to the group with this UUID
+	UniqueID string
+
+	client RootedTree
+}
+
+// NewGroupSearch returns a fresh GroupSearch object.
+func (c *Client) NewGroupSearch() *GroupSearch {
+	return &GroupSearch{client: c}
+}
+
+// matcher returns a function reporting whether a title matches the search.
+func (s *GroupSearch) matcher() (func(string) bool, error) {
+	pattern := s.Pattern
+	switch s.Match {
+	case GroupMatchExact:
+		if s.IgnoreCase {
+			return func(t string) bool { return strings.EqualFold(t, pattern) }, nil
+		}
+		return func(t string) bool { return t == pattern }, nil
+	case GroupMatchPrefix:
+		if s.IgnoreCase {
+			pattern = strings.ToLower(pattern)
+			return func(t string) bool { return strings.HasPrefix(strings.ToLower(t), pattern) }, nil
+		}
+		return func(t string) bool { return strings.HasPrefix(t, pattern) }, nil
+	case GroupMatchGlob:
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		if s.IgnoreCase {
+			// Folding the pattern would break classes like [A-Z], so
+			// match with an equivalent regexp instead.
+			re := regexp.MustCompile("(?i)" + globRegexp(pattern))
+			return func(t string) bool { return re.MatchString(t) }, nil
+		}
+		return func(t string) bool {
+			ok, _ := path.Match(pattern, t)
+			return ok
+		}, nil
+	case GroupMatchRegexp:
+		if s.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return func(t string) bool { return re.MatchString(t) }, nil
+	}
+	return nil, fmt.Errorf("unknown group match type %d", s.Match)
+}
+
+// globRegexp translates pattern, which path.Match must accept, into an
+// anchored regular expression matching the same strings.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	// literal reads one possibly escaped character from the pattern.
+	literal := func() string {
+		if pattern[0] == '\\' {
+			pattern = pattern[1:]
+		}
+		r, n := utf8.DecodeRuneInString(pattern)
+		pattern = pattern[n:]
+		return fmt.Sprintf(`\x{%x}`, r)
+	}
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			b.WriteString("[^/]*")
+			pattern = pattern[1:]
+		case '?':
+			b.WriteString("[^/]")
+			pattern = pattern[1:]
+		case '[':
+			b.WriteString("[")
+			pattern = pattern[1:]
+			if pattern[0] == '^' {
+				b.WriteString("^")
+				pattern = pattern[1:]
+			}
+			for n := 0; n == 0 || pattern[0] != ']'; n++ {
+				b.WriteString(literal())
+				if pattern[0] == '-' {
+					pattern = pattern[1:]
+					b.WriteString("-" + literal())
+				}
+			}
+			b.WriteString("]")
+			pattern = pattern[1:]
+		default:
+			b.WriteString(literal())
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// Execute runs the search, returning matching groups in tree order.
+func (s *GroupSearch) Execute() ([]Group, error) {
+	return s.ExecuteContext(context.Background())
+}
+
+// ExecuteContext is like Execute, but honors ctx for cancellation.
+func (s *GroupSearch) ExecuteContext(ctx context.Context) ([]Group, error) {
+	match := func(string) bool { return true }
+	if s.UniqueID == "" || s.Pattern != "" {
+		var err error
+		if match, err = s.matcher(); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := s.client.GetRootContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if root.Path == "" {
+		root.Path = JoinPath(root.Title)
+	}
+
+	results := []Group{}
+	w := &Walker{Tree: s.client, SkipEntries: true}
+	err = w.Walk(ctx, root, func(n *Node) error {
+		g := n.Group
+		for i := range n.Groups {
+			if c := &n.Groups[i]; c.Path == "" {
+				c.Path = g.Path + "/" + EscapeTitle(c.Title)
+			}
+		}
+		if s.UniqueID == "" || g.UniqueID == s.UniqueID {
+			if match(g.Title) {
+				results = append(results, *g)
+			}
+			if s.UniqueID != "" {
+				return SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
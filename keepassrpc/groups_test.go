@@ -0,0 +1,71 @@
+package keepassrpc_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestGroupSearch(t *testing.T) {
+	srv := newServer(t)
+
+	work := srv.AddGroup("", "Work")
+	github := srv.AddGroup(work.UniqueID, "GitHub")
+	srv.AddGroup(work.UniqueID, "GitLab")
+	srv.AddGroup("", "Home")
+
+	c := dial(t, srv, "ursula")
+	defer c.Close()
+
+	tests := []struct {
+		pattern    string
+		match      keepassrpc.GroupMatch
+		ignoreCase bool
+		want       []string
+	}{
+		{"GitHub", keepassrpc.GroupMatchExact, false, []string{"Root/Work/GitHub"}},
+		{"github", keepassrpc.GroupMatchExact, false, nil},
+		{"github", keepassrpc.GroupMatchExact, true, []string{"Root/Work/GitHub"}},
+		{"Git", keepassrpc.GroupMatchPrefix, false, []string{"Root/Work/GitHub", "Root/Work/GitLab"}},
+		{"GIT", keepassrpc.GroupMatchPrefix, true, []string{"Root/Work/GitHub", "Root/Work/GitLab"}},
+		{"*o*", keepassrpc.GroupMatchGlob, false, []string{"Root", "Root/Work", "Root/Home"}},
+		{"*HUB", keepassrpc.GroupMatchGlob, false, nil},
+		{"*HUB", keepassrpc.GroupMatchGlob, true, []string{"Root/Work/GitHub"}},
+		{"[F-H]it[^h]ab", keepassrpc.GroupMatchGlob, true, []string{"Root/Work/GitLab"}},
+		{"w\\ORK", keepassrpc.GroupMatchGlob, true, []string{"Root/Work"}},
+		{"^Git(Hub|Lab)$", keepassrpc.GroupMatchRegexp, false, []string{"Root/Work/GitHub", "Root/Work/GitLab"}},
+	}
+	for _, tt := range tests {
+		s := c.NewGroupSearch()
+		s.Pattern, s.Match, s.IgnoreCase = tt.pattern, tt.match, tt.ignoreCase
+		groups, err := s.Execute()
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+			continue
+		}
+		var got []string
+		for _, g := range groups {
+			got = append(got, g.Path)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q (%d) found %v, want %v", tt.pattern, tt.match, got, tt.want)
+		}
+	}
+
+	s := c.NewGroupSearch()
+	s.UniqueID = github.UniqueID
+	groups, err := s.Execute()
+	if err != nil {
+		t.Fatal("Execute:", err)
+	}
+	if len(groups) != 1 || groups[0].Title != "GitHub" {
+		t.Errorf("UUID search returned %+v", groups)
+	}
+
+	s = c.NewGroupSearch()
+	s.Pattern, s.Match = "[", keepassrpc.GroupMatchGlob
+	if _, err := s.Execute(); err == nil {
+		t.Error("bad glob pattern accepted")
+	}
+}
@@ -2,34 +2,47 @@ package keepassrpc
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"math/big"
 	"net/rpc"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/logic/gkp/keepassrpc/jsonrpc"
 )
 
-// DebugJSONRPC controls whether unencrypted JSONRPC debugging will be logged
+// DebugJSONRPC controls whether unencrypted JSONRPC debugging will be
+// logged, for clients without Options.Logger.
+//
+// Deprecated: Set Options.Logger, with a level of LevelRPC.
 var DebugJSONRPC = false
 
+// pad returns a padded copy of data, leaving data itself untouched.
 func pad(data []byte) []byte {
 	padding := aes.BlockSize - (len(data) % aes.BlockSize)
 	if padding == 0 {
 		padding = aes.BlockSize
 	}
-	return append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(data)+padding)
+	copy(out, data)
+	copy(out[len(data):], bytes.Repeat([]byte{byte(padding)}, padding))
+	return out
 }
 
 func unpad(data []byte) (output []byte, err error) {
 	var dataLen = len(data)
-	if dataLen%aes.BlockSize != 0 {
+	if dataLen == 0 || dataLen%aes.BlockSize != 0 {
 		return output, fmt.Errorf("data's length isn't a multiple of blockSize")
 	}
 	var paddingBytes = int(data[dataLen-1])
@@ -55,10 +68,22 @@ func hmac(sessionKey, ciphertext, iv []byte) []byte {
 	return mac.Sum(nil)
 }
 
-func encrypt(sessionKey *big.Int, msg []byte) (*MsgJSONRPC, error) {
+// keyBytes returns the session key as the 32-byte AES key KeePassRPC uses,
+// keeping any leading zero bytes that big.Int would drop. Keys too short to
+// have been negotiated by SRP are rejected.
+func keyBytes(sessionKey *big.Int) ([]byte, error) {
+	if sessionKey == nil || sessionKey.Sign() <= 0 ||
+		sessionKey.BitLen() < minSecretBits || sessionKey.BitLen() > 256 {
+		return nil, fmt.Errorf("invalid session key")
+	}
+	return sessionKey.FillBytes(make([]byte, 32)), nil
+}
+
+func encrypt(key []byte, msg []byte) (*MsgJSONRPC, error) {
 	plaintext := pad(msg)
+	defer clear(plaintext)
 
-	block, err := aes.NewCipher(sessionKey.Bytes())
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +97,7 @@ func encrypt(sessionKey *big.Int, msg []byte) (*MsgJSONRPC, error) {
 	ciphertext := make([]byte, len(plaintext))
 	mode.CryptBlocks(ciphertext, plaintext)
 
-	mac := hmac(sessionKey.Bytes(), ciphertext, iv)
+	mac := hmac(key, ciphertext, iv)
 
 	return &MsgJSONRPC{
 		Message: ciphertext,
@@ -81,13 +106,17 @@ func encrypt(sessionKey *big.Int, msg []byte) (*MsgJSONRPC, error) {
 	}, nil
 }
 
-func decrypt(sessionKey *big.Int, msg *MsgJSONRPC) ([]byte, error) {
-	mac := hmac(sessionKey.Bytes(), msg.Message, msg.IV)
-	if bytes.Compare(mac, msg.HMAC) != 0 {
-		return nil, fmt.Errorf("HMAC authentication failed")
+func decrypt(key []byte, msg *MsgJSONRPC) ([]byte, error) {
+	mac := hmac(key, msg.Message, msg.IV)
+	if subtle.ConstantTimeCompare(mac, msg.HMAC) != 1 {
+		return nil, ErrHMAC
+	}
+	if len(msg.IV) != aes.BlockSize || len(msg.Message) == 0 ||
+		len(msg.Message)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("Malformed encrypted message")
 	}
 
-	block, err := aes.NewCipher(sessionKey.Bytes())
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -99,75 +128,263 @@ func decrypt(sessionKey *big.Int, msg *MsgJSONRPC) ([]byte, error) {
 	return unpad(plaintext)
 }
 
-// JSONRPCHandle is our io.ReadWriteCloser implementaion for KeePassRPC crypto
+// ErrClosed is returned for calls made on, or pending when, a connection is
+// closed by either side
+var ErrClosed = errors.New("keepassrpc: connection closed")
+
+// closeTimeout bounds how long Close waits for the peer to acknowledge the
+// websocket close handshake
+const closeTimeout = 2 * time.Second
+
+// JSONRPCHandle is our io.ReadWriteCloser implementaion for KeePassRPC crypto.
+// Each complete JSON value written becomes one encrypted websocket message,
+// and each message received is read back as one newline-terminated value.
 type JSONRPCHandle struct {
-	sessionKey *big.Int
-	ws         *websocket.Conn
-	outbuf     []byte
+	key    []byte // the AES key, wiped when the handle is closed
+	keyErr error  // why the session key couldn't be used, if it couldn't
+	ws     *websocket.Conn
+	log    *slog.Logger
+	calls  sync.Map // methods of calls awaiting a response, by ID, when logging
+
+	wmu     sync.Mutex // serializes Write
+	pending []byte     // written data not yet forming a complete JSON value
+
+	frames  chan []byte   // decrypted messages, from readLoop
+	readErr error         // why readLoop stopped; valid once frames is closed
+	outbuf  []byte        // the remainder of the message being read
+	done    chan struct{} // closed when readLoop exits
+
+	closing   chan struct{} // closed when Close is called
+	closeOnce sync.Once
+	closeErr  error
+
+	// requests, if set, receives any JSON-RPC requests the peer sends us
+	// instead of Read; a client uses it to take delivery of notifications
+	requests func(*notification)
 }
 
-func (ctx *JSONRPCHandle) Write(buf []byte) (int, error) {
-	// TODO: this doesn't properly handle messages split over multiple
-	// calls to Write. In the real world, this doesn't matter, but it
-	// feels like a matter of correctness.
-	if DebugJSONRPC {
-		log.Print(">>> [JSON-RPC] ", string(buf))
+// NewJSONRPCHandle wraps an authenticated websocket, encrypting and
+// decrypting JSON-RPC traffic with the negotiated session key. Either end of
+// a KeePassRPC session may use it. The handle keeps its own copy of the key,
+// which it wipes on Close.
+func NewJSONRPCHandle(ws *websocket.Conn, sessionKey *big.Int) *JSONRPCHandle {
+	return newJSONRPCHandle(ws, sessionKey, defaultLogger(), nil)
+}
+
+func newJSONRPCHandle(ws *websocket.Conn, sessionKey *big.Int, log *slog.Logger, requests func(*notification)) *JSONRPCHandle {
+	h := &JSONRPCHandle{
+		ws:       ws,
+		log:      log,
+		frames:   make(chan []byte),
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
+		requests: requests,
 	}
+	h.key, h.keyErr = keyBytes(sessionKey)
+	go h.readLoop()
+	return h
+}
 
-	crypted, err := encrypt(ctx.sessionKey, buf)
-	if err != nil {
-		return 0, err
+// readLoop receives and decrypts messages until the connection fails or is
+// closed. Once we've started closing, messages are read and discarded until
+// the peer acknowledges the close.
+func (ctx *JSONRPCHandle) readLoop() {
+	defer close(ctx.done)
+	defer close(ctx.frames)
+
+	if ctx.keyErr != nil {
+		ctx.readErr = ctx.keyErr
+		return
 	}
-	msg := &Message{
-		Protocol: "jsonrpc",
-		Version:  ProtocolVersion(),
-		JSONRPC:  crypted,
+	for {
+		msg, err := readMessage(ctx.log, ctx.ws)
+		if err != nil {
+			if _, ok := err.(*websocket.CloseError); ok || ctx.isClosing() ||
+				err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrClosed
+			}
+			ctx.readErr = err
+			return
+		}
+
+		var data []byte
+		switch {
+		case msg.Error != nil:
+			err = DispatchError(msg.Error)
+		case msg.JSONRPC == nil:
+			err = fmt.Errorf("Unexpected %s message on JSON-RPC session", msg.Protocol)
+		default:
+			data, err = decrypt(ctx.key, msg.JSONRPC)
+		}
+		if err == nil && !json.Valid(data) {
+			err = fmt.Errorf("Invalid JSON-RPC message")
+		}
+		if err != nil {
+			ctx.readErr = err
+			return
+		}
+
+		ctx.logFrame("<<<", data)
+
+		if ctx.requests != nil {
+			if n := parseNotification(data); n != nil {
+				ctx.requests(n)
+				continue
+			}
+		}
+
+		select {
+		case ctx.frames <- data:
+		case <-ctx.closing:
+		}
 	}
-	if err := WriteMessage(ctx.ws, msg); err != nil {
-		return 0, err
+}
+
+// logFrame logs a decrypted message at LevelRPC. Responses don't say which
+// call they answer, so the methods of calls are remembered until then, for
+// rpcFrame to redact their results if need be.
+func (ctx *JSONRPCHandle) logFrame(dir string, data []byte) {
+	if !ctx.log.Enabled(context.Background(), LevelRPC) {
+		return
 	}
-	return len(buf), nil
+	var frame struct {
+		Method string          `json:"method"`
+		ID     json.RawMessage `json:"id"`
+	}
+	json.Unmarshal(data, &frame)
+	method := frame.Method
+	if frame.ID != nil && string(frame.ID) != "null" {
+		if method != "" {
+			ctx.calls.Store(string(frame.ID), method)
+		} else if m, ok := ctx.calls.LoadAndDelete(string(frame.ID)); ok {
+			method = m.(string)
+		}
+	}
+	ctx.log.Log(context.Background(), LevelRPC, dir, "frame", rpcFrame{data: data, method: method})
 }
 
-func (ctx *JSONRPCHandle) Read(buf []byte) (int, error) {
-	if ctx.outbuf != nil {
-		return ctx.popBytes(buf)
+func (ctx *JSONRPCHandle) isClosing() bool {
+	select {
+	case <-ctx.closing:
+		return true
+	default:
+		return false
 	}
+}
 
-	msg, err := ReadMessage(ctx.ws)
-	if err != nil {
-		return 0, err
+// Write buffers buf until it completes one or more JSON values, and sends
+// each one as a separate encrypted message.
+func (ctx *JSONRPCHandle) Write(buf []byte) (int, error) {
+	ctx.wmu.Lock()
+	defer ctx.wmu.Unlock()
+
+	if ctx.isClosing() {
+		return 0, ErrClosed
 	}
 
-	ctx.outbuf, err = decrypt(ctx.sessionKey, msg.JSONRPC)
-	if err != nil {
-		return 0, err
+	ctx.pending = append(ctx.pending, buf...)
+	dec := json.NewDecoder(bytes.NewReader(ctx.pending))
+	consumed := 0
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			ctx.pending = nil
+			return 0, err
+		}
+		if err := ctx.send(value); err != nil {
+			return 0, err
+		}
+		consumed = int(dec.InputOffset())
 	}
+	n := copy(ctx.pending, ctx.pending[consumed:])
+	clear(ctx.pending[n:])
+	ctx.pending = ctx.pending[:n]
+	return len(buf), nil
+}
+
+func (ctx *JSONRPCHandle) send(value []byte) error {
+	ctx.logFrame(">>>", value)
 
-	if DebugJSONRPC {
-		log.Print("<<< [JSON-RPC] ", string(ctx.outbuf))
+	if ctx.keyErr != nil {
+		return ctx.keyErr
+	}
+	crypted, err := encrypt(ctx.key, value)
+	if err != nil {
+		return err
+	}
+	msg := &Message{
+		Protocol: "jsonrpc",
+		Version:  ProtocolVersion(),
+		JSONRPC:  crypted,
 	}
+	if err := writeMessage(ctx.log, ctx.ws, msg); err != nil {
+		if err == websocket.ErrCloseSent {
+			return ErrClosed
+		}
+		return err
+	}
+	return nil
+}
 
-	return ctx.popBytes(buf)
+// Read returns data from one received message at a time: a single call never
+// returns the end of one message and the start of the next.
+func (ctx *JSONRPCHandle) Read(buf []byte) (int, error) {
+	if ctx.outbuf == nil {
+		select {
+		case data, ok := <-ctx.frames:
+			if !ok {
+				return 0, ctx.readErr
+			}
+			ctx.outbuf = append(data, '\n')
+		case <-ctx.closing:
+			return 0, ErrClosed
+		}
+	}
+	return ctx.popBytes(buf), nil
 }
 
-func (ctx *JSONRPCHandle) popBytes(buf []byte) (int, error) {
-	var copied int
-	if len(ctx.outbuf) > len(buf) {
-		copy(buf, ctx.outbuf[:len(buf)])
-		copied = len(buf)
-		ctx.outbuf = ctx.outbuf[len(buf):]
-	} else {
-		copy(buf, ctx.outbuf)
-		copied = len(ctx.outbuf)
+// popBytes copies out as much of the current message as fits in buf, wiping
+// what it copies from our buffer.
+func (ctx *JSONRPCHandle) popBytes(buf []byte) int {
+	copied := copy(buf, ctx.outbuf)
+	clear(ctx.outbuf[:copied])
+	if copied == len(ctx.outbuf) {
 		ctx.outbuf = nil
+	} else {
+		ctx.outbuf = ctx.outbuf[copied:]
 	}
-	return copied, nil
+	return copied
 }
 
-// Close closes
+// Close performs the websocket close handshake, waiting briefly for the
+// peer to acknowledge it, and then closes the underlying connection. Reads
+// and writes after Close, including any already blocked, fail with
+// ErrClosed. The session key is wiped once nothing else can be using it.
 func (ctx *JSONRPCHandle) Close() error {
-	return fmt.Errorf("Unimplemented")
+	ctx.closeOnce.Do(func() {
+		close(ctx.closing)
+
+		deadline := time.Now().Add(closeTimeout)
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "goodbye")
+		err := ctx.ws.WriteControl(websocket.CloseMessage, msg, deadline)
+		if err == nil || err == websocket.ErrCloseSent {
+			select {
+			case <-ctx.done:
+			case <-time.After(time.Until(deadline)):
+			}
+		}
+		ctx.closeErr = ctx.ws.Close()
+
+		// With the connection closed, readLoop exits promptly.
+		<-ctx.done
+		ctx.wmu.Lock()
+		clear(ctx.key)
+		ctx.wmu.Unlock()
+	})
+	return ctx.closeErr
 }
 
 // JSONRPCContext is a wrapper for our websocket that encrypts and decrypts
@@ -177,18 +394,37 @@ type JSONRPCContext struct {
 	r *rpc.Client
 }
 
-// DispatchJSONRPC handles setup protocol packets from the server
+// DispatchJSONRPC handles a JSON-RPC packet the server sends us outside of
+// a call, such as a signal that a database has been opened or saved.
+// Responses to calls are handled by the session's JSONRPCHandle instead.
 func DispatchJSONRPC(c *Client, jsonrpc *MsgJSONRPC) error {
-	return fmt.Errorf("jsonrpc unimplemented")
+	if jsonrpc == nil || c.SessionKey == nil {
+		return fmt.Errorf("Unexpected JSON-RPC message")
+	}
+	key, err := keyBytes(c.SessionKey)
+	if err != nil {
+		return err
+	}
+	defer clear(key)
+	data, err := decrypt(key, jsonrpc)
+	if err != nil {
+		return err
+	}
+	n := parseNotification(data)
+	if n == nil {
+		return fmt.Errorf("Unexpected JSON-RPC response outside of a call")
+	}
+	return c.dispatchNotification(n)
 }
 
 // EstablishJSONRPCSession sets up our JSON-RPC session
 func EstablishJSONRPCSession(c *Client) {
 	if c.JSONRPCCtx == nil {
-		h := &JSONRPCHandle{
-			sessionKey: c.SessionKey,
-			ws:         c.WS,
-		}
+		h := newJSONRPCHandle(c.WS, c.SessionKey, c.logger(), func(n *notification) {
+			if err := c.dispatchNotification(n); err != nil {
+				c.logger().Warn("Couldn't deliver notification", "method", n.Method, "error", err)
+			}
+		})
 		c.JSONRPCCtx = &JSONRPCContext{
 			c: c,
 			r: jsonrpc.NewClient(h),
@@ -92,10 +92,7 @@ func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
 	r.Error = ""
 	r.Seq = c.resp.Id
 	if c.resp.Error != nil || c.resp.Result == nil {
-		x, ok := c.resp.Error.(string)
-		if !ok {
-			return fmt.Errorf("invalid error %v", c.resp.Error)
-		}
+		x := errorMessage(c.resp.Error)
 		if x == "" {
 			x = "unspecified error"
 		}
@@ -104,6 +101,27 @@ func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
 	return nil
 }
 
+// errorMessage flattens the error member of a response into a string. Some
+// servers (including KeePassRPC) send an object with a message rather than a
+// bare string; anything else is reported as JSON.
+func errorMessage(e interface{}) string {
+	switch x := e.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case map[string]interface{}:
+		if msg, ok := x["message"].(string); ok && msg != "" {
+			return msg
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprint(e)
+	}
+	return string(data)
+}
+
 func (c *clientCodec) ReadResponseBody(x interface{}) error {
 	if x == nil {
 		return nil
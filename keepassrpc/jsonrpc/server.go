@@ -14,10 +14,16 @@ import (
 
 var errMissingParams = errors.New("jsonrpc: request body missing params")
 
+// Params receives the complete positional parameter list of a request. Use
+// it as the argument type of methods which take more than one parameter;
+// any other argument type receives only the first parameter.
+type Params []json.RawMessage
+
 type serverCodec struct {
-	dec *json.Decoder // for reading JSON values
-	enc *json.Encoder // for writing JSON values
-	c   io.Closer
+	dec    *json.Decoder // for reading JSON values
+	enc    *json.Encoder // for writing JSON values
+	c      io.Closer
+	rename func(string) string
 
 	// temporary work space
 	req serverRequest
@@ -35,10 +41,19 @@ type serverCodec struct {
 
 // NewServerCodec returns a new rpc.ServerCodec using JSON-RPC on conn.
 func NewServerCodec(conn io.ReadWriteCloser) rpc.ServerCodec {
+	return NewServiceCodec(conn, nil)
+}
+
+// NewServiceCodec is like NewServerCodec, but passes each requested method
+// name through rename before handing it to package rpc, which only accepts
+// "Service.Method" names. This allows serving protocols whose method names
+// don't follow that convention.
+func NewServiceCodec(conn io.ReadWriteCloser, rename func(string) string) rpc.ServerCodec {
 	return &serverCodec{
 		dec:     json.NewDecoder(conn),
 		enc:     json.NewEncoder(conn),
 		c:       conn,
+		rename:  rename,
 		pending: make(map[uint64]*json.RawMessage),
 	}
 }
@@ -67,6 +82,9 @@ func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
 		return err
 	}
 	r.ServiceMethod = c.req.Method
+	if c.rename != nil {
+		r.ServiceMethod = c.rename(r.ServiceMethod)
+	}
 
 	// JSON request id can be any JSON value;
 	// RPC package expects uint64.  Translate to
@@ -88,6 +106,9 @@ func (c *serverCodec) ReadRequestBody(x interface{}) error {
 	if c.req.Params == nil {
 		return errMissingParams
 	}
+	if p, ok := x.(*Params); ok {
+		return json.Unmarshal(*c.req.Params, p)
+	}
 	// JSON params is array value.
 	// RPC params is struct.
 	// Unmarshal into array containing struct for now.
@@ -0,0 +1,157 @@
+package keepassrpc
+
+import (
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// handlePair connects two JSONRPCHandles over a real websocket.
+func handlePair(t *testing.T) (client, server *JSONRPCHandle) {
+	t.Helper()
+	sessionKey, err := GenKey(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accepted := make(chan *websocket.Conn, 1)
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u websocket.Upgrader
+		ws, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		accepted <- ws
+	}))
+	t.Cleanup(hs.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = NewJSONRPCHandle(ws, new(big.Int).Set(sessionKey))
+	server = NewJSONRPCHandle(<-accepted, sessionKey)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func TestJSONRPCHandleFraming(t *testing.T) {
+	client, server := handlePair(t)
+
+	// one value split over several writes, then two values in one write
+	for _, chunk := range []string{`{"id":1,"params":["a`, `\"b"]`, "}\n", `{"id":2}` + "\n" + `[3]`} {
+		if n, err := client.Write([]byte(chunk)); err != nil || n != len(chunk) {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+
+	buf := make([]byte, 1024)
+	for _, want := range []string{`{"id":1,"params":["a\"b"]}`, `{"id":2}`, `[3]`} {
+		n, err := server.Read(buf)
+		if err != nil {
+			t.Fatal("Read:", err)
+		}
+		if got := string(buf[:n]); got != want+"\n" {
+			t.Errorf("Read returned %q, want %q", got, want+"\n")
+		}
+	}
+
+	// a short buffer gets the message in pieces, but never the next one
+	client.Write([]byte(`{"id":4}{"id":5}`))
+	var got []string
+	small := make([]byte, 5)
+	for len(got) < 3 {
+		n, err := server.Read(small)
+		if err != nil {
+			t.Fatal("Read:", err)
+		}
+		got = append(got, string(small[:n]))
+	}
+	if strings.Join(got, "|") != `{"id"|:4}`+"\n"+`|{"id"` {
+		t.Errorf("short reads returned %q", got)
+	}
+
+	if _, err := client.Write([]byte("}not json")); err == nil {
+		t.Error("Write accepted invalid JSON")
+	}
+}
+
+func TestJSONRPCHandleClose(t *testing.T) {
+	client, server := handlePair(t)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := server.Read(make([]byte, 16))
+		readErr <- err
+	}()
+
+	start := time.Now()
+	if err := client.Close(); err != nil {
+		t.Error("Close:", err)
+	}
+	// the peer is reading, so its close reply should come back promptly
+	if elapsed := time.Since(start); elapsed >= closeTimeout {
+		t.Errorf("Close took %v; the close handshake didn't complete", elapsed)
+	}
+
+	select {
+	case err := <-readErr:
+		if err != ErrClosed {
+			t.Errorf("peer Read returned %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("peer Read didn't see the close")
+	}
+
+	if _, err := client.Write([]byte("{}")); err != ErrClosed {
+		t.Errorf("Write after Close returned %v, want %v", err, ErrClosed)
+	}
+	if _, err := client.Read(make([]byte, 16)); err != ErrClosed {
+		t.Errorf("Read after Close returned %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	sessionKey, _ := GenKey(32)
+	key, err := keyBytes(sessionKey)
+	if err != nil {
+		t.Fatal("keyBytes:", err)
+	}
+	msg, err := encrypt(key, []byte(`{"id":1}`))
+	if err != nil {
+		t.Fatal("encrypt:", err)
+	}
+	if data, err := decrypt(key, msg); err != nil || string(data) != `{"id":1}` {
+		t.Fatalf("decrypt = %q, %v", data, err)
+	}
+
+	msg.Message[0] ^= 1
+	if _, err := decrypt(key, msg); err != ErrHMAC {
+		t.Errorf("decrypting a tampered message: got %v, want ErrHMAC", err)
+	}
+
+	// A short IV must be caught, not passed on to panic in CBC mode.
+	msg.Message[0] ^= 1
+	msg.IV = msg.IV[:4]
+	msg.HMAC = hmac(key, msg.Message, msg.IV)
+	if _, err := decrypt(key, msg); err == nil {
+		t.Error("decrypt accepted a short IV")
+	}
+}
+
+func TestKeyBytesRejectsShortKeys(t *testing.T) {
+	for _, k := range []*big.Int{nil, big.NewInt(0), big.NewInt(-5), big.NewInt(12345), new(big.Int).Lsh(big.NewInt(1), 256)} {
+		if _, err := keyBytes(k); err == nil {
+			t.Errorf("keyBytes(%v) accepted an invalid key", k)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package keepassrpctest
+
+import (
+	"context"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// backend serves the fake database as a keepassrpc.Backend.
+type backend struct {
+	keepassrpc.UnimplementedBackend
+	srv *Server
+}
+
+// begin runs injected hooks for method and then takes the server lock; the
+// caller must release it with end.
+func (b *backend) begin(method string) error {
+	if err := b.srv.intercept(method); err != nil {
+		return err
+	}
+	b.srv.mu.Lock()
+	return nil
+}
+
+func (b *backend) end() {
+	b.srv.mu.Unlock()
+}
+
+func (b *backend) database() keepassrpc.Database {
+	return keepassrpc.Database{
+		Name:     b.srv.DatabaseName,
+		FileName: b.srv.DatabaseFileName,
+		Root:     b.srv.db.root.Group,
+		Active:   true,
+	}
+}
+
+func (b *backend) export(e *keepassrpc.Entry2) keepassrpc.Entry2 {
+	out := *e
+	out.Db = b.database()
+	return out
+}
+
+// exportLegacy describes e for the older, Entry-based methods.
+func (b *backend) exportLegacy(e *keepassrpc.Entry2) keepassrpc.Entry {
+	out := b.export(e)
+	return out.Entry()
+}
+
+func (b *backend) GetRoot(ctx context.Context) (*keepassrpc.Group, error) {
+	if err := b.begin("GetRoot"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+	g := b.srv.db.root.Group
+	return &g, nil
+}
+
+func (b *backend) GetParent(ctx context.Context, uuid string) (*keepassrpc.Group, error) {
+	if err := b.begin("GetParent"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	if g, ok := b.srv.db.groups[uuid]; ok {
+		if g.parent == nil {
+			return nil, errNotFound
+		}
+		parent := g.parent.Group
+		return &parent, nil
+	}
+	if g, ok := b.srv.db.entries[uuid]; ok {
+		parent := g.Group
+		return &parent, nil
+	}
+	return nil, errNotFound
+}
+
+func (b *backend) GetChildGroups(ctx context.Context, uuid string) ([]keepassrpc.Group, error) {
+	if err := b.begin("GetChildGroups"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	g, err := b.srv.db.group(uuid)
+	if err != nil {
+		return nil, err
+	}
+	groups := []keepassrpc.Group{}
+	for _, c := range g.groups {
+		groups = append(groups, c.Group)
+	}
+	return groups, nil
+}
+
+func (b *backend) GetChildEntries(ctx context.Context, uuid string) ([]keepassrpc.Entry, error) {
+	if err := b.begin("GetChildEntries"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	g, err := b.srv.db.group(uuid)
+	if err != nil {
+		return nil, err
+	}
+	entries := []keepassrpc.Entry{}
+	for _, e := range g.entries {
+		entries = append(entries, b.exportLegacy(e))
+	}
+	return entries, nil
+}
+
+func (b *backend) GetAllLogins(ctx context.Context) ([]keepassrpc.Entry, error) {
+	if err := b.begin("GetAllLogins"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	entries := []keepassrpc.Entry{}
+	b.srv.db.walk(func(e *keepassrpc.Entry2) {
+		entries = append(entries, b.exportLegacy(e))
+	})
+	return entries, nil
+}
+
+func (b *backend) FindLogins(ctx context.Context, s *keepassrpc.Search) ([]keepassrpc.Entry, error) {
+	if err := b.begin("FindLogins"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	entries := []keepassrpc.Entry{}
+	found := b.srv.db.find(s.UnsanitizedURLs, s.RequireFullURLMatches,
+		s.UniqueID, s.FreeTextSearch, s.Username)
+	for i := range found {
+		entries = append(entries, b.exportLegacy(&found[i]))
+	}
+	return entries, nil
+}
+
+func (b *backend) FindEntries(ctx context.Context, s *keepassrpc.Search) ([]keepassrpc.Entry2, error) {
+	if err := b.begin("FindEntries"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	entries := b.srv.db.find(s.UnsanitizedURLs, s.RequireFullURLMatches,
+		s.UniqueID, s.FreeTextSearch, s.Username)
+	for i := range entries {
+		entries[i].Db = b.database()
+	}
+	return entries, nil
+}
+
+func (b *backend) AddLogin(ctx context.Context, login *keepassrpc.Entry, parentUUID, dbFileName string) (*keepassrpc.Entry, error) {
+	if err := b.begin("AddLogin"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	e := keepassrpc.Entry2FromEntry(login)
+	e.UniqueID = ""
+	added, err := b.srv.db.addEntry(parentUUID, e)
+	if err != nil {
+		return nil, err
+	}
+	out := b.exportLegacy(added)
+	return &out, nil
+}
+
+func (b *backend) AddEntry(ctx context.Context, entry *keepassrpc.Entry2, parentUUID, dbFileName string) (*keepassrpc.Entry2, error) {
+	if err := b.begin("AddEntry"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	e := *entry
+	e.UniqueID = ""
+	added, err := b.srv.db.addEntry(parentUUID, e)
+	if err != nil {
+		return nil, err
+	}
+	out := b.export(added)
+	return &out, nil
+}
+
+func (b *backend) UpdateLogin(ctx context.Context, login *keepassrpc.Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*keepassrpc.Entry, error) {
+	if err := b.begin("UpdateLogin"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	e, parent, err := b.srv.db.entry(oldLoginUUID)
+	if err != nil {
+		return nil, err
+	}
+	// The older API can't express these, so keep what we had.
+	notes, tags, matchers := e.Notes, e.Tags, e.MatcherConfigs
+	*e = keepassrpc.Entry2FromEntry(login)
+	e.Notes, e.Tags, e.MatcherConfigs = notes, tags, matchers
+	e.UniqueID = oldLoginUUID
+	e.Parent = parent.Group
+	out := b.exportLegacy(e)
+	return &out, nil
+}
+
+func (b *backend) UpdateEntry(ctx context.Context, entry *keepassrpc.Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*keepassrpc.Entry2, error) {
+	if err := b.begin("UpdateEntry"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	e, parent, err := b.srv.db.entry(oldUUID)
+	if err != nil {
+		return nil, err
+	}
+	*e = *entry
+	e.UniqueID = oldUUID
+	e.Parent = parent.Group
+	out := b.export(e)
+	return &out, nil
+}
+
+func (b *backend) RemoveEntry(ctx context.Context, uuid string) (bool, error) {
+	if err := b.begin("RemoveEntry"); err != nil {
+		return false, err
+	}
+	defer b.end()
+	return b.srv.db.removeEntry(uuid), nil
+}
+
+func (b *backend) AddGroup(ctx context.Context, name, parentUUID string) (*keepassrpc.Group, error) {
+	if err := b.begin("AddGroup"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+
+	g, err := b.srv.db.addGroup(parentUUID, name)
+	if err != nil {
+		return nil, err
+	}
+	added := g.Group
+	return &added, nil
+}
+
+func (b *backend) RemoveGroup(ctx context.Context, uuid string) (bool, error) {
+	if err := b.begin("RemoveGroup"); err != nil {
+		return false, err
+	}
+	defer b.end()
+	return b.srv.db.removeGroup(uuid), nil
+}
+
+func (b *backend) GetDatabaseName(ctx context.Context) (string, error) {
+	if err := b.begin("GetDatabaseName"); err != nil {
+		return "", err
+	}
+	defer b.end()
+	return b.srv.DatabaseName, nil
+}
+
+func (b *backend) GetDatabaseFileName(ctx context.Context) (string, error) {
+	if err := b.begin("GetDatabaseFileName"); err != nil {
+		return "", err
+	}
+	defer b.end()
+	return b.srv.DatabaseFileName, nil
+}
+
+func (b *backend) GetAllDatabases(ctx context.Context, fullDetails bool) ([]keepassrpc.Database, error) {
+	if err := b.begin("GetAllDatabases"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+	return []keepassrpc.Database{b.database()}, nil
+}
+
+func (b *backend) ChangeDatabase(ctx context.Context, filename string, closeCurrent bool) error {
+	if err := b.begin("ChangeDatabase"); err != nil {
+		return err
+	}
+	defer b.end()
+	return nil
+}
+
+func (b *backend) GetCurrentKFConfig(ctx context.Context) (*keepassrpc.Configuration, error) {
+	if err := b.begin("GetCurrentKFConfig"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+	return &keepassrpc.Configuration{
+		KnownDatabases: []string{b.srv.DatabaseFileName},
+		AutoCommit:     true,
+	}, nil
+}
+
+func (b *backend) GetApplicationMetadata(ctx context.Context) (*keepassrpc.ApplicationMetadata, error) {
+	if err := b.begin("GetApplicationMetadata"); err != nil {
+		return nil, err
+	}
+	defer b.end()
+	return &keepassrpc.ApplicationMetadata{
+		KeePassVersion: "2.0 (keepassrpctest)",
+		NETCLR:         "none",
+		NETversion:     "none",
+	}, nil
+}
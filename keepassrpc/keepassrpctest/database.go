@@ -0,0 +1,251 @@
+package keepassrpctest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// errNotFound is returned by calls referencing an unknown UUID.
+var errNotFound = errors.New("no such group or entry")
+
+// group is a node in the in-memory database.
+type group struct {
+	keepassrpc.Group
+	parent  *group
+	groups  []*group
+	entries []*keepassrpc.Entry2
+}
+
+// database is an in-memory tree of groups and entries. It is not safe for
+// concurrent use; Server serializes access to it.
+type database struct {
+	root    *group
+	groups  map[string]*group
+	entries map[string]*group // entry UUID -> parent
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newUUID() string {
+	id, err := randomHex(16)
+	if err != nil {
+		panic(fmt.Sprintf("keepassrpctest: generating UUID: %v", err))
+	}
+	return id
+}
+
+func newDatabase(title string) *database {
+	root := &group{Group: keepassrpc.Group{Title: title, UniqueID: newUUID()}}
+	return &database{
+		root:    root,
+		groups:  map[string]*group{root.UniqueID: root},
+		entries: map[string]*group{},
+	}
+}
+
+// group looks up a group by UUID, where the empty UUID means the root.
+func (db *database) group(uuid string) (*group, error) {
+	if uuid == "" {
+		return db.root, nil
+	}
+	if g, ok := db.groups[uuid]; ok {
+		return g, nil
+	}
+	return nil, errNotFound
+}
+
+func (db *database) entry(uuid string) (*keepassrpc.Entry2, *group, error) {
+	parent, ok := db.entries[uuid]
+	if !ok {
+		return nil, nil, errNotFound
+	}
+	for _, e := range parent.entries {
+		if e.UniqueID == uuid {
+			return e, parent, nil
+		}
+	}
+	return nil, nil, errNotFound
+}
+
+func (db *database) addGroup(parentUUID, title string) (*group, error) {
+	parent, err := db.group(parentUUID)
+	if err != nil {
+		return nil, err
+	}
+	g := &group{
+		Group:  keepassrpc.Group{Title: title, UniqueID: newUUID()},
+		parent: parent,
+	}
+	parent.groups = append(parent.groups, g)
+	db.groups[g.UniqueID] = g
+	return g, nil
+}
+
+func (db *database) addEntry(parentUUID string, e keepassrpc.Entry2) (*keepassrpc.Entry2, error) {
+	parent, err := db.group(parentUUID)
+	if err != nil {
+		return nil, err
+	}
+	if e.UniqueID == "" {
+		e.UniqueID = newUUID()
+	}
+	if _, ok := db.entries[e.UniqueID]; ok {
+		return nil, fmt.Errorf("entry %s already exists", e.UniqueID)
+	}
+	e.Parent = parent.Group
+	parent.entries = append(parent.entries, &e)
+	db.entries[e.UniqueID] = parent
+	return &e, nil
+}
+
+func (db *database) removeEntry(uuid string) bool {
+	parent, ok := db.entries[uuid]
+	if !ok {
+		return false
+	}
+	for i, e := range parent.entries {
+		if e.UniqueID == uuid {
+			parent.entries = append(parent.entries[:i], parent.entries[i+1:]...)
+			break
+		}
+	}
+	delete(db.entries, uuid)
+	return true
+}
+
+func (db *database) removeGroup(uuid string) bool {
+	g, ok := db.groups[uuid]
+	if !ok || g == db.root {
+		return false
+	}
+	for len(g.groups) > 0 {
+		db.removeGroup(g.groups[0].UniqueID)
+	}
+	for len(g.entries) > 0 {
+		db.removeEntry(g.entries[0].UniqueID)
+	}
+	for i, c := range g.parent.groups {
+		if c == g {
+			g.parent.groups = append(g.parent.groups[:i], g.parent.groups[i+1:]...)
+			break
+		}
+	}
+	delete(db.groups, uuid)
+	return true
+}
+
+// walk calls fn for every entry in the database, in tree order.
+func (db *database) walk(fn func(*keepassrpc.Entry2)) {
+	var visit func(*group)
+	visit = func(g *group) {
+		for _, e := range g.entries {
+			fn(e)
+		}
+		for _, c := range g.groups {
+			visit(c)
+		}
+	}
+	visit(db.root)
+}
+
+// accuracy rates how well an entry URL matches a URL being searched for,
+// mirroring the MatchAccuracy levels KeePassRPC reports.
+func accuracy(entryURL, searchURL string) int {
+	if entryURL == searchURL {
+		return keepassrpc.MatchAccuracyBest
+	}
+	e, err := url.Parse(entryURL)
+	if err != nil {
+		return keepassrpc.MatchAccuracyNone
+	}
+	s, err := url.Parse(searchURL)
+	if err != nil {
+		return keepassrpc.MatchAccuracyNone
+	}
+	switch {
+	case e.Host == s.Host && e.Path == s.Path:
+		return keepassrpc.MatchAccuracyClose
+	case e.Host == s.Host:
+		return keepassrpc.MatchAccuracyHostnameAndPort
+	case e.Hostname() == s.Hostname():
+		return keepassrpc.MatchAccuracyHostname
+	case domain(e.Hostname()) == domain(s.Hostname()):
+		return keepassrpc.MatchAccuracyDomain
+	}
+	return keepassrpc.MatchAccuracyNone
+}
+
+// domain crudely reduces a hostname to its last two labels.
+func domain(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+	return strings.Join(labels, ".")
+}
+
+// find implements the subset of FindLogins semantics the fake supports:
+// unique ID lookup, URL matching and case-insensitive free-text search over
+// titles, URLs, usernames and notes.
+func (db *database) find(urls []string, requireFull bool, uniqueID, freeText, username string) []keepassrpc.Entry2 {
+	results := []keepassrpc.Entry2{}
+	freeText = strings.ToLower(freeText)
+
+	db.walk(func(e *keepassrpc.Entry2) {
+		if uniqueID != "" && e.UniqueID != uniqueID {
+			return
+		}
+		if username != "" && e.Username() != username {
+			return
+		}
+
+		match := *e
+		match.MatchAccuracy = keepassrpc.MatchAccuracyNone
+		if len(urls) > 0 {
+			for _, su := range urls {
+				for _, eu := range e.URLs {
+					if a := accuracy(eu, su); a > match.MatchAccuracy {
+						match.MatchAccuracy = a
+					}
+				}
+			}
+			if match.MatchAccuracy == keepassrpc.MatchAccuracyNone {
+				return
+			}
+			if requireFull && match.MatchAccuracy < keepassrpc.MatchAccuracyClose {
+				return
+			}
+		}
+
+		if freeText != "" {
+			haystack := []string{e.Title, e.Username(), e.Notes}
+			haystack = append(haystack, e.URLs...)
+			found := false
+			for _, h := range haystack {
+				if strings.Contains(strings.ToLower(h), freeText) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return
+			}
+		}
+
+		results = append(results, match)
+	})
+
+	return results
+}
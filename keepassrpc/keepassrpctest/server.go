@@ -0,0 +1,270 @@
+// Package keepassrpctest provides an in-process KeePassRPC server for use in
+// tests of code built on package keepassrpc.
+//
+// The server is a keepassrpc.Server listening on a local websocket, which
+// answers calls from an in-memory tree of groups and entries.
+package keepassrpctest
+
+import (
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// Server is a fake KeePassRPC service listening on a loopback address.
+type Server struct {
+	// URL is the websocket URL of the server, suitable for
+	// keepassrpc.Options.URL.
+	URL string
+
+	// PairingCode is the code a keepassrpc.Passworder must return to
+	// complete a fresh SRP negotiation.
+	PairingCode string
+
+	// DatabaseName and DatabaseFileName describe the fake open database.
+	DatabaseName     string
+	DatabaseFileName string
+
+	http *httptest.Server
+	rpc  *keepassrpc.Server
+
+	mu       sync.Mutex
+	keys     map[string]*big.Int
+	db       *database
+	latency  time.Duration
+	fail     map[string]error
+	onCall   func(method string) error
+	conns    map[*websocket.Conn]bool
+	features []string
+	pairings int
+}
+
+// NewServer starts and returns a new Server with an empty database. The
+// caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	code, err := randomHex(4)
+	if err != nil {
+		panic(fmt.Sprintf("keepassrpctest: generating pairing code: %v", err))
+	}
+
+	s := &Server{
+		PairingCode:      code,
+		DatabaseName:     "keepassrpctest",
+		DatabaseFileName: "keepassrpctest.kdbx",
+		keys:             map[string]*big.Int{},
+		db:               newDatabase("Root"),
+		fail:             map[string]error{},
+		features:         keepassrpc.ServerFeatures,
+		conns:            map[*websocket.Conn]bool{},
+	}
+	s.rpc = &keepassrpc.Server{
+		Backend: &backend{srv: s},
+		Keys:    keyStore{s},
+		PairingCode: func(string) (string, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.pairings++
+			return s.PairingCode, nil
+		},
+		Features: func(string) []string {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.features
+		},
+		Upgrader: websocket.Upgrader{
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+	}
+	s.http = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/"
+	return s
+}
+
+// Close shuts down the server, dropping any connected clients.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for ws := range s.conns {
+		ws.Close()
+	}
+	s.mu.Unlock()
+	s.http.Close()
+}
+
+// Disconnect drops every connected client, as if KeePass had been restarted,
+// but keeps serving new connections and remembers their session keys.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ws := range s.conns {
+		ws.Close()
+	}
+}
+
+// Authorize records a session key for username, as if the two had already
+// completed an SRP negotiation.
+func (s *Server) Authorize(username string, sessionKey *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[username] = new(big.Int).Set(sessionKey)
+}
+
+// Revoke forgets the session key for username, forcing it to pair again.
+func (s *Server) Revoke(username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, username)
+}
+
+// SessionKey returns the session key negotiated with username, or nil.
+func (s *Server) SessionKey(username string) *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[username]; ok {
+		return new(big.Int).Set(k)
+	}
+	return nil
+}
+
+// Root returns the root group of the fake database.
+func (s *Server) Root() keepassrpc.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.root.Group
+}
+
+// AddGroup creates a group titled title beneath the group parentUUID, where
+// an empty parentUUID means the root. It panics if the parent doesn't exist.
+func (s *Server) AddGroup(parentUUID, title string) keepassrpc.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, err := s.db.addGroup(parentUUID, title)
+	if err != nil {
+		panic(fmt.Sprintf("keepassrpctest: AddGroup(%q): %v", parentUUID, err))
+	}
+	return g.Group
+}
+
+// AddEntry stores a copy of e beneath the group parentUUID, where an empty
+// parentUUID means the root, assigning it a UUID if it has none. It panics if
+// the parent doesn't exist.
+func (s *Server) AddEntry(parentUUID string, e keepassrpc.Entry) keepassrpc.Entry {
+	added := s.AddEntry2(parentUUID, keepassrpc.Entry2FromEntry(&e))
+	return added.Entry()
+}
+
+// AddEntry2 is like AddEntry, but takes an Entry2, which can also carry
+// notes, tags and matcher configuration.
+func (s *Server) AddEntry2(parentUUID string, e keepassrpc.Entry2) keepassrpc.Entry2 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added, err := s.db.addEntry(parentUUID, e)
+	if err != nil {
+		panic(fmt.Sprintf("keepassrpctest: AddEntry(%q): %v", parentUUID, err))
+	}
+	return *added
+}
+
+// SetLatency delays every subsequent JSON-RPC reply by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailMethod makes every subsequent call to method return err. A nil err
+// restores normal service.
+func (s *Server) FailMethod(method string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.fail, method)
+	} else {
+		s.fail[method] = err
+	}
+}
+
+// SetFeatures changes the features advertised to clients which connect
+// afterwards.
+func (s *Server) SetFeatures(features ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features = append([]string{}, features...)
+}
+
+// OnCall registers fn to be called before every JSON-RPC method is served. A
+// non-nil error from fn is returned to the client instead of the result.
+func (s *Server) OnCall(fn func(method string) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onCall = fn
+}
+
+// Pairings returns how many SRP negotiations clients have begun.
+func (s *Server) Pairings() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pairings
+}
+
+// Signal pushes sig to every connected client, as KeePass does when a
+// database is opened, saved or closed.
+func (s *Server) Signal(sig keepassrpc.Signal) error {
+	return s.rpc.Signal(sig)
+}
+
+// intercept applies any injected latency and failures for method.
+func (s *Server) intercept(method string) error {
+	s.mu.Lock()
+	latency, err, fn := s.latency, s.fail[method], s.onCall
+	s.mu.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if err != nil {
+		return err
+	}
+	if fn != nil {
+		return fn(method)
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.rpc.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.conns[ws] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, ws)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	s.rpc.ServeConn(r.Context(), ws)
+}
+
+// keyStore adapts Server's key map to keepassrpc.KeyStore.
+type keyStore struct {
+	srv *Server
+}
+
+func (k keyStore) SessionKey(username string) (*big.Int, error) {
+	return k.srv.SessionKey(username), nil
+}
+
+func (k keyStore) SetSessionKey(username string, key *big.Int) error {
+	k.srv.Authorize(username, key)
+	return nil
+}
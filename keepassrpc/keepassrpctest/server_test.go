@@ -0,0 +1,247 @@
+package keepassrpctest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+// dial pairs a fresh client with srv via SRP.
+func dial(t *testing.T, srv *Server, username string) *keepassrpc.Client {
+	t.Helper()
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, username, nil, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	return c
+}
+
+func TestPairing(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := dial(t, srv, "alice")
+	defer c.Close()
+
+	key := srv.SessionKey("alice")
+	if key == nil || key.Cmp(c.SessionKey) != 0 {
+		t.Fatalf("server key %v doesn't match client key %v", key, c.SessionKey)
+	}
+	root, err := c.GetRoot()
+	if err != nil {
+		t.Fatal("GetRoot:", err)
+	}
+	if root.UniqueID != srv.Root().UniqueID {
+		t.Errorf("GetRoot returned %+v, want %+v", root, srv.Root())
+	}
+}
+
+func TestKeySession(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	key, _ := keepassrpc.GenKey(32)
+	srv.Authorize("bob", key)
+
+	pwd := func() (string, error) {
+		return "", errors.New("unexpected pairing prompt")
+	}
+	c, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "bob", key, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+
+	if _, err := c.GetDatabaseName(); err != nil {
+		t.Error("GetDatabaseName:", err)
+	}
+}
+
+func TestBadPairingCode(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	pwd := func() (string, error) { return "wrong", nil }
+	_, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "mallory", nil, pwd)
+	if err == nil {
+		t.Fatal("pairing with the wrong code succeeded")
+	}
+	if !errors.Is(err, keepassrpc.ErrEvidenceMismatch) {
+		t.Errorf("pairing with the wrong code returned %v, want %v", err, keepassrpc.ErrEvidenceMismatch)
+	}
+}
+
+func TestKeyRejected(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	key, _ := keepassrpc.GenKey(32)
+	srv.Authorize("olivia", key)
+	srv.Revoke("olivia")
+
+	// Without a Passworder, we can't fall back to pairing again, and
+	// don't begin to.
+	_, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "olivia", key, nil)
+	if !errors.Is(err, keepassrpc.ErrAuthRequired) {
+		t.Errorf("connecting with a revoked key returned %v, want %v", err, keepassrpc.ErrAuthRequired)
+	}
+	if !errors.Is(err, keepassrpc.ErrKeyRejected) {
+		t.Errorf("connecting with a revoked key returned %v, want %v", err, keepassrpc.ErrKeyRejected)
+	}
+	_, err = keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "rupert", nil, nil)
+	if !errors.Is(err, keepassrpc.ErrKeyRejected) {
+		t.Errorf("connecting with no key returned %v, want %v", err, keepassrpc.ErrKeyRejected)
+	}
+	if n := srv.Pairings(); n != 0 {
+		t.Errorf("server saw identifyToServer %d times without a Passworder", n)
+	}
+
+	// With one, we pair again transparently.
+	c, err := keepassrpc.Dial(context.Background(),
+		&keepassrpc.Options{URL: srv.URL}, "olivia", key,
+		func() (string, error) { return srv.PairingCode, nil })
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+	if c.SessionKey.Cmp(key) == 0 {
+		t.Error("session key wasn't renegotiated")
+	}
+	if n := srv.Pairings(); n != 1 {
+		t.Errorf("server saw identifyToServer %d times, want 1", n)
+	}
+}
+
+func TestTree(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	work := srv.AddGroup("", "Work")
+	srv.AddGroup(work.UniqueID, "GitHub")
+	srv.AddEntry(work.UniqueID, keepassrpc.Entry{
+		Title: "deploy-bot",
+		URLs:  []string{"https://github.com/login"},
+		FormFieldList: []keepassrpc.FormField{
+			{Name: "login", Type: keepassrpc.FFTusername, Value: "deploy-bot"},
+			{Name: "password", Type: keepassrpc.FFTpassword, Value: "hunter2"},
+		},
+	})
+
+	c := dial(t, srv, "carol")
+	defer c.Close()
+
+	groups, err := c.GetChildGroups(work.UniqueID)
+	if err != nil {
+		t.Fatal("GetChildGroups:", err)
+	}
+	if len(groups) != 1 || groups[0].Title != "GitHub" {
+		t.Errorf("GetChildGroups returned %+v", groups)
+	}
+
+	s := c.NewSearch()
+	s.AddURL("https://github.com/logic/gkp")
+	entries, err := s.Execute()
+	if err != nil {
+		t.Fatal("Execute:", err)
+	}
+	if len(entries) != 1 || entries[0].Password() != "hunter2" {
+		t.Fatalf("search returned %+v", entries)
+	}
+	if entries[0].MatchAccuracy != keepassrpc.MatchAccuracyHostnameAndPort {
+		t.Errorf("match accuracy %d", entries[0].MatchAccuracy)
+	}
+
+	added, err := c.AddLogin(&keepassrpc.Entry{Title: "new"}, "", "")
+	if err != nil {
+		t.Fatal("AddLogin:", err)
+	}
+	if ok, err := c.RemoveEntry(added.UniqueID); err != nil || !ok {
+		t.Errorf("RemoveEntry returned %v, %v", ok, err)
+	}
+}
+
+func TestFailMethod(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	srv.FailMethod("GetRoot", errors.New("database locked"))
+
+	c := dial(t, srv, "dave")
+	defer c.Close()
+
+	_, err := c.GetRoot()
+	if err == nil || !strings.Contains(err.Error(), "database locked") {
+		t.Errorf("GetRoot returned %v", err)
+	}
+	var rerr *keepassrpc.RPCError
+	if !errors.As(err, &rerr) || rerr.Method != "GetRoot" {
+		t.Errorf("GetRoot returned %#v, want an RPCError for GetRoot", err)
+	}
+	srv.FailMethod("GetRoot", nil)
+	if _, err := c.GetRoot(); err != nil {
+		t.Error("GetRoot:", err)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := dial(t, srv, "erin")
+	defer c.Close()
+
+	srv.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetRootContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetRootContext returned %v", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	c := dial(t, srv, "frank")
+	srv.SetLatency(time.Second)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.GetRoot()
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-done:
+		if err != keepassrpc.ErrClosed {
+			t.Errorf("pending GetRoot returned %v, want %v", err, keepassrpc.ErrClosed)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("pending GetRoot wasn't interrupted by Close")
+	}
+	if _, err := c.GetRoot(); err != keepassrpc.ErrClosed {
+		t.Errorf("GetRoot after Close returned %v, want %v", err, keepassrpc.ErrClosed)
+	}
+}
+
+func TestServerGone(t *testing.T) {
+	srv := NewServer()
+	c := dial(t, srv, "grace")
+	defer c.Close()
+
+	srv.Close()
+	if _, err := c.GetRoot(); err != keepassrpc.ErrClosed {
+		t.Errorf("GetRoot after server shutdown returned %v, want %v", err, keepassrpc.ErrClosed)
+	}
+}
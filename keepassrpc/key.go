@@ -2,7 +2,9 @@ package keepassrpc
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
+	"math/big"
 )
 
 // MsgKey represents various stages of the challenge/response protocol
@@ -22,6 +24,20 @@ type KeyContext struct {
 	cc string
 }
 
+// keyHash computes a challenge response; the client responds with prefix
+// "1", and the server with prefix "0".
+func keyHash(prefix string, sessionKey *big.Int, sc, cc string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s%x%s%s", prefix, sessionKey, sc, cc)
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// equalStrings compares a response with the one we expect, in time which
+// doesn't reveal how much of it was right.
+func equalStrings(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
 // DispatchKey handles challenge/response setup negotiation with the server
 func DispatchKey(c *Client, key *MsgKey) error {
 	if key.SC != "" {
@@ -36,6 +52,11 @@ func DispatchKey(c *Client, key *MsgKey) error {
 // EstablishKeySession establishes a session with the KeePassRPC service using
 // a previously-negotiated key.
 func EstablishKeySession(c *Client) error {
+	if c.SessionKey.Sign() <= 0 || c.SessionKey.BitLen() < minSecretBits {
+		// A key this short can't have come from SRP; most likely the
+		// stored copy is damaged. Pair again rather than use it.
+		return fmt.Errorf("%w: stored session key is too short", ErrKeyRejected)
+	}
 	challenge, err := GenKey(32)
 	if err != nil {
 		return err
@@ -43,23 +64,21 @@ func EstablishKeySession(c *Client) error {
 	c.KeyCtx = &KeyContext{cc: challenge.Text(16)}
 	defer func() { c.KeyCtx = nil }()
 
-	msg := &Message{
-		Protocol:   "setup",
-		ClientID:   ClientID,
-		ClientName: ClientName,
-		ClientDesc: ClientDesc,
-		Version:    ProtocolVersion(),
-		Key: &MsgKey{
-			Username:      c.Username,
-			SecurityLevel: 2,
-		},
+	msg := c.setupMessage()
+	msg.Key = &MsgKey{
+		Username:      c.Username,
+		SecurityLevel: 2,
 	}
 
-	if err := WriteMessage(c.WS, msg); err != nil {
+	if err := writeMessage(c.logger(), c.WS, msg); err != nil {
 		return err
 	}
 
-	return c.DispatchResponse()
+	err = c.DispatchResponse()
+	if authFailure(err) {
+		return fmt.Errorf("%w: %w", ErrKeyRejected, err)
+	}
+	return err
 }
 
 // ServerChallenge responds to a challenge issued by the server, and issues
@@ -67,9 +86,7 @@ func EstablishKeySession(c *Client) error {
 func ServerChallenge(c *Client, key *MsgKey) error {
 	c.KeyCtx.sc = key.SC
 
-	h := sha256.New()
-	fmt.Fprintf(h, "1%x%s%s", c.SessionKey, c.KeyCtx.sc, c.KeyCtx.cc)
-	response := fmt.Sprintf("%x", h.Sum(nil))
+	response := keyHash("1", c.SessionKey, c.KeyCtx.sc, c.KeyCtx.cc)
 
 	resp := &Message{
 		Protocol: "setup",
@@ -80,7 +97,7 @@ func ServerChallenge(c *Client, key *MsgKey) error {
 			SecurityLevel: 2,
 		},
 	}
-	if err := WriteMessage(c.WS, resp); err != nil {
+	if err := writeMessage(c.logger(), c.WS, resp); err != nil {
 		return err
 	}
 	return c.DispatchResponse()
@@ -88,15 +105,44 @@ func ServerChallenge(c *Client, key *MsgKey) error {
 
 // ServerResponse validates the server's response to our challenge.
 func ServerResponse(c *Client, key *MsgKey) error {
-	h := sha256.New()
-	fmt.Fprintf(h, "0%x%s%s", c.SessionKey, c.KeyCtx.sc, c.KeyCtx.cc)
-	sr := fmt.Sprintf("%x", h.Sum(nil))
+	sr := keyHash("0", c.SessionKey, c.KeyCtx.sc, c.KeyCtx.cc)
 
 	c.KeyCtx = nil
 
-	if sr != key.SR {
-		return fmt.Errorf("Server key does not match")
+	if !equalStrings(sr, key.SR) {
+		return fmt.Errorf("%w: server key does not match", ErrKeyRejected)
 	}
 
 	return nil
 }
+
+// KeyServerContext is the server side of the challenge/response protocol,
+// for a client which already holds a session key.
+type KeyServerContext struct {
+	Username   string
+	SessionKey *big.Int
+
+	sc string
+}
+
+// Challenge returns a fresh server challenge for the client.
+func (k *KeyServerContext) Challenge() (string, error) {
+	sc, err := GenKey(32)
+	if err != nil {
+		return "", err
+	}
+	k.sc = sc.Text(16)
+	return k.sc, nil
+}
+
+// Respond checks the client's response to our challenge, and returns our
+// response to the client's own challenge.
+func (k *KeyServerContext) Respond(cc, cr string) (string, error) {
+	if k.sc == "" {
+		return "", fmt.Errorf("no challenge issued")
+	}
+	if !equalStrings(keyHash("1", k.SessionKey, k.sc, cc), cr) {
+		return "", ErrKeyRejected
+	}
+	return keyHash("0", k.SessionKey, k.sc, cc), nil
+}
@@ -0,0 +1,27 @@
+package keepassrpc
+
+import "testing"
+
+func TestKeyServerContext(t *testing.T) {
+	key, _ := GenKey(32)
+	s := &KeyServerContext{Username: "user", SessionKey: key}
+
+	sc, err := s.Challenge()
+	if err != nil {
+		t.Fatal("Challenge() failed:", err)
+	}
+	cc := "0123456789abcdef"
+
+	sr, err := s.Respond(cc, keyHash("1", key, sc, cc))
+	if err != nil {
+		t.Fatal("Respond() rejected a valid response:", err)
+	}
+	if sr != keyHash("0", key, sc, cc) {
+		t.Error("Respond() returned the wrong server response")
+	}
+
+	other, _ := GenKey(32)
+	if _, err := s.Respond(cc, keyHash("1", other, sc, cc)); err == nil {
+		t.Error("Respond() accepted a response from the wrong key")
+	}
+}
@@ -0,0 +1,169 @@
+package keepassrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// The levels a Client logs protocol detail at, below slog.LevelDebug so that
+// a handler has to ask for them. Each includes the ones above it.
+const (
+	// LevelHandshake logs how sessions are established and re-established.
+	LevelHandshake = slog.LevelDebug - 1
+
+	// LevelTransport logs each message on the websocket, still encrypted
+	// once the session is established.
+	LevelTransport = slog.LevelDebug - 2
+
+	// LevelRPC logs each decrypted JSON-RPC request and response.
+	LevelRPC = slog.LevelDebug - 3
+)
+
+// redacted stands in for secrets in logs.
+const redacted = "[REDACTED]"
+
+// discardHandler is a slog.Handler which logs nothing.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// defaultLogger returns the logger for clients without Options.Logger, which
+// honors DebugClient and DebugJSONRPC.
+func defaultLogger() *slog.Logger {
+	level := slog.LevelInfo
+	switch {
+	case DebugJSONRPC:
+		level = LevelRPC
+	case DebugClient:
+		level = LevelTransport
+	default:
+		return slog.New(discardHandler{})
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+// secretString logs s as redacted, unless it's empty.
+func secretString(key, s string) slog.Attr {
+	if s == "" {
+		return slog.String(key, "")
+	}
+	return slog.String(key, redacted)
+}
+
+// LogValue implements slog.LogValuer, leaving out SRP evidence, key
+// exchange responses and HMACs, and the size rather than the content of
+// encrypted messages.
+func (m *Message) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("protocol", m.Protocol),
+		slog.Any("version", m.Version),
+	}
+	if m.Error != nil {
+		attrs = append(attrs, slog.Group("error",
+			slog.String("code", m.Error.Code),
+			slog.Any("params", m.Error.MessageParams)))
+	}
+	if m.SRP != nil {
+		attrs = append(attrs, slog.Group("srp",
+			slog.String("stage", m.SRP.Stage),
+			slog.Int("securityLevel", m.SRP.SecurityLevel),
+			slog.String("I", m.SRP.I),
+			slog.String("A", m.SRP.A),
+			slog.String("B", m.SRP.B),
+			slog.String("s", m.SRP.S),
+			secretString("M", m.SRP.M),
+			secretString("M2", m.SRP.M2)))
+	}
+	if m.Key != nil {
+		attrs = append(attrs, slog.Group("key",
+			slog.Int("securityLevel", m.Key.SecurityLevel),
+			slog.String("username", m.Key.Username),
+			slog.String("sc", m.Key.SC),
+			slog.String("cc", m.Key.CC),
+			secretString("sr", m.Key.SR),
+			secretString("cr", m.Key.CR)))
+	}
+	if m.JSONRPC != nil {
+		attrs = append(attrs, slog.Group("jsonrpc",
+			slog.Int("length", len(m.JSONRPC.Message)),
+			secretString("hmac", string(m.JSONRPC.HMAC))))
+	}
+	if m.ClientID != "" {
+		attrs = append(attrs,
+			slog.String("clientTypeID", m.ClientID),
+			slog.String("clientDisplayName", m.ClientName))
+	}
+	if len(m.Features) > 0 {
+		attrs = append(attrs, slog.Any("features", m.Features))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// secretResults are the methods whose results are secret in their entirety.
+var secretResults = map[string]bool{
+	"GeneratePassword": true,
+}
+
+// rpcFrame is a decrypted JSON-RPC message, for logging. It's redacted only
+// if it's actually logged.
+type rpcFrame struct {
+	data   []byte
+	method string // of the call a response answers, if known
+}
+
+// LogValue implements slog.LogValuer, leaving out the values of password
+// fields, and the results of methods such as GeneratePassword.
+func (f rpcFrame) LogValue() slog.Value {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(f.data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return slog.StringValue("[unparseable, " + err.Error() + "]")
+	}
+	if msg, ok := v.(map[string]interface{}); ok {
+		method, _ := msg["method"].(string)
+		if method == "" {
+			method = f.method
+		}
+		if _, ok := msg["result"]; ok && secretResults[strings.TrimPrefix(method, "KPRPC.")] {
+			msg["result"] = redacted
+		}
+	}
+	redactFields(v)
+	out, err := json.Marshal(v)
+	if err != nil {
+		return slog.StringValue("[unprintable, " + err.Error() + "]")
+	}
+	return slog.StringValue(string(out))
+}
+
+// redactFields replaces the values of password form fields, wherever they
+// are in v, and of anything called a password.
+func redactFields(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if t, _ := v["type"].(string); t == "FFTpassword" {
+			if _, ok := v["value"]; ok {
+				v["value"] = redacted
+			}
+		}
+		for k, child := range v {
+			if strings.EqualFold(k, "password") {
+				v[k] = redacted
+				continue
+			}
+			redactFields(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			redactFields(child)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package keepassrpc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRPCFrameRedaction(t *testing.T) {
+	for _, tc := range []struct {
+		frame  rpcFrame
+		secret string
+		keep   string
+	}{
+		{rpcFrame{data: []byte(`{"id":1,"result":[{"fields":[{"type":"FFTusername","value":"bob"},{"type":"FFTpassword","value":"hunter2"}]}]}`)}, "hunter2", "bob"},
+		{rpcFrame{data: []byte(`{"method":"KPRPC.AddLogin","params":[{"formFieldList":[{"value":"hunter2","type":"FFTpassword"}]}],"id":2}`)}, "hunter2", "AddLogin"},
+		{rpcFrame{data: []byte(`{"id":3,"result":"hunter2","error":null}`), method: "KPRPC.GeneratePassword"}, "hunter2", `"id":3`},
+		{rpcFrame{data: []byte(`{"id":4,"result":{"Password":"hunter2","title":"x"}}`)}, "hunter2", "title"},
+	} {
+		got := tc.frame.LogValue().String()
+		if strings.Contains(got, tc.secret) || !strings.Contains(got, tc.keep) {
+			t.Errorf("%s logged as %s", tc.frame.data, got)
+		}
+	}
+}
+
+func TestMessageLogValue(t *testing.T) {
+	msg := &Message{
+		Protocol: "setup",
+		SRP:      &MsgSRP{Stage: "proofToServer", M: "deadbeef"},
+		Key:      &MsgKey{SC: "challenge", CR: "cafef00d"},
+		JSONRPC:  &MsgJSONRPC{Message: []byte("ciphertext"), HMAC: []byte("0123456789")},
+	}
+	got := msg.LogValue().String()
+	for _, secret := range []string{"deadbeef", "cafef00d", "ciphertext", "0123456789"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("message logged as %s, revealing %s", got, secret)
+		}
+	}
+	if !strings.Contains(got, "proofToServer") || !strings.Contains(got, "challenge") {
+		t.Errorf("message logged as %s", got)
+	}
+}
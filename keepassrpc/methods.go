@@ -0,0 +1,176 @@
+package keepassrpc
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// boundMethods lists every JSON-RPC method the Client bindings call. Keep it
+// in step with the calls in this package; TestBoundMethods checks that it is.
+var boundMethods = []string{
+	"AddEntry",
+	"AddGroup",
+	"AddLogin",
+	"ChangeDatabase",
+	"ChangeLocation",
+	"CountLogins",
+	"FindEntries",
+	"FindGroups",
+	"FindLogins",
+	"GeneratePassword",
+	"GetAllDatabases",
+	"GetAllLogins",
+	"GetApplicationMetadata",
+	"GetChildEntries",
+	"GetChildGroups",
+	"GetCurrentKFConfig",
+	"GetDatabaseFileName",
+	"GetDatabaseName",
+	"GetParent",
+	"GetPasswordProfiles",
+	"GetRoot",
+	"LaunchGroupEditor",
+	"LaunchLoginEditor",
+	"RemoveEntry",
+	"RemoveGroup",
+	"UpdateEntry",
+	"UpdateLogin",
+	"system.about",
+	"system.listMethods",
+	"system.version",
+}
+
+// BoundMethods returns the names of the JSON-RPC methods the Client
+// bindings call, in sorted order.
+func BoundMethods() []string {
+	return append([]string(nil), boundMethods...)
+}
+
+// MethodReport compares the methods a server advertises with the ones our
+// bindings call.
+type MethodReport struct {
+	// Missing lists bound methods the server doesn't advertise.
+	Missing []string
+
+	// Misspelled maps bound methods the server doesn't advertise onto
+	// a similarly-named method it does, which we probably meant to call.
+	Misspelled map[string]string
+
+	// Unwrapped lists methods the server advertises which we have no
+	// binding for.
+	Unwrapped []string
+
+	// Skipped lists bound methods we didn't expect the server to offer,
+	// because it lacks the feature they depend on.
+	Skipped []string
+}
+
+// OK reports whether the bindings and the server agree completely.
+func (r *MethodReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Misspelled) == 0 && len(r.Unwrapped) == 0
+}
+
+// CompareMethods checks the bindings against the methods a server
+// advertises. Bound methods which depend on a feature for which has returns
+// false are skipped; a nil has assumes every feature is present.
+func CompareMethods(advertised []string, has func(feature string) bool) *MethodReport {
+	r := &MethodReport{Misspelled: map[string]string{}}
+
+	offered := map[string]bool{}
+	for _, m := range advertised {
+		offered[m] = true
+	}
+	bound := map[string]bool{}
+	for _, m := range boundMethods {
+		bound[m] = true
+	}
+
+	for _, m := range boundMethods {
+		if offered[m] {
+			continue
+		}
+		if f, ok := methodFeatures[m]; ok && has != nil && !has(f) {
+			r.Skipped = append(r.Skipped, m)
+			continue
+		}
+		if near := nearest(m, advertised, bound); near != "" {
+			r.Misspelled[m] = near
+			continue
+		}
+		r.Missing = append(r.Missing, m)
+	}
+
+	for _, m := range advertised {
+		if bound[m] {
+			continue
+		}
+		misspelt := false
+		for _, near := range r.Misspelled {
+			if near == m {
+				misspelt = true
+			}
+		}
+		if !misspelt {
+			r.Unwrapped = append(r.Unwrapped, m)
+		}
+	}
+	sort.Strings(r.Unwrapped)
+	return r
+}
+
+// nearest returns the advertised method, not itself bound, closest to name,
+// if any is close enough that name is probably a misspelling of it.
+func nearest(name string, advertised []string, bound map[string]bool) string {
+	best, bestDist := "", 3
+	for _, m := range advertised {
+		if bound[m] {
+			continue
+		}
+		d := editDistance(strings.ToLower(name), strings.ToLower(m))
+		if d < bestDist {
+			best, bestDist = m, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// CheckMethods compares the methods the server advertises, via
+// system.listMethods, with the Client bindings.
+func (c *Client) CheckMethods() (*MethodReport, error) {
+	return c.CheckMethodsContext(context.Background())
+}
+
+// CheckMethodsContext is like CheckMethods, but honors ctx for cancellation.
+func (c *Client) CheckMethodsContext(ctx context.Context) (*MethodReport, error) {
+	advertised, err := c.SystemListMethodsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	has := c.HasFeature
+	if c.Features() == nil {
+		has = nil
+	}
+	return CompareMethods(advertised, has), nil
+}
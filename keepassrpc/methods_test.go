@@ -0,0 +1,92 @@
+package keepassrpc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestBoundMethods checks boundMethods against the method names actually
+// passed to Client.call in this package.
+func TestBoundMethods(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := map[string]bool{}
+	ast.Inspect(pkgs["keepassrpc"], func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "call" {
+			return true
+		}
+		lit, ok := call.Args[1].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			t.Errorf("%s: method name isn't a string literal", fset.Position(call.Pos()))
+			return true
+		}
+		name, _ := strconv.Unquote(lit.Value)
+		called[name] = true
+		return true
+	})
+
+	var names []string
+	for name := range called {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, BoundMethods()) {
+		t.Errorf("methods called:\n%v\nboundMethods:\n%v", names, BoundMethods())
+	}
+}
+
+func TestCompareMethods(t *testing.T) {
+	advertised := append(BoundMethods(), "GetAllDataases", "ShinyNewMethod")
+	advertised = removeMethod(advertised, "GetAllDatabases")
+	advertised = removeMethod(advertised, "CountLogins")
+	advertised = removeMethod(advertised, "FindEntries")
+
+	r := CompareMethods(advertised, func(f string) bool { return f != FeatureDTOV2 })
+	if r.OK() {
+		t.Error("report is OK")
+	}
+	if !reflect.DeepEqual(r.Missing, []string{"CountLogins"}) {
+		t.Errorf("Missing = %v", r.Missing)
+	}
+	if !reflect.DeepEqual(r.Misspelled, map[string]string{"GetAllDatabases": "GetAllDataases"}) {
+		t.Errorf("Misspelled = %v", r.Misspelled)
+	}
+	if !reflect.DeepEqual(r.Unwrapped, []string{"ShinyNewMethod"}) {
+		t.Errorf("Unwrapped = %v", r.Unwrapped)
+	}
+	if !reflect.DeepEqual(r.Skipped, []string{"FindEntries"}) {
+		t.Errorf("Skipped = %v", r.Skipped)
+	}
+
+	if r := CompareMethods(BoundMethods(), nil); !r.OK() {
+		t.Errorf("report for an exact match is %+v", r)
+	}
+}
+
+func removeMethod(methods []string, name string) []string {
+	var out []string
+	for _, m := range methods {
+		if m != name {
+			out = append(out, m)
+		}
+	}
+	return out
+}
@@ -0,0 +1,186 @@
+package keepassrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Signal is an event KeePassRPC pushes to its clients, such as a database
+// being opened, saved or closed.
+type Signal int
+
+// Signals, numbered as KeePassRPC sends them
+const (
+	// SignalPleaseAuthenticate asks the client to (re)authenticate
+	SignalPleaseAuthenticate Signal = iota
+
+	// SignalCallbacksRegistered is obsolete, and no longer sent
+	SignalCallbacksRegistered
+
+	// SignalDatabaseOpening is sent before a database is opened
+	SignalDatabaseOpening
+
+	// SignalDatabaseOpen is sent once a database has been opened
+	SignalDatabaseOpen
+
+	// SignalDatabaseClosing is sent before a database is closed
+	SignalDatabaseClosing
+
+	// SignalDatabaseClosed is sent once a database has been closed
+	SignalDatabaseClosed
+
+	// SignalDatabaseSaving is sent before a database is saved
+	SignalDatabaseSaving
+
+	// SignalDatabaseSaved is sent once a database has been saved
+	SignalDatabaseSaved
+
+	// SignalDatabaseDeleting is sent before a database is deleted
+	SignalDatabaseDeleting
+
+	// SignalDatabaseDeleted is sent once a database has been deleted
+	SignalDatabaseDeleted
+
+	// SignalDatabaseSelected is sent when the user switches to another
+	// open database
+	SignalDatabaseSelected
+
+	// SignalExiting is sent when KeePass is shutting down
+	SignalExiting
+)
+
+var signalNames = [...]string{
+	"PLEASE_AUTHENTICATE",
+	"JSCALLBACKS_REGISTERED",
+	"DATABASE_OPENING",
+	"DATABASE_OPEN",
+	"DATABASE_CLOSING",
+	"DATABASE_CLOSED",
+	"DATABASE_SAVING",
+	"DATABASE_SAVED",
+	"DATABASE_DELETING",
+	"DATABASE_DELETED",
+	"DATABASE_SELECTED",
+	"EXITING",
+}
+
+func (s Signal) String() string {
+	if s >= 0 && int(s) < len(signalNames) {
+		return signalNames[s]
+	}
+	return fmt.Sprintf("Signal(%d)", int(s))
+}
+
+// signalMethod is the JSON-RPC method KeePassRPC calls to deliver a Signal
+const signalMethod = "KPRPCListener"
+
+// notification is a JSON-RPC request sent to us by the server, as opposed
+// to a response to one of our own calls.
+type notification struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// parseNotification returns the request in data, or nil if data is a
+// response (or anything else without a method).
+func parseNotification(data []byte) *notification {
+	var msg struct {
+		notification
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+	if msg.Method == "" || msg.Result != nil || msg.Error != nil {
+		return nil
+	}
+	return &msg.notification
+}
+
+// notifier delivers signals to the channels registered with Client.Notify.
+type notifier struct {
+	mu       sync.Mutex
+	handlers map[chan<- Signal][]Signal
+}
+
+// Notify causes the client to relay the given signals from KeePassRPC to
+// ch. If no signals are given, all signals are relayed. Like os/signal, the
+// client does not block sending to ch: the caller must ensure ch has enough
+// buffer space to keep up, or signals will be dropped.
+//
+// Calling Notify again with the same channel adds to its signals.
+func (c *Client) Notify(ch chan<- Signal, sigs ...Signal) {
+	if ch == nil {
+		panic("keepassrpc: Notify using nil channel")
+	}
+	n := &c.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.handlers == nil {
+		n.handlers = map[chan<- Signal][]Signal{}
+	}
+	cur, ok := n.handlers[ch]
+	switch {
+	case ok && cur == nil:
+		// already receiving everything
+	case len(sigs) == 0:
+		n.handlers[ch] = nil
+	default:
+		n.handlers[ch] = append(cur, sigs...)
+	}
+}
+
+// StopNotify stops relaying signals to ch. When it returns, no more signals
+// will be sent to ch.
+func (c *Client) StopNotify(ch chan<- Signal) {
+	n := &c.notifier
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.handlers, ch)
+}
+
+func (n *notifier) send(sig Signal) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch, sigs := range n.handlers {
+		if !wants(sigs, sig) {
+			continue
+		}
+		select {
+		case ch <- sig:
+		default:
+		}
+	}
+}
+
+func wants(sigs []Signal, sig Signal) bool {
+	if sigs == nil {
+		return true
+	}
+	for _, s := range sigs {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatchNotification delivers a request pushed to us by the server.
+// Methods we don't know are logged, when debugging, and otherwise ignored.
+func (c *Client) dispatchNotification(n *notification) error {
+	if n.Method != signalMethod {
+		c.logger().Debug("Ignoring unknown notification", "method", n.Method)
+		return nil
+	}
+	if len(n.Params) != 1 {
+		return fmt.Errorf("Invalid %s notification", signalMethod)
+	}
+	var sig Signal
+	if err := json.Unmarshal(n.Params[0], &sig); err != nil {
+		return fmt.Errorf("Invalid %s notification: %v", signalMethod, err)
+	}
+	c.notifier.send(sig)
+	return nil
+}
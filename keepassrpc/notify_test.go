@@ -0,0 +1,54 @@
+package keepassrpc_test
+
+import (
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestSignal(t *testing.T) {
+	srv := newServer(t)
+
+	c := dial(t, srv, "heidi")
+	defer c.Close()
+	saved := make(chan keepassrpc.Signal, 1)
+	c.Notify(saved, keepassrpc.SignalDatabaseSaved)
+	all := make(chan keepassrpc.Signal, 2)
+	c.Notify(all)
+
+	// Make sure the server has finished setting up the session.
+	if _, err := c.GetRoot(); err != nil {
+		t.Fatal("GetRoot:", err)
+	}
+	for _, sig := range []keepassrpc.Signal{keepassrpc.SignalDatabaseOpen, keepassrpc.SignalDatabaseSaved} {
+		if err := srv.Signal(sig); err != nil {
+			t.Fatal("Signal:", err)
+		}
+	}
+	// Signals are delivered in order with replies, so they've arrived once
+	// this call returns, and mustn't have been mistaken for its reply.
+	if _, err := c.GetRoot(); err != nil {
+		t.Fatal("GetRoot after signals:", err)
+	}
+
+	select {
+	case sig := <-saved:
+		if sig != keepassrpc.SignalDatabaseSaved {
+			t.Errorf("got %v, want %v", sig, keepassrpc.SignalDatabaseSaved)
+		}
+	default:
+		t.Error("no DATABASE_SAVED signal received")
+	}
+	if len(all) != 2 {
+		t.Errorf("got %d signals, want 2", len(all))
+	}
+
+	c.StopNotify(all)
+	srv.Signal(keepassrpc.SignalDatabaseClosed)
+	if _, err := c.GetRoot(); err != nil {
+		t.Fatal("GetRoot:", err)
+	}
+	if len(all) != 2 || len(saved) != 0 {
+		t.Error("signal delivered after StopNotify")
+	}
+}
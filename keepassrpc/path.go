@@ -0,0 +1,213 @@
+package keepassrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+/*
+
+Paths name groups and entries by the titles leading to them from the root
+group, separated by slashes, such as "Root/Work/GitHub/deploy-bot". A slash
+or backslash within a title is escaped with a backslash. A trailing slash
+means the path must name a group.
+
+KeePass doesn't require sibling titles to be distinct, so a path may be
+ambiguous; resolving one is an error rather than a guess.
+
+*/
+
+// ErrPathNotFound is returned when nothing has the requested path or UUID.
+var ErrPathNotFound = errors.New("keepassrpc: no such group or entry")
+
+// ErrAmbiguousPath is returned when several siblings share the title a path
+// resolves through.
+var ErrAmbiguousPath = errors.New("keepassrpc: ambiguous path")
+
+// EscapeTitle escapes a title for use as one element of a path.
+func EscapeTitle(title string) string {
+	if !strings.ContainsAny(title, `/\`) {
+		return title
+	}
+	var b strings.Builder
+	for _, r := range title {
+		if r == '/' || r == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// JoinPath builds a path from unescaped titles.
+func JoinPath(titles ...string) string {
+	escaped := make([]string, len(titles))
+	for i, t := range titles {
+		escaped[i] = EscapeTitle(t)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// SplitPath breaks a path into unescaped titles, reporting whether it ended
+// with a slash.
+func SplitPath(path string) (titles []string, dir bool, err error) {
+	var cur strings.Builder
+	escaped := false
+	for _, r := range path {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			titles = append(titles, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if escaped {
+		return nil, false, fmt.Errorf("path '%s' ends with an incomplete escape", path)
+	}
+	if cur.Len() == 0 && len(titles) > 0 {
+		return titles, true, nil
+	}
+	return append(titles, cur.String()), false, nil
+}
+
+// RootedTree is a Tree which can also say where its root is. *Client and
+// *CachedClient implement it.
+type RootedTree interface {
+	Tree
+	GetRootContext(ctx context.Context) (*Group, error)
+}
+
+// Resolver maps between paths and the groups and entries they name.
+type Resolver struct {
+	Tree RootedTree
+}
+
+// NewResolver returns a Resolver for the groups and entries in t.
+func NewResolver(t RootedTree) *Resolver {
+	return &Resolver{Tree: t}
+}
+
+// Resolve returns the group or entry named by path, with the other result
+// nil. The path of a returned group is filled in.
+func (r *Resolver) Resolve(ctx context.Context, path string) (*Group, *Entry, error) {
+	titles, dir, err := SplitPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := r.Tree.GetRootContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if titles[0] != root.Title {
+		return nil, nil, fmt.Errorf("%w: '%s' doesn't start with the root group '%s'",
+			ErrPathNotFound, path, root.Title)
+	}
+	root.Path = JoinPath(root.Title)
+
+	g := root
+	for i, title := range titles[1:] {
+		last := i == len(titles)-2
+		groups, err := r.Tree.GetChildGroupsContext(ctx, g.UniqueID)
+		if err != nil {
+			return nil, nil, err
+		}
+		var entries []Entry
+		if last && !dir {
+			if entries, err = r.Tree.GetChildEntriesContext(ctx, g.UniqueID); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		var group *Group
+		var entry *Entry
+		n := 0
+		for j := range groups {
+			if groups[j].Title == title {
+				group = &groups[j]
+				n++
+			}
+		}
+		for j := range entries {
+			if entries[j].Title == title {
+				entry = &entries[j]
+				n++
+			}
+		}
+
+		sofar := JoinPath(titles[:i+2]...)
+		switch {
+		case n == 0:
+			return nil, nil, fmt.Errorf("%w: '%s'", ErrPathNotFound, sofar)
+		case n > 1:
+			return nil, nil, fmt.Errorf("%w: %d groups and entries are named '%s'",
+				ErrAmbiguousPath, n, sofar)
+		case group == nil:
+			return nil, entry, nil
+		}
+		group.Path = sofar
+		g = group
+	}
+	return g, nil, nil
+}
+
+// PathOf returns the path of the group or entry with the given UUID.
+func (r *Resolver) PathOf(ctx context.Context, uuid string) (string, error) {
+	paths, err := r.PathsOf(ctx, uuid)
+	if err != nil {
+		return "", err
+	}
+	return paths[uuid], nil
+}
+
+// PathsOf is like PathOf, but finds the paths of several UUIDs with a
+// single walk of the tree. If any of them can't be found, it returns the
+// paths it did find, along with an error wrapping ErrPathNotFound.
+func (r *Resolver) PathsOf(ctx context.Context, uuids ...string) (map[string]string, error) {
+	paths := map[string]string{}
+	if len(uuids) == 0 {
+		return paths, nil
+	}
+	wanted := map[string]bool{}
+	for _, u := range uuids {
+		wanted[u] = true
+	}
+
+	root, err := r.Tree.GetRootContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var prefixes []string
+	err = Walk(ctx, r.Tree, root, func(n *Node) error {
+		if n.Entry != nil {
+			if wanted[n.Entry.UniqueID] {
+				paths[n.Entry.UniqueID] = JoinPath(append(prefixes[:n.Depth:n.Depth], n.Entry.Title)...)
+			}
+		} else {
+			prefixes = append(prefixes[:n.Depth], n.Group.Title)
+			if wanted[n.Group.UniqueID] {
+				paths[n.Group.UniqueID] = JoinPath(prefixes...)
+			}
+		}
+		if len(paths) == len(wanted) {
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range uuids {
+		if _, ok := paths[u]; !ok {
+			return paths, fmt.Errorf("%w: UUID %s", ErrPathNotFound, u)
+		}
+	}
+	return paths, nil
+}
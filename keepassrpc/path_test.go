@@ -0,0 +1,103 @@
+package keepassrpc_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		titles []string
+		dir    bool
+	}{
+		{"Root", []string{"Root"}, false},
+		{"Root/", []string{"Root"}, true},
+		{"Root/Work/GitHub", []string{"Root", "Work", "GitHub"}, false},
+		{`Root/a\/b/c\\d`, []string{"Root", "a/b", `c\d`}, false},
+		{`Root/trailing\/`, []string{"Root", "trailing/"}, false},
+	}
+	for _, tt := range tests {
+		titles, dir, err := keepassrpc.SplitPath(tt.path)
+		if err != nil {
+			t.Errorf("SplitPath(%q): %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(titles, tt.titles) || dir != tt.dir {
+			t.Errorf("SplitPath(%q) = %q, %v; want %q, %v", tt.path, titles, dir, tt.titles, tt.dir)
+		}
+		if !tt.dir {
+			if p := keepassrpc.JoinPath(titles...); p != tt.path {
+				t.Errorf("JoinPath(%q) = %q, want %q", titles, p, tt.path)
+			}
+		}
+	}
+
+	if _, _, err := keepassrpc.SplitPath(`Root/oops\`); err == nil {
+		t.Error("SplitPath accepted an incomplete escape")
+	}
+}
+
+func TestResolver(t *testing.T) {
+	srv := newServer(t)
+	root := srv.Root()
+	work := srv.AddGroup(root.UniqueID, "Work")
+	github := srv.AddGroup(work.UniqueID, "Git/Hub")
+	bot := srv.AddEntry(github.UniqueID, keepassrpc.Entry{Title: "deploy-bot"})
+	srv.AddGroup(root.UniqueID, "Twins")
+	srv.AddGroup(root.UniqueID, "Twins")
+
+	c := dial(t, srv, "zoe")
+	defer c.Close()
+	r := keepassrpc.NewResolver(c)
+	ctx := context.Background()
+
+	botPath := root.Title + `/Work/Git\/Hub/deploy-bot`
+	g, e, err := r.Resolve(ctx, botPath)
+	if err != nil {
+		t.Fatal("Resolve:", err)
+	}
+	if g != nil || e == nil || e.UniqueID != bot.UniqueID {
+		t.Errorf("Resolve(%q) = %v, %v; want entry %s", botPath, g, e, bot.UniqueID)
+	}
+
+	g, e, err = r.Resolve(ctx, root.Title+`/Work/Git\/Hub/`)
+	if err != nil {
+		t.Fatal("Resolve:", err)
+	}
+	if e != nil || g == nil || g.UniqueID != github.UniqueID {
+		t.Errorf("got %v, %v; want group %s", g, e, github.UniqueID)
+	} else if want := root.Title + `/Work/Git\/Hub`; g.Path != want {
+		t.Errorf("got path %q, want %q", g.Path, want)
+	}
+
+	if _, _, err := r.Resolve(ctx, botPath+"/"); !errors.Is(err, keepassrpc.ErrPathNotFound) {
+		t.Errorf("resolving an entry as a group: got %v, want ErrPathNotFound", err)
+	}
+	if _, _, err := r.Resolve(ctx, root.Title+"/Play"); !errors.Is(err, keepassrpc.ErrPathNotFound) {
+		t.Errorf("got %v, want ErrPathNotFound", err)
+	}
+	if _, _, err := r.Resolve(ctx, root.Title+"/Twins"); !errors.Is(err, keepassrpc.ErrAmbiguousPath) {
+		t.Errorf("got %v, want ErrAmbiguousPath", err)
+	}
+
+	paths, err := r.PathsOf(ctx, bot.UniqueID, work.UniqueID, root.UniqueID)
+	if err != nil {
+		t.Fatal("PathsOf:", err)
+	}
+	want := map[string]string{
+		bot.UniqueID:  botPath,
+		work.UniqueID: root.Title + "/Work",
+		root.UniqueID: root.Title,
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got %v, want %v", paths, want)
+	}
+	if _, err := r.PathOf(ctx, "no-such-uuid"); !errors.Is(err, keepassrpc.ErrPathNotFound) {
+		t.Errorf("got %v, want ErrPathNotFound", err)
+	}
+}
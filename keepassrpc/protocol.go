@@ -1,10 +1,8 @@
 package keepassrpc
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
-	"strings"
+	"context"
+	"log/slog"
 
 	"github.com/gorilla/websocket"
 )
@@ -40,45 +38,30 @@ type Message struct {
 
 // ReadMessage reads a message from the server and JSON-decodes it
 func ReadMessage(h *websocket.Conn) (*Message, error) {
+	return readMessage(defaultLogger(), h)
+}
+
+func readMessage(log *slog.Logger, h *websocket.Conn) (*Message, error) {
 	var data Message
-	if DebugClient {
-		_, msg, err := h.ReadMessage()
-		if err != nil {
-			return nil, err
-		}
-		log.Println("<<<", string(msg))
-		if err := json.Unmarshal(msg, &data); err != nil {
-			return nil, err
-		}
-	} else {
-		if err := h.ReadJSON(&data); err != nil {
-			return nil, err
-		}
+	if err := h.ReadJSON(&data); err != nil {
+		return nil, err
 	}
-
+	log.Log(context.Background(), LevelTransport, "<<<", "message", &data)
 	return &data, nil
 }
 
 // WriteMessage JSON-encodes a KeePassRPC message and sends it to the server
 func WriteMessage(h *websocket.Conn, msg *Message) error {
-	if DebugClient {
-		out, err := json.Marshal(msg)
-		if err != nil {
-			return err
-		}
-		log.Println(">>>", string(out))
-		if err := h.WriteMessage(websocket.TextMessage, out); err != nil {
-			return err
-		}
-	} else {
-		if err := h.WriteJSON(&msg); err != nil {
-			return err
-		}
-	}
-	return nil
+	return writeMessage(defaultLogger(), h, msg)
+}
+
+func writeMessage(log *slog.Logger, h *websocket.Conn, msg *Message) error {
+	log.Log(context.Background(), LevelTransport, ">>>", "message", msg)
+	return h.WriteJSON(msg)
 }
 
-// DispatchError handles error protocol packets from the server
+// DispatchError handles error protocol packets from the server, returning
+// them as a *ProtocolError
 func DispatchError(err *MsgError) error {
-	return fmt.Errorf("%s: %s", err.Code, strings.Join(err.MessageParams, "\n"))
+	return &ProtocolError{Code: err.Code, Params: err.MessageParams}
 }
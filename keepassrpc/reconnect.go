@@ -0,0 +1,190 @@
+package keepassrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrConnectionLost is returned by a call which changes the database (or
+// otherwise has side effects) when the connection to KeePassRPC broke before
+// its reply arrived. The call may or may not have taken effect. If the client
+// reconnects automatically, it has already tried to do so, and the call may be
+// retried once the caller has checked whether that's safe.
+var ErrConnectionLost = errors.New("keepassrpc: connection lost; call may not have completed")
+
+// ReconnectPolicy controls how a Client re-establishes a broken connection.
+// Zero fields take their defaults.
+type ReconnectPolicy struct {
+	// InitialDelay is the wait between the first and second attempts to
+	// reconnect; it doubles after every failure. The first attempt is
+	// made immediately. Defaults to 250ms.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the wait between attempts. Defaults to 10s.
+	MaxDelay time.Duration
+
+	// MaxAttempts is how many times to try reconnecting before giving up
+	// and returning the last error. Defaults to 6.
+	MaxAttempts int
+}
+
+func (p *ReconnectPolicy) initialDelay() time.Duration {
+	if p.InitialDelay > 0 {
+		return p.InitialDelay
+	}
+	return 250 * time.Millisecond
+}
+
+func (p *ReconnectPolicy) maxDelay() time.Duration {
+	if p.MaxDelay > 0 {
+		return p.MaxDelay
+	}
+	return 10 * time.Second
+}
+
+func (p *ReconnectPolicy) maxAttempts() int {
+	if p.MaxAttempts > 0 {
+		return p.MaxAttempts
+	}
+	return 6
+}
+
+// idempotentMethods are the calls which only read state, and so are safe to
+// repeat after a reconnection without asking the caller.
+var idempotentMethods = map[string]bool{
+	"CountLogins":            true,
+	"FindEntries":            true,
+	"FindGroups":             true,
+	"FindLogins":             true,
+	"GeneratePassword":       true,
+	"GetAllDatabases":        true,
+	"GetAllLogins":           true,
+	"GetApplicationMetadata": true,
+	"GetChildEntries":        true,
+	"GetChildGroups":         true,
+	"GetCurrentKFConfig":     true,
+	"GetDatabaseFileName":    true,
+	"GetDatabaseName":        true,
+	"GetParent":              true,
+	"GetPasswordProfiles":    true,
+	"GetRoot":                true,
+	"system.about":           true,
+	"system.listMethods":     true,
+	"system.version":         true,
+}
+
+// brokenTransport reports whether err, returned by a call, means the
+// connection itself failed, rather than the server rejecting the call or its
+// reply being malformed. net/rpc reports a connection which ends mid-reply as
+// io.ErrUnexpectedEOF.
+func brokenTransport(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	return errors.Is(err, ErrClosed) || errors.Is(err, rpc.ErrShutdown) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &closeErr) || errors.As(err, &netErr)
+}
+
+// session returns the JSON-RPC client for the current connection, along
+// with its generation, which changes every time we reconnect.
+func (c *Client) session() (*rpc.Client, int, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.JSONRPCCtx == nil {
+		return nil, c.generation, ErrClosed
+	}
+	return c.JSONRPCCtx.r, c.generation, nil
+}
+
+// reconnect replaces the connection of the given generation with a new one,
+// unless that has already happened. Other calls wait until it's done, but
+// Close interrupts it. A session key the server rejects fails with
+// ErrKeyRejected rather than pairing again, which needs the user.
+func (c *Client) reconnect(ctx context.Context, generation int) error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	if c.generation != generation && c.JSONRPCCtx != nil {
+		return nil
+	}
+	if c.JSONRPCCtx != nil {
+		c.JSONRPCCtx.r.Close()
+		c.JSONRPCCtx = nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closing():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	policy := c.opts.Reconnect
+	delay := policy.initialDelay()
+	for attempt := 1; ; attempt++ {
+		err := c.redial(ctx)
+		if err == nil {
+			c.generation++
+			if c.closed.Load() {
+				c.JSONRPCCtx.r.Close()
+				return ErrClosed
+			}
+			return nil
+		}
+		c.logger().WarnContext(ctx, "Reconnection failed", "attempt", attempt, "error", err)
+		if c.closed.Load() {
+			return ErrClosed
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrKeyRejected) || attempt >= policy.maxAttempts() {
+			return err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			if c.closed.Load() {
+				return ErrClosed
+			}
+			return ctx.Err()
+		}
+		if delay *= 2; delay > policy.maxDelay() {
+			delay = policy.maxDelay()
+		}
+	}
+}
+
+// redial opens a new websocket and authenticates on it with the session key
+// we already have.
+func (c *Client) redial(ctx context.Context) error {
+	wsc, _, err := c.opts.dialer().DialContext(ctx, c.url(), c.opts.Header)
+	if err != nil {
+		return err
+	}
+	c.WS = wsc
+	if err := c.establishSessionContext(ctx, false); err != nil {
+		wsc.Close()
+		c.JSONRPCCtx = nil
+		return err
+	}
+	return nil
+}
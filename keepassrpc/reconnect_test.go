@@ -0,0 +1,160 @@
+package keepassrpc_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestReconnect(t *testing.T) {
+	srv := newServer(t)
+
+	key, _ := keepassrpc.GenKey(32)
+	srv.Authorize("ivan", key)
+	pwd := func() (string, error) {
+		return "", errors.New("unexpected pairing prompt")
+	}
+	opts := &keepassrpc.Options{
+		URL:       srv.URL,
+		Reconnect: &keepassrpc.ReconnectPolicy{InitialDelay: time.Millisecond},
+	}
+	c, err := keepassrpc.Dial(context.Background(), opts, "ivan", key, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+
+	srv.Disconnect()
+	if _, err := c.GetRoot(); err != nil {
+		t.Fatal("GetRoot after disconnect:", err)
+	}
+
+	srv.Disconnect()
+	_, err = c.AddGroup("after", "")
+	if err != keepassrpc.ErrConnectionLost {
+		t.Fatalf("AddGroup after disconnect returned %v, want %v", err, keepassrpc.ErrConnectionLost)
+	}
+	if _, err := c.AddGroup("after", ""); err != nil {
+		t.Fatal("AddGroup retry:", err)
+	}
+
+	srv.FailMethod("GetRoot", errors.New("database locked"))
+	if _, err := c.GetRoot(); err == nil || err == keepassrpc.ErrConnectionLost {
+		t.Errorf("server error came back as %v", err)
+	}
+}
+
+func TestReconnectGiveUp(t *testing.T) {
+	srv := newServer(t)
+	opts := &keepassrpc.Options{
+		URL:       srv.URL,
+		Reconnect: &keepassrpc.ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3},
+	}
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(), opts, "judy", nil, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+
+	srv.Close()
+	if _, err := c.GetRoot(); err == nil {
+		t.Fatal("GetRoot succeeded with the server gone")
+	}
+	if _, err := c.GetRoot(); err == nil {
+		t.Fatal("second GetRoot succeeded with the server gone")
+	}
+}
+
+func TestReconnectOnce(t *testing.T) {
+	srv := newServer(t)
+	opts := &keepassrpc.Options{
+		URL:       srv.URL,
+		Reconnect: &keepassrpc.ReconnectPolicy{InitialDelay: time.Millisecond},
+	}
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(), opts, "kim", nil, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+
+	var calls atomic.Int32
+	srv.OnCall(func(method string) error {
+		if method == "GetRoot" {
+			calls.Add(1)
+			srv.Disconnect()
+		}
+		return nil
+	})
+	if _, err := c.GetRoot(); err == nil {
+		t.Fatal("GetRoot succeeded with every connection dropped")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("GetRoot sent %d times, want 2", n)
+	}
+}
+
+func TestReconnectKeyRejected(t *testing.T) {
+	srv := newServer(t)
+	key, _ := keepassrpc.GenKey(32)
+	srv.Authorize("lena", key)
+	pwd := func() (string, error) {
+		t.Error("asked for a pairing code while reconnecting")
+		return srv.PairingCode, nil
+	}
+	opts := &keepassrpc.Options{
+		URL:       srv.URL,
+		Reconnect: &keepassrpc.ReconnectPolicy{InitialDelay: time.Millisecond},
+	}
+	c, err := keepassrpc.Dial(context.Background(), opts, "lena", key, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+	defer c.Close()
+
+	srv.Revoke("lena")
+	srv.Disconnect()
+	if _, err := c.GetRoot(); !errors.Is(err, keepassrpc.ErrKeyRejected) {
+		t.Errorf("GetRoot after revocation returned %v, want %v", err, keepassrpc.ErrKeyRejected)
+	}
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	srv := newServer(t)
+	opts := &keepassrpc.Options{
+		URL:       srv.URL,
+		Reconnect: &keepassrpc.ReconnectPolicy{InitialDelay: time.Hour},
+	}
+	pwd := func() (string, error) { return srv.PairingCode, nil }
+	c, err := keepassrpc.Dial(context.Background(), opts, "mona", nil, pwd)
+	if err != nil {
+		t.Fatal("Dial:", err)
+	}
+
+	srv.Close()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.GetRoot()
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked while reconnecting")
+	}
+	if err := <-errc; !errors.Is(err, keepassrpc.ErrClosed) {
+		t.Errorf("GetRoot returned %v, want %v", err, keepassrpc.ErrClosed)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package secret
+
+// alloc allocates a secret of n bytes on the heap, as this platform offers
+// us nothing better.
+func alloc(n int) (mem []byte, mapped, locked bool) {
+	return make([]byte, n), false, false
+}
+
+// free wipes memory from alloc.
+func free(mem []byte, mapped, locked bool) {
+	clear(mem)
+}
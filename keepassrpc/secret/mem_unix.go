@@ -0,0 +1,35 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package secret
+
+import (
+	"os"
+	"syscall"
+)
+
+// alloc maps fresh pages for a secret of n bytes, and tries to lock them
+// into RAM. Locking can fail if we're over RLIMIT_MEMLOCK, in which case the
+// secret is still kept off the heap; if even mapping fails, it falls back to
+// the heap.
+func alloc(n int) (mem []byte, mapped, locked bool) {
+	page := os.Getpagesize()
+	size := (max(n, 1) + page - 1) / page * page
+	mem, err := syscall.Mmap(-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, n), false, false
+	}
+	return mem, true, syscall.Mlock(mem) == nil
+}
+
+// free wipes and releases memory from alloc.
+func free(mem []byte, mapped, locked bool) {
+	clear(mem)
+	if !mapped {
+		return
+	}
+	if locked {
+		syscall.Munlock(mem)
+	}
+	syscall.Munmap(mem)
+}
@@ -0,0 +1,217 @@
+// Package secret holds passwords and keys outside of the garbage-collected
+// heap, where they can't be swapped out or copied around, and can be wiped as
+// soon as they're no longer needed.
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"runtime"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// redacted is what a Value shows in place of its contents.
+const redacted = "[REDACTED]"
+
+var (
+	errNotString = errors.New("secret: JSON value is not a string")
+	errBadEscape = errors.New("secret: bad escape in JSON string")
+)
+
+// Value is a secret, such as a password or session key. Its contents live
+// in memory which, where the platform allows, is locked into RAM, and which
+// is wiped by Destroy. Formatting a Value with fmt, encoding it as JSON or
+// logging it with slog shows only a placeholder.
+//
+// A Value must not be used concurrently with its Destroy.
+type Value struct {
+	mem    []byte // the whole allocation, from alloc
+	n      int    // how much of mem holds the secret
+	mapped bool   // mem is off the heap
+	locked bool   // mem is locked into RAM
+}
+
+// New returns a Value holding a copy of b, and wipes b.
+func New(b []byte) *Value {
+	v := newValue(b)
+	clear(b)
+	return v
+}
+
+// newValue returns a Value holding a copy of b.
+func newValue(b []byte) *Value {
+	v := &Value{n: len(b)}
+	v.mem, v.mapped, v.locked = alloc(len(b))
+	copy(v.mem, b)
+	runtime.SetFinalizer(v, (*Value).Destroy)
+	return v
+}
+
+// FromString returns a Value holding a copy of s. Strings can't be wiped,
+// so prefer New where the secret is available as a byte slice.
+func FromString(s string) *Value {
+	return New([]byte(s))
+}
+
+// Bytes returns the secret itself, which remains valid until Destroy. The
+// caller must not keep it any longer, or copy it anywhere it can't wipe.
+func (v *Value) Bytes() []byte {
+	if v == nil || v.mem == nil {
+		return nil
+	}
+	return v.mem[:v.n:v.n]
+}
+
+// Clone returns a new Value holding a copy of the secret, to be destroyed
+// separately.
+func (v *Value) Clone() *Value {
+	return newValue(v.Bytes())
+}
+
+// Len returns the length of the secret.
+func (v *Value) Len() int {
+	if v == nil || v.mem == nil {
+		return 0
+	}
+	return v.n
+}
+
+// Locked reports whether the secret is held in memory locked into RAM.
+func (v *Value) Locked() bool {
+	return v != nil && v.locked
+}
+
+// Destroy wipes the secret and releases its memory. It is safe to call more
+// than once, or on a nil Value.
+func (v *Value) Destroy() {
+	if v == nil || v.mem == nil {
+		return
+	}
+	free(v.mem, v.mapped, v.locked)
+	v.mem, v.n, v.mapped, v.locked = nil, 0, false, false
+	runtime.SetFinalizer(v, nil)
+}
+
+// String implements fmt.Stringer without revealing the secret.
+func (v *Value) String() string {
+	return redacted
+}
+
+// GoString implements fmt.GoStringer without revealing the secret.
+func (v *Value) GoString() string {
+	return redacted
+}
+
+// MarshalJSON encodes the placeholder in place of the secret.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// UnmarshalJSON decodes a JSON string straight into the Value's own memory,
+// so that the secret isn't left on the heap. As the Value may need a
+// finalizer, it must be allocated by itself, not as part of another struct.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errNotString
+	}
+	data = data[1 : len(data)-1]
+
+	// Unescaping never makes a string longer.
+	mem, mapped, locked := alloc(len(data))
+	n, err := unquote(mem, data)
+	if err != nil {
+		free(mem, mapped, locked)
+		return err
+	}
+	v.Destroy()
+	v.mem, v.n, v.mapped, v.locked = mem, n, mapped, locked
+	runtime.SetFinalizer(v, (*Value).Destroy)
+	return nil
+}
+
+// LogValue implements slog.LogValuer without revealing the secret.
+func (v *Value) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// unquote decodes the body of a JSON string from src into dst, which must be
+// at least as long, and returns how many bytes it wrote. It works byte by
+// byte, so that no part of the secret is copied anywhere else.
+func unquote(dst, src []byte) (int, error) {
+	n := 0
+	for i := 0; i < len(src); {
+		if src[i] != '\\' {
+			dst[n] = src[i]
+			n++
+			i++
+			continue
+		}
+		if i+1 == len(src) {
+			return 0, errBadEscape
+		}
+		c := src[i+1]
+		i += 2
+		switch c {
+		case '"', '\\', '/':
+		case 'b':
+			c = '\b'
+		case 'f':
+			c = '\f'
+		case 'n':
+			c = '\n'
+		case 'r':
+			c = '\r'
+		case 't':
+			c = '\t'
+		case 'u':
+			r, ok := hex4(src[i:])
+			if !ok {
+				return 0, errBadEscape
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				// Half of a pair, which needs the other half.
+				d := utf8.RuneError
+				if len(src[i:]) >= 6 && src[i] == '\\' && src[i+1] == 'u' {
+					if r2, ok := hex4(src[i+2:]); ok {
+						if d = utf16.DecodeRune(r, r2); d != utf8.RuneError {
+							i += 6
+						}
+					}
+				}
+				r = d
+			}
+			n += utf8.EncodeRune(dst[n:], r)
+			continue
+		default:
+			return 0, errBadEscape
+		}
+		dst[n] = c
+		n++
+	}
+	return n, nil
+}
+
+// hex4 decodes the four hex digits at the start of b.
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
@@ -0,0 +1,99 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	in := []byte("hunter2")
+	v := New(in)
+	if !bytes.Equal(in, make([]byte, len(in))) {
+		t.Error("New() didn't wipe its input")
+	}
+	if string(v.Bytes()) != "hunter2" || v.Len() != 7 {
+		t.Errorf("Bytes() = %q, Len() = %d", v.Bytes(), v.Len())
+	}
+
+	// The memory itself is unmapped by Destroy, so can't be checked.
+	v.Destroy()
+	if v.Bytes() != nil || v.Len() != 0 {
+		t.Error("Value still usable after Destroy()")
+	}
+	v.Destroy()
+	(*Value)(nil).Destroy()
+}
+
+func TestRedaction(t *testing.T) {
+	v := FromString("hunter2")
+	defer v.Destroy()
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x"} {
+		if s := fmt.Sprintf(format, v); strings.Contains(s, "hunter2") || strings.Contains(s, fmt.Sprintf("%x", "hunter2")) {
+			t.Errorf("Sprintf(%q) revealed the secret: %s", format, s)
+		}
+	}
+	wrapped := struct{ Password *Value }{v}
+	if s := fmt.Sprintf("%+v", wrapped); strings.Contains(s, "hunter2") {
+		t.Errorf("formatting a struct revealed the secret: %s", s)
+	}
+
+	js, err := json.Marshal(wrapped)
+	if err != nil {
+		t.Fatal("Marshal:", err)
+	}
+	if strings.Contains(string(js), "hunter2") {
+		t.Errorf("JSON revealed the secret: %s", js)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("login", "password", v)
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Errorf("slog revealed the secret: %s", buf.String())
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	for _, js := range []string{
+		`""`,
+		`"hunter2"`,
+		`"quote \" backslash \\ slash \/ / controls \b\f\n\r\t"`,
+		`"ünïcødé \u00fc \u2603 \ud83d\udd11 \u0000"`,
+		`"lone \ud800 surrogate \udc00\u0041"`,
+	} {
+		var want string
+		if err := json.Unmarshal([]byte(js), &want); err != nil {
+			t.Fatal("Unmarshal:", err)
+		}
+		var wrapped struct{ Password *Value }
+		if err := json.Unmarshal([]byte(`{"Password":`+js+`}`), &wrapped); err != nil {
+			t.Errorf("%s: %v", js, err)
+			continue
+		}
+		if got := string(wrapped.Password.Bytes()); got != want {
+			t.Errorf("%s decoded as %q, want %q", js, got, want)
+		}
+		wrapped.Password.Destroy()
+	}
+
+	var v Value
+	for _, bad := range []string{`42`, `"\x"`, `"\u12"`, `"trailing \"`} {
+		if err := v.UnmarshalJSON([]byte(bad)); err == nil {
+			t.Errorf("%s decoded as %q", bad, v.Bytes())
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	v := FromString("hunter2")
+	c := v.Clone()
+	v.Destroy()
+	if string(c.Bytes()) != "hunter2" {
+		t.Errorf("clone holds %q after its original was destroyed", c.Bytes())
+	}
+	c.Destroy()
+}
@@ -0,0 +1,819 @@
+package keepassrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/rpc"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gorilla/websocket"
+	"github.com/logic/gkp/keepassrpc/jsonrpc"
+)
+
+// ErrNotImplemented is returned by Backend methods which aren't supported.
+var ErrNotImplemented = errors.New("keepassrpc: method not implemented")
+
+// Backend answers the JSON-RPC calls accepted by a Server. The context passed
+// to each method is cancelled when the client disconnects.
+type Backend interface {
+	GetRoot(ctx context.Context) (*Group, error)
+	GetParent(ctx context.Context, uuid string) (*Group, error)
+	GetChildGroups(ctx context.Context, uuid string) ([]Group, error)
+	GetChildEntries(ctx context.Context, uuid string) ([]Entry, error)
+	GetAllLogins(ctx context.Context) ([]Entry, error)
+	FindLogins(ctx context.Context, s *Search) ([]Entry, error)
+	AddLogin(ctx context.Context, login *Entry, parentUUID, dbFileName string) (*Entry, error)
+	UpdateLogin(ctx context.Context, login *Entry, oldLoginUUID string, urlMergeMode int, dbFileName string) (*Entry, error)
+	RemoveEntry(ctx context.Context, uuid string) (bool, error)
+	AddGroup(ctx context.Context, name, parentUUID string) (*Group, error)
+	RemoveGroup(ctx context.Context, uuid string) (bool, error)
+
+	FindEntries(ctx context.Context, s *Search) ([]Entry2, error)
+	AddEntry(ctx context.Context, entry *Entry2, parentUUID, dbFileName string) (*Entry2, error)
+	UpdateEntry(ctx context.Context, entry *Entry2, oldUUID string, urlMergeMode int, dbFileName string) (*Entry2, error)
+
+	GetDatabaseName(ctx context.Context) (string, error)
+	GetDatabaseFileName(ctx context.Context) (string, error)
+	GetAllDatabases(ctx context.Context, fullDetails bool) ([]Database, error)
+	ChangeDatabase(ctx context.Context, filename string, closeCurrent bool) error
+	ChangeLocation(ctx context.Context, locationID string) error
+	GetCurrentKFConfig(ctx context.Context) (*Configuration, error)
+	GetApplicationMetadata(ctx context.Context) (*ApplicationMetadata, error)
+	GetPasswordProfiles(ctx context.Context) ([]string, error)
+	GeneratePassword(ctx context.Context, profileName, url string) (string, error)
+	LaunchGroupEditor(ctx context.Context, uuid, dbFileName string) error
+	LaunchLoginEditor(ctx context.Context, uuid, dbFileName string) error
+}
+
+// UnimplementedBackend returns ErrNotImplemented from every Backend method.
+// Embed it in a Backend to only implement the methods you need.
+type UnimplementedBackend struct{}
+
+// GetRoot is unimplemented
+func (UnimplementedBackend) GetRoot(context.Context) (*Group, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetParent is unimplemented
+func (UnimplementedBackend) GetParent(context.Context, string) (*Group, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetChildGroups is unimplemented
+func (UnimplementedBackend) GetChildGroups(context.Context, string) ([]Group, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetChildEntries is unimplemented
+func (UnimplementedBackend) GetChildEntries(context.Context, string) ([]Entry, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetAllLogins is unimplemented
+func (UnimplementedBackend) GetAllLogins(context.Context) ([]Entry, error) {
+	return nil, ErrNotImplemented
+}
+
+// FindLogins is unimplemented
+func (UnimplementedBackend) FindLogins(context.Context, *Search) ([]Entry, error) {
+	return nil, ErrNotImplemented
+}
+
+// AddLogin is unimplemented
+func (UnimplementedBackend) AddLogin(context.Context, *Entry, string, string) (*Entry, error) {
+	return nil, ErrNotImplemented
+}
+
+// UpdateLogin is unimplemented
+func (UnimplementedBackend) UpdateLogin(context.Context, *Entry, string, int, string) (*Entry, error) {
+	return nil, ErrNotImplemented
+}
+
+// RemoveEntry is unimplemented
+func (UnimplementedBackend) RemoveEntry(context.Context, string) (bool, error) {
+	return false, ErrNotImplemented
+}
+
+// AddGroup is unimplemented
+func (UnimplementedBackend) AddGroup(context.Context, string, string) (*Group, error) {
+	return nil, ErrNotImplemented
+}
+
+// RemoveGroup is unimplemented
+func (UnimplementedBackend) RemoveGroup(context.Context, string) (bool, error) {
+	return false, ErrNotImplemented
+}
+
+// FindEntries is unimplemented
+func (UnimplementedBackend) FindEntries(context.Context, *Search) ([]Entry2, error) {
+	return nil, ErrNotImplemented
+}
+
+// AddEntry is unimplemented
+func (UnimplementedBackend) AddEntry(context.Context, *Entry2, string, string) (*Entry2, error) {
+	return nil, ErrNotImplemented
+}
+
+// UpdateEntry is unimplemented
+func (UnimplementedBackend) UpdateEntry(context.Context, *Entry2, string, int, string) (*Entry2, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetDatabaseName is unimplemented
+func (UnimplementedBackend) GetDatabaseName(context.Context) (string, error) {
+	return "", ErrNotImplemented
+}
+
+// GetDatabaseFileName is unimplemented
+func (UnimplementedBackend) GetDatabaseFileName(context.Context) (string, error) {
+	return "", ErrNotImplemented
+}
+
+// GetAllDatabases is unimplemented
+func (UnimplementedBackend) GetAllDatabases(context.Context, bool) ([]Database, error) {
+	return nil, ErrNotImplemented
+}
+
+// ChangeDatabase is unimplemented
+func (UnimplementedBackend) ChangeDatabase(context.Context, string, bool) error {
+	return ErrNotImplemented
+}
+
+// ChangeLocation is unimplemented
+func (UnimplementedBackend) ChangeLocation(context.Context, string) error {
+	return ErrNotImplemented
+}
+
+// GetCurrentKFConfig is unimplemented
+func (UnimplementedBackend) GetCurrentKFConfig(context.Context) (*Configuration, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetApplicationMetadata is unimplemented
+func (UnimplementedBackend) GetApplicationMetadata(context.Context) (*ApplicationMetadata, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetPasswordProfiles is unimplemented
+func (UnimplementedBackend) GetPasswordProfiles(context.Context) ([]string, error) {
+	return nil, ErrNotImplemented
+}
+
+// GeneratePassword is unimplemented
+func (UnimplementedBackend) GeneratePassword(context.Context, string, string) (string, error) {
+	return "", ErrNotImplemented
+}
+
+// LaunchGroupEditor is unimplemented
+func (UnimplementedBackend) LaunchGroupEditor(context.Context, string, string) error {
+	return ErrNotImplemented
+}
+
+// LaunchLoginEditor is unimplemented
+func (UnimplementedBackend) LaunchLoginEditor(context.Context, string, string) error {
+	return ErrNotImplemented
+}
+
+// KeyStore remembers the session keys negotiated with clients.
+type KeyStore interface {
+	// SessionKey returns the key stored for username, or nil if there
+	// is none.
+	SessionKey(username string) (*big.Int, error)
+
+	// SetSessionKey stores a freshly-negotiated key for username.
+	SetSessionKey(username string, key *big.Int) error
+}
+
+// Server accepts KeePassRPC clients and serves JSON-RPC calls from Backend.
+type Server struct {
+	Backend Backend
+	Keys    KeyStore
+
+	// PairingCode returns the password for a fresh SRP negotiation with
+	// the named client. Typically it generates a random code and shows
+	// it to the user, who then enters it into the client.
+	PairingCode func(clientName string) (string, error)
+
+	// Features, if set, returns the features to advertise to the named
+	// client; otherwise we advertise ServerFeatures.
+	Features func(clientName string) []string
+
+	// Upgrader is used by ServeHTTP. Note that the zero value rejects
+	// cross-origin requests, such as those from browser extensions.
+	Upgrader websocket.Upgrader
+
+	// Logger, if set, receives the server's logs, as Options.Logger does
+	// the client's. If nil, nothing is logged, unless DebugClient or
+	// DebugJSONRPC is set.
+	Logger *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[*JSONRPCHandle]bool
+	signalID uint64
+}
+
+// ServeHTTP upgrades the request to a websocket and serves it.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	s.ServeConn(r.Context(), ws)
+}
+
+// ServeConn authenticates the client on ws, and then serves its JSON-RPC
+// calls until it disconnects. The caller is responsible for closing ws.
+func (s *Server) ServeConn(ctx context.Context, ws *websocket.Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	log := s.logger()
+	sess := &serverSession{srv: s, ws: ws, log: log}
+	key, err := sess.handshake()
+	if err != nil {
+		return err
+	}
+
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("KeePassRPC", &rpcService{ctx: ctx, b: s.Backend}); err != nil {
+		return err
+	}
+	h := newJSONRPCHandle(ws, key, log, nil)
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = map[*JSONRPCHandle]bool{}
+	}
+	s.sessions[h] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, h)
+		s.mu.Unlock()
+	}()
+
+	srv.ServeCodec(jsonrpc.NewServiceCodec(h, serviceMethod))
+	return nil
+}
+
+// logger returns the logger to use, which is never nil.
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return defaultLogger()
+	}
+	return s.Logger
+}
+
+// Signal sends sig to every authenticated client, the way KeePassRPC
+// announces that a database has been opened, saved, closed and so on.
+func (s *Server) Signal(sig Signal) error {
+	type pending struct {
+		h  *JSONRPCHandle
+		id uint64
+	}
+	s.mu.Lock()
+	sessions := make([]pending, 0, len(s.sessions))
+	for h := range s.sessions {
+		s.signalID++
+		sessions = append(sessions, pending{h, s.signalID})
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, p := range sessions {
+		msg, err := json.Marshal(map[string]interface{}{
+			"id":     p.id,
+			"method": signalMethod,
+			"params": []Signal{sig},
+		})
+		if err == nil {
+			_, err = p.h.Write(msg)
+		}
+		if err != nil && err != ErrClosed && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// serverSession tracks the server side of a single connection's setup phase.
+type serverSession struct {
+	srv      *Server
+	ws       *websocket.Conn
+	log      *slog.Logger
+	srp      *SRPServerContext
+	key      *KeyServerContext
+	features []string
+}
+
+func (sess *serverSession) send(msg *Message) error {
+	msg.Protocol = "setup"
+	msg.Version = ProtocolVersion()
+	msg.Features = sess.features
+	return writeMessage(sess.log, sess.ws, msg)
+}
+
+func (sess *serverSession) reject(code string) error {
+	return sess.send(&Message{Error: &MsgError{Code: code}})
+}
+
+// handshake runs setup messages until the client is authenticated, returning
+// the session key to encrypt the remainder of the connection with.
+func (sess *serverSession) handshake() (*big.Int, error) {
+	for {
+		msg, err := readMessage(sess.log, sess.ws)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Protocol != "setup" {
+			sess.reject("UNRECOGNISED_PROTOCOL")
+			return nil, fmt.Errorf("Unexpected protocol '%s'", msg.Protocol)
+		}
+		if sess.features == nil {
+			sess.features = ServerFeatures
+			if sess.srv.Features != nil {
+				sess.features = sess.srv.Features(msg.ClientName)
+			}
+		}
+		if v := ParseVersion(msg.Version); msg.Version != 0 && v.Major != protocolVersion[0] {
+			code := "VERSION_CLIENT_TOO_LOW"
+			if v.Major > protocolVersion[0] {
+				code = "VERSION_CLIENT_TOO_HIGH"
+			}
+			sess.reject(code)
+			return nil, fmt.Errorf("Unsupported client version %s", v)
+		}
+
+		var key *big.Int
+		switch {
+		case msg.SRP != nil && msg.Key == nil:
+			key, err = sess.dispatchSRP(msg, msg.SRP)
+		case msg.Key != nil && msg.SRP == nil:
+			key, err = sess.dispatchKey(msg.Key)
+		default:
+			err = sess.reject("INVALID_MESSAGE")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			return key, nil
+		}
+	}
+}
+
+func (sess *serverSession) dispatchSRP(msg *Message, srp *MsgSRP) (*big.Int, error) {
+	switch srp.Stage {
+	case "identifyToServer":
+		return nil, sess.identifyToServer(msg, srp)
+	case "proofToServer":
+		return sess.proofToServer(srp)
+	}
+	return nil, sess.reject("AUTH_INVALID_PARAM")
+}
+
+func (sess *serverSession) identifyToServer(msg *Message, srp *MsgSRP) error {
+	A, ok := new(big.Int).SetString(srp.A, 16)
+	if !ok || srp.I == "" {
+		return sess.reject("AUTH_INVALID_PARAM")
+	}
+
+	password, err := sess.srv.PairingCode(msg.ClientName)
+	if err != nil {
+		return err
+	}
+	ctx, err := NewSRPServerContext(srp.I, A, password)
+	if err != nil {
+		return sess.reject("AUTH_INVALID_PARAM")
+	}
+	sess.srp = ctx
+
+	return sess.send(&Message{
+		SRP: &MsgSRP{
+			Stage:         "identifyToClient",
+			B:             fmt.Sprintf("%X", ctx.Public),
+			S:             ctx.Salt,
+			SecurityLevel: 2,
+		},
+	})
+}
+
+func (sess *serverSession) proofToServer(srp *MsgSRP) (*big.Int, error) {
+	ctx := sess.srp
+	sess.srp = nil
+	if ctx == nil {
+		return nil, sess.reject("AUTH_RESTART")
+	}
+
+	defer ctx.wipe()
+
+	M, ok := new(big.Int).SetString(srp.M, 16)
+	if !ok {
+		return nil, sess.reject("AUTH_INVALID_PARAM")
+	}
+	if !equalInts(M, ctx.Evidence()) {
+		return nil, sess.reject("AUTH_FAILED")
+	}
+
+	key := ctx.SessionKey()
+	if err := sess.srv.Keys.SetSessionKey(ctx.Username, key); err != nil {
+		return nil, err
+	}
+
+	err := sess.send(&Message{
+		SRP: &MsgSRP{
+			Stage:         "proofToClient",
+			M2:            fmt.Sprintf("%X", ctx.ServerEvidence()),
+			SecurityLevel: 2,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (sess *serverSession) dispatchKey(key *MsgKey) (*big.Int, error) {
+	if key.Username != "" {
+		return nil, sess.challenge(key)
+	}
+	if key.CR != "" {
+		return sess.response(key)
+	}
+	return nil, sess.reject("AUTH_MISSING_PARAM")
+}
+
+func (sess *serverSession) challenge(key *MsgKey) error {
+	sessionKey, err := sess.srv.Keys.SessionKey(key.Username)
+	if err != nil {
+		return err
+	}
+	if sessionKey == nil {
+		return sess.reject("AUTH_RESTART")
+	}
+
+	sess.key = &KeyServerContext{Username: key.Username, SessionKey: sessionKey}
+	sc, err := sess.key.Challenge()
+	if err != nil {
+		return err
+	}
+
+	return sess.send(&Message{
+		Key: &MsgKey{
+			SC:            sc,
+			SecurityLevel: 2,
+		},
+	})
+}
+
+func (sess *serverSession) response(key *MsgKey) (*big.Int, error) {
+	ctx := sess.key
+	sess.key = nil
+	if ctx == nil {
+		return nil, sess.reject("AUTH_RESTART")
+	}
+
+	sr, err := ctx.Respond(key.CC, key.CR)
+	if err != nil {
+		return nil, sess.reject("AUTH_FAILED")
+	}
+
+	err = sess.send(&Message{
+		Key: &MsgKey{
+			SR:            sr,
+			SecurityLevel: 2,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ctx.SessionKey, nil
+}
+
+// serviceMethod maps a KeePassRPC method name such as "GetRoot" or
+// "system.listMethods" onto the methods of rpcService.
+func serviceMethod(method string) string {
+	parts := strings.Split(method, ".")
+	for i, p := range parts {
+		if p != "" {
+			r := []rune(p)
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+	return "KeePassRPC." + strings.Join(parts, "")
+}
+
+// serverMethods lists the methods a Server advertises via system.listMethods.
+var serverMethods = strings.Fields(`
+	AddEntry AddGroup AddLogin ChangeDatabase ChangeLocation FindEntries
+	FindLogins GeneratePassword GetAllDatabases GetAllLogins
+	GetApplicationMetadata GetChildEntries GetChildGroups GetCurrentKFConfig
+	GetDatabaseFileName GetDatabaseName GetParent GetPasswordProfiles GetRoot
+	LaunchGroupEditor LaunchLoginEditor RemoveEntry RemoveGroup UpdateEntry
+	UpdateLogin system.about system.listMethods system.version
+`)
+
+// rpcService adapts a Backend to package rpc. Each method receives the raw
+// positional parameters and decodes what it needs.
+type rpcService struct {
+	ctx context.Context
+	b   Backend
+}
+
+// void stands in for the result of methods which have none.
+type void struct{}
+
+// decodeParams unpacks positional JSON-RPC parameters into args, leaving
+// trailing args untouched if the caller sent fewer parameters.
+func decodeParams(p jsonrpc.Params, args ...interface{}) error {
+	for i, a := range args {
+		if i >= len(p) {
+			break
+		}
+		if err := json.Unmarshal(p[i], a); err != nil {
+			return fmt.Errorf("parameter %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *rpcService) GetRoot(p jsonrpc.Params, reply *Group) error {
+	g, err := s.b.GetRoot(s.ctx)
+	if err != nil {
+		return err
+	}
+	*reply = *g
+	return nil
+}
+
+func (s *rpcService) GetParent(p jsonrpc.Params, reply *Group) error {
+	var uuid string
+	if err := decodeParams(p, &uuid); err != nil {
+		return err
+	}
+	g, err := s.b.GetParent(s.ctx, uuid)
+	if err != nil {
+		return err
+	}
+	*reply = *g
+	return nil
+}
+
+func (s *rpcService) GetChildGroups(p jsonrpc.Params, reply *[]Group) (err error) {
+	var uuid string
+	if err := decodeParams(p, &uuid); err != nil {
+		return err
+	}
+	*reply, err = s.b.GetChildGroups(s.ctx, uuid)
+	return err
+}
+
+func (s *rpcService) GetChildEntries(p jsonrpc.Params, reply *[]Entry) (err error) {
+	var uuid string
+	if err := decodeParams(p, &uuid); err != nil {
+		return err
+	}
+	*reply, err = s.b.GetChildEntries(s.ctx, uuid)
+	return err
+}
+
+func (s *rpcService) GetAllLogins(p jsonrpc.Params, reply *[]Entry) (err error) {
+	*reply, err = s.b.GetAllLogins(s.ctx)
+	return err
+}
+
+func (s *rpcService) FindLogins(p jsonrpc.Params, reply *[]Entry) (err error) {
+	var q Search
+	err = decodeParams(p, &q.UnsanitizedURLs, &q.ActionURL, &q.HTTPRealm,
+		&q.LST, &q.RequireFullURLMatches, &q.UniqueID, &q.DBFileName,
+		&q.FreeTextSearch, &q.Username)
+	if err != nil {
+		return err
+	}
+	*reply, err = s.b.FindLogins(s.ctx, &q)
+	return err
+}
+
+func (s *rpcService) AddLogin(p jsonrpc.Params, reply *Entry) error {
+	var (
+		login                  Entry
+		parentUUID, dbFileName string
+	)
+	if err := decodeParams(p, &login, &parentUUID, &dbFileName); err != nil {
+		return err
+	}
+	e, err := s.b.AddLogin(s.ctx, &login, parentUUID, dbFileName)
+	if err != nil {
+		return err
+	}
+	*reply = *e
+	return nil
+}
+
+func (s *rpcService) UpdateLogin(p jsonrpc.Params, reply *Entry) error {
+	var (
+		login        Entry
+		oldLoginUUID string
+		urlMergeMode int
+		dbFileName   string
+	)
+	err := decodeParams(p, &login, &oldLoginUUID, &urlMergeMode, &dbFileName)
+	if err != nil {
+		return err
+	}
+	e, err := s.b.UpdateLogin(s.ctx, &login, oldLoginUUID, urlMergeMode, dbFileName)
+	if err != nil {
+		return err
+	}
+	*reply = *e
+	return nil
+}
+
+func (s *rpcService) FindEntries(p jsonrpc.Params, reply *[]Entry2) (err error) {
+	var q Search
+	err = decodeParams(p, &q.UnsanitizedURLs, &q.ActionURL, &q.HTTPRealm,
+		&q.LST, &q.RequireFullURLMatches, &q.UniqueID, &q.DBFileName,
+		&q.FreeTextSearch, &q.Username)
+	if err != nil {
+		return err
+	}
+	*reply, err = s.b.FindEntries(s.ctx, &q)
+	return err
+}
+
+func (s *rpcService) AddEntry(p jsonrpc.Params, reply *Entry2) error {
+	var (
+		entry                  Entry2
+		parentUUID, dbFileName string
+	)
+	if err := decodeParams(p, &entry, &parentUUID, &dbFileName); err != nil {
+		return err
+	}
+	e, err := s.b.AddEntry(s.ctx, &entry, parentUUID, dbFileName)
+	if err != nil {
+		return err
+	}
+	*reply = *e
+	return nil
+}
+
+func (s *rpcService) UpdateEntry(p jsonrpc.Params, reply *Entry2) error {
+	var (
+		entry        Entry2
+		oldUUID      string
+		urlMergeMode int
+		dbFileName   string
+	)
+	err := decodeParams(p, &entry, &oldUUID, &urlMergeMode, &dbFileName)
+	if err != nil {
+		return err
+	}
+	e, err := s.b.UpdateEntry(s.ctx, &entry, oldUUID, urlMergeMode, dbFileName)
+	if err != nil {
+		return err
+	}
+	*reply = *e
+	return nil
+}
+
+func (s *rpcService) RemoveEntry(p jsonrpc.Params, reply *bool) (err error) {
+	var uuid string
+	if err := decodeParams(p, &uuid); err != nil {
+		return err
+	}
+	*reply, err = s.b.RemoveEntry(s.ctx, uuid)
+	return err
+}
+
+func (s *rpcService) AddGroup(p jsonrpc.Params, reply *Group) error {
+	var name, parentUUID string
+	if err := decodeParams(p, &name, &parentUUID); err != nil {
+		return err
+	}
+	g, err := s.b.AddGroup(s.ctx, name, parentUUID)
+	if err != nil {
+		return err
+	}
+	*reply = *g
+	return nil
+}
+
+func (s *rpcService) RemoveGroup(p jsonrpc.Params, reply *bool) (err error) {
+	var uuid string
+	if err := decodeParams(p, &uuid); err != nil {
+		return err
+	}
+	*reply, err = s.b.RemoveGroup(s.ctx, uuid)
+	return err
+}
+
+func (s *rpcService) GetDatabaseName(p jsonrpc.Params, reply *string) (err error) {
+	*reply, err = s.b.GetDatabaseName(s.ctx)
+	return err
+}
+
+func (s *rpcService) GetDatabaseFileName(p jsonrpc.Params, reply *string) (err error) {
+	*reply, err = s.b.GetDatabaseFileName(s.ctx)
+	return err
+}
+
+func (s *rpcService) GetAllDatabases(p jsonrpc.Params, reply *[]Database) (err error) {
+	var fullDetails bool
+	if err := decodeParams(p, &fullDetails); err != nil {
+		return err
+	}
+	*reply, err = s.b.GetAllDatabases(s.ctx, fullDetails)
+	return err
+}
+
+func (s *rpcService) ChangeDatabase(p jsonrpc.Params, reply *void) error {
+	var (
+		filename     string
+		closeCurrent bool
+	)
+	if err := decodeParams(p, &filename, &closeCurrent); err != nil {
+		return err
+	}
+	return s.b.ChangeDatabase(s.ctx, filename, closeCurrent)
+}
+
+func (s *rpcService) ChangeLocation(p jsonrpc.Params, reply *void) error {
+	var locationID string
+	if err := decodeParams(p, &locationID); err != nil {
+		return err
+	}
+	return s.b.ChangeLocation(s.ctx, locationID)
+}
+
+func (s *rpcService) GetCurrentKFConfig(p jsonrpc.Params, reply *Configuration) error {
+	c, err := s.b.GetCurrentKFConfig(s.ctx)
+	if err != nil {
+		return err
+	}
+	*reply = *c
+	return nil
+}
+
+func (s *rpcService) GetApplicationMetadata(p jsonrpc.Params, reply *ApplicationMetadata) error {
+	m, err := s.b.GetApplicationMetadata(s.ctx)
+	if err != nil {
+		return err
+	}
+	*reply = *m
+	return nil
+}
+
+func (s *rpcService) GetPasswordProfiles(p jsonrpc.Params, reply *[]string) (err error) {
+	*reply, err = s.b.GetPasswordProfiles(s.ctx)
+	return err
+}
+
+func (s *rpcService) GeneratePassword(p jsonrpc.Params, reply *string) (err error) {
+	var profileName, url string
+	if err := decodeParams(p, &profileName, &url); err != nil {
+		return err
+	}
+	*reply, err = s.b.GeneratePassword(s.ctx, profileName, url)
+	return err
+}
+
+func (s *rpcService) LaunchGroupEditor(p jsonrpc.Params, reply *void) error {
+	var uuid, dbFileName string
+	if err := decodeParams(p, &uuid, &dbFileName); err != nil {
+		return err
+	}
+	return s.b.LaunchGroupEditor(s.ctx, uuid, dbFileName)
+}
+
+func (s *rpcService) LaunchLoginEditor(p jsonrpc.Params, reply *void) error {
+	var uuid, dbFileName string
+	if err := decodeParams(p, &uuid, &dbFileName); err != nil {
+		return err
+	}
+	return s.b.LaunchLoginEditor(s.ctx, uuid, dbFileName)
+}
+
+func (s *rpcService) SystemListMethods(p jsonrpc.Params, reply *[]string) error {
+	*reply = append([]string(nil), serverMethods...)
+	sort.Strings(*reply)
+	return nil
+}
+
+func (s *rpcService) SystemVersion(p jsonrpc.Params, reply *string) error {
+	*reply = ParseVersion(ProtocolVersion()).String()
+	return nil
+}
+
+func (s *rpcService) SystemAbout(p jsonrpc.Params, reply *string) error {
+	*reply = ClientDesc + "\n"
+	return nil
+}
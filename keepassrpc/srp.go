@@ -52,6 +52,10 @@ type SRPContext struct {
 // Multiplier calculates the SRP multiplier to be used, which is just a SHA1
 // hash of our chosen prime (N), plus our generator padded to the length of N.
 func (c *SRPContext) Multiplier() *big.Int {
+	return multiplier()
+}
+
+func multiplier() *big.Int {
 	h := sha1.New()
 	h.Write(Prime.Bytes())
 	padLen := len(Prime.Bytes()) - len(Generator.Bytes())
@@ -61,20 +65,52 @@ func (c *SRPContext) Multiplier() *big.Int {
 	return new(big.Int).SetBytes(h.Sum(nil))
 }
 
+// errIllegalParameter is returned for public values which would let the
+// other side (or someone in the middle) force the outcome of a negotiation.
+var errIllegalParameter = errors.New("illegal parameter")
+
+// checkPublic validates a public value received from the other side.
+// RFC5054 2.5.3 and 2.5.4 require us to abort if it is 0 mod N; we also
+// insist it is already reduced, as any honest peer's will be.
+func checkPublic(v *big.Int) error {
+	if v.Sign() <= 0 || v.Cmp(Prime) >= 0 {
+		return errIllegalParameter
+	}
+	return nil
+}
+
+// checkScrambler rejects a scrambling parameter of zero, which would make
+// the premaster secret independent of the password (RFC2945 3).
+func checkScrambler(u *big.Int) error {
+	if u.Sign() == 0 {
+		return errIllegalParameter
+	}
+	return nil
+}
+
 // SetServer validates and stores the server public value
 func (c *SRPContext) SetServer(B *big.Int) error {
-	// RFC5054 2.5.3 Server Key Exchange
-	// The client MUST abort the handshake with an "illegal_parameter"
-	// alert if B % N = 0.
-	t := new(big.Int)
-	if t.Mod(B, Prime); t.Cmp(big.NewInt(0)) == 0 {
-		return errors.New("illegal parameter")
+	if err := checkPublic(B); err != nil {
+		return err
 	}
 
 	c.Server = new(big.Int).Set(B)
+	c._u, c._S, c._M, c._M2 = nil, nil, nil, nil
+	if c.Public != nil {
+		if err := checkScrambler(c.scramblingParameter()); err != nil {
+			c.Server = nil
+			return err
+		}
+	}
 	return nil
 }
 
+// wipe zeroes the secret values of the negotiation, once it is over.
+func (c *SRPContext) wipe() {
+	wipe(c.Private, c._x, c._S)
+	c.Password = ""
+}
+
 func (c *SRPContext) privateKey() *big.Int {
 	if c._x == nil {
 		h := sha256.New()
@@ -174,38 +210,46 @@ func DispatchSRP(c *Client, srp *MsgSRP) error {
 }
 
 // EstablishSRPSession establishes a session with the KeePassRPC service using
-// a fresh SRP negotiation.
+// a fresh SRP negotiation. The private value is generated afresh for each
+// negotiation, and wiped once it is over.
 func EstablishSRPSession(c *Client) error {
+	a, err := GenKey(32)
+	if err != nil {
+		return err
+	}
+	defer wipe(a)
+
 	ctx := &SRPContext{
-		Private:  new(big.Int).Set(c.Value),
-		Public:   new(big.Int).Exp(Generator, c.Value, Prime),
+		Private:  new(big.Int).Set(a),
+		Public:   new(big.Int).Exp(Generator, a, Prime),
 		Salt:     "",
 		Server:   nil,
 		Password: "",
 	}
 
 	c.SRPCtx = ctx
-	defer func() { c.SRPCtx = nil }()
-
-	msg := &Message{
-		Protocol:   "setup",
-		ClientID:   ClientID,
-		ClientName: ClientName,
-		ClientDesc: ClientDesc,
-		Version:    ProtocolVersion(),
-		SRP: &MsgSRP{
-			Stage:         "identifyToServer",
-			I:             c.Username,
-			A:             fmt.Sprintf("%X", c.SRPCtx.Public),
-			SecurityLevel: 2,
-		},
+	defer func() {
+		ctx.wipe()
+		c.SRPCtx = nil
+	}()
+
+	msg := c.setupMessage()
+	msg.SRP = &MsgSRP{
+		Stage:         "identifyToServer",
+		I:             c.Username,
+		A:             fmt.Sprintf("%X", c.SRPCtx.Public),
+		SecurityLevel: 2,
 	}
 
-	if err := WriteMessage(c.WS, msg); err != nil {
+	if err := writeMessage(c.logger(), c.WS, msg); err != nil {
 		return err
 	}
 
 	if err := c.DispatchResponse(); err != nil {
+		var perr *ProtocolError
+		if errors.As(err, &perr) && perr.Code == "AUTH_FAILED" {
+			return fmt.Errorf("%w: %w", ErrEvidenceMismatch, err)
+		}
 		return err
 	}
 
@@ -215,6 +259,9 @@ func EstablishSRPSession(c *Client) error {
 
 // IdentifyToClient is the initial response from the KeePassRPC service
 func IdentifyToClient(c *Client, srp *MsgSRP) error {
+	if c.Password == nil {
+		return fmt.Errorf("%w: no way to ask for a pairing code", ErrAuthRequired)
+	}
 	password, err := c.Password()
 	if err != nil {
 		return err
@@ -254,7 +301,7 @@ func ProofToServer(c *Client) error {
 			SecurityLevel: 2,
 		},
 	}
-	if err := WriteMessage(c.WS, msg); err != nil {
+	if err := writeMessage(c.logger(), c.WS, msg); err != nil {
 		return err
 	}
 	return c.DispatchResponse()
@@ -272,9 +319,111 @@ func ProofToClient(c *Client, srp *MsgSRP) error {
 		return err
 	}
 
-	if M2.Cmp(ourM2) != 0 {
-		return fmt.Errorf("Server-provided evidence does not match")
+	if !equalInts(M2, ourM2) {
+		return fmt.Errorf("%w: server-provided evidence does not match", ErrEvidenceMismatch)
 	}
 
 	return nil
 }
+
+// SRPServerContext represents the server side of an SRP negotiation
+type SRPServerContext struct {
+	Username string   // I
+	Client   *big.Int // A
+	Private  *big.Int // b
+	Public   *big.Int // B
+	Verifier *big.Int // v
+	Salt     string   // s
+
+	// Memoized values
+	_S *big.Int
+	_M *big.Int
+}
+
+// scramblingParameter computes u, which both sides derive from A and B.
+func (c *SRPServerContext) scramblingParameter() *big.Int {
+	h := sha256.New()
+	fmt.Fprintf(h, "%X%X", c.Client, c.Public)
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// NewSRPServerContext validates a client's public value and prepares our
+// side of the negotiation, deriving the verifier from the pairing password.
+func NewSRPServerContext(username string, A *big.Int, password string) (*SRPServerContext, error) {
+	if err := checkPublic(A); err != nil {
+		return nil, err
+	}
+
+	salt, err := GenKey(32)
+	if err != nil {
+		return nil, err
+	}
+	b, err := GenKey(32)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &SRPServerContext{
+		Username: username,
+		Client:   new(big.Int).Set(A),
+		Private:  b,
+		Salt:     salt.Text(16),
+	}
+
+	// The verifier is derived exactly as a client would derive it.
+	v := &SRPContext{Salt: c.Salt, Password: password}
+	if c.Verifier, err = v.Verifier(); err != nil {
+		return nil, err
+	}
+
+	// B = kv + g^b
+	c.Public = new(big.Int).Mul(multiplier(), c.Verifier)
+	c.Public.Add(c.Public, new(big.Int).Exp(Generator, b, Prime))
+	c.Public.Mod(c.Public, Prime)
+	if err := checkScrambler(c.scramblingParameter()); err != nil {
+		c.wipe()
+		return nil, err
+	}
+	return c, nil
+}
+
+// wipe zeroes the secret values of the negotiation, once it is over.
+func (c *SRPServerContext) wipe() {
+	wipe(c.Private, c.Verifier, c._S)
+}
+
+func (c *SRPServerContext) premasterSecret() *big.Int {
+	if c._S == nil {
+		u := c.scramblingParameter()
+
+		// S = (Av^u)^b
+		c._S = new(big.Int).Exp(c.Verifier, u, Prime)
+		c._S.Mul(c.Client, c._S)
+		c._S.Exp(c._S, c.Private, Prime)
+	}
+	return c._S
+}
+
+// Evidence calculates the evidence we expect the client to submit
+func (c *SRPServerContext) Evidence() *big.Int {
+	if c._M == nil {
+		h := sha256.New()
+		fmt.Fprintf(h, "%X%X%X", c.Client, c.Public, c.premasterSecret())
+		c._M = new(big.Int).SetBytes(h.Sum(nil))
+	}
+	return c._M
+}
+
+// ServerEvidence calculates our evidence for submission to the client
+func (c *SRPServerContext) ServerEvidence() *big.Int {
+	h := sha256.New()
+	fmt.Fprintf(h, "%X%x%X", c.Client, c.Evidence(), c.premasterSecret())
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
+
+// SessionKey returns the session key shared with the client
+func (c *SRPServerContext) SessionKey() *big.Int {
+	h := sha256.New()
+	fmt.Fprintf(h, "%X", c.premasterSecret())
+	return new(big.Int).SetBytes(h.Sum(nil))
+}
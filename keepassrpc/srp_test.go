@@ -55,6 +55,23 @@ func TestSetServerPrime(t *testing.T) {
 	}
 }
 
+func TestSetServerRange(t *testing.T) {
+	c := &SRPContext{
+		Private: new(big.Int).Set(value),
+		Public:  new(big.Int).Exp(Generator, value, Prime),
+	}
+	for _, B := range []*big.Int{
+		big.NewInt(0),
+		big.NewInt(-2),
+		new(big.Int).Mul(Prime, big.NewInt(2)),
+		new(big.Int).Add(Prime, big.NewInt(2)),
+	} {
+		if c.SetServer(B) == nil {
+			t.Errorf("SetServer(%v) accepted an illegal value", B)
+		}
+	}
+}
+
 func TestPrivateKey(t *testing.T) {
 	if testClient.privateKey().Text(16) != snp {
 		t.Error("privateKey() didn't match input")
@@ -159,6 +176,71 @@ func TestServerEvidenceFailure(t *testing.T) {
 	}
 }
 
+func TestServerContext(t *testing.T) {
+	a, _ := GenKey(32)
+	c := &SRPContext{
+		Private:  a,
+		Public:   new(big.Int).Exp(Generator, a, Prime),
+		Password: password,
+	}
+
+	s, err := NewSRPServerContext(username, c.Public, password)
+	if err != nil {
+		t.Fatal("NewSRPServerContext() failed:", err)
+	}
+	c.Salt = s.Salt
+	if err := c.SetServer(s.Public); err != nil {
+		t.Fatal("SetServer() failed:", err)
+	}
+
+	M, err := c.Evidence()
+	if err != nil {
+		t.Fatal("Evidence() failed:", err)
+	}
+	if M.Cmp(s.Evidence()) != 0 {
+		t.Error("client and server evidence differ")
+	}
+	M2, err := c.ServerEvidence()
+	if err != nil {
+		t.Fatal("ServerEvidence() failed:", err)
+	}
+	if M2.Cmp(s.ServerEvidence()) != 0 {
+		t.Error("client and server server-evidence differ")
+	}
+	if c.SessionKey().Cmp(s.SessionKey()) != 0 {
+		t.Error("client and server session keys differ")
+	}
+}
+
+func TestServerContextPrime(t *testing.T) {
+	if _, err := NewSRPServerContext(username, Prime, password); err == nil {
+		t.Error("NewSRPServerContext() didn't catch prime match")
+	}
+}
+
+func TestServerContextRange(t *testing.T) {
+	for _, A := range []*big.Int{big.NewInt(0), new(big.Int).Add(Prime, big.NewInt(1))} {
+		if _, err := NewSRPServerContext(username, A, password); err == nil {
+			t.Errorf("NewSRPServerContext(%v) accepted an illegal value", A)
+		}
+	}
+}
+
+func TestServerContextWipe(t *testing.T) {
+	a, _ := GenKey(32)
+	s, err := NewSRPServerContext(username, new(big.Int).Exp(Generator, a, Prime), password)
+	if err != nil {
+		t.Fatal("NewSRPServerContext() failed:", err)
+	}
+	s.Evidence()
+	s.wipe()
+	for _, x := range []*big.Int{s.Private, s.Verifier, s._S} {
+		if x.Sign() != 0 {
+			t.Error("wipe() left a secret value in place")
+		}
+	}
+}
+
 func TestMain(m *testing.M) {
 	testClient = &SRPContext{
 		Private:  new(big.Int).Set(value),
@@ -2,6 +2,7 @@ package keepassrpc
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"io"
 	"math/big"
 )
@@ -9,6 +10,10 @@ import (
 // Our supported KeePassRPC protocol version
 var protocolVersion = []uint8{1, 7, 2}
 
+// minSecretBits is the fewest significant bits we accept in a private value
+// or session key; anything shorter was not generated with GenKey(32).
+const minSecretBits = 128
+
 // ProtocolVersion squashes a ProtocolVersion to an int
 func ProtocolVersion() uint32 {
 	value := uint32(protocolVersion[0])
@@ -26,3 +31,25 @@ func GenKey(len int) (*big.Int, error) {
 	}
 	return new(big.Int).SetBytes(bytes), nil
 }
+
+// equalInts reports whether a and b are equal, in time which depends only on
+// their lengths.
+func equalInts(a, b *big.Int) bool {
+	if a.Sign() != b.Sign() {
+		return false
+	}
+	n := (max(a.BitLen(), b.BitLen()) + 7) / 8
+	return subtle.ConstantTimeCompare(a.FillBytes(make([]byte, n)), b.FillBytes(make([]byte, n))) == 1
+}
+
+// wipe overwrites the values of secret integers with zero, including the
+// memory backing them, which big.Int would otherwise leave in place.
+func wipe(xs ...*big.Int) {
+	for _, x := range xs {
+		if x == nil {
+			continue
+		}
+		clear(x.Bits())
+		x.SetInt64(0)
+	}
+}
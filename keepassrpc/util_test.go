@@ -1,8 +1,12 @@
 package keepassrpc
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+)
 
 func TestVersion(t *testing.T) {
+	defer func(v []uint8) { protocolVersion = v }(protocolVersion)
 	protocolVersion = []uint8{1, 2, 3}
 	if ProtocolVersion() != 66051 {
 		t.Error("ProtocolVersion() returned invalid version")
@@ -22,3 +26,30 @@ func TestGenKey(t *testing.T) {
 		t.Error("GenKey returned the same key twice")
 	}
 }
+
+func TestEqualInts(t *testing.T) {
+	a, _ := GenKey(32)
+	if !equalInts(a, new(big.Int).Set(a)) {
+		t.Error("equalInts() rejected equal values")
+	}
+	if equalInts(a, new(big.Int).Add(a, big.NewInt(1))) {
+		t.Error("equalInts() accepted different values")
+	}
+	if equalInts(a, new(big.Int).Neg(a)) {
+		t.Error("equalInts() ignored the sign")
+	}
+}
+
+func TestWipe(t *testing.T) {
+	x, _ := GenKey(32)
+	words := x.Bits()
+	wipe(x, nil)
+	if x.Sign() != 0 {
+		t.Error("wipe() didn't zero the value")
+	}
+	for _, w := range words[:cap(words)] {
+		if w != 0 {
+			t.Fatal("wipe() left the value in memory")
+		}
+	}
+}
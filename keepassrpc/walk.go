@@ -0,0 +1,202 @@
+package keepassrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SkipGroup can be returned by a WalkFunc to skip the rest of a group. When
+// returned for a group, none of its children are visited; when returned for
+// an entry, the remaining entries in its group are skipped.
+var SkipGroup = errors.New("skip this group")
+
+// SkipAll can be returned by a WalkFunc to end the walk early, without
+// Walk returning an error.
+var SkipAll = errors.New("skip everything")
+
+// DefaultWalkConcurrency is how many groups Walk fetches at once, unless
+// Walker.Concurrency says otherwise.
+const DefaultWalkConcurrency = 4
+
+// Tree is the source of groups and entries for Walk. *Client implements it.
+type Tree interface {
+	GetChildGroupsContext(ctx context.Context, uuid string) ([]Group, error)
+	GetChildEntriesContext(ctx context.Context, uuid string) ([]Entry, error)
+}
+
+// Node is a group or entry visited by Walk.
+type Node struct {
+	// Group is the group being visited, or the parent of the entry being
+	// visited.
+	Group *Group
+
+	// Entry is the entry being visited, or nil for a group.
+	Entry *Entry
+
+	// Depth is zero for the root of the walk, one for its children, and
+	// so on.
+	Depth int
+
+	// Last reports whether this is the final child of its parent to be
+	// visited.
+	Last bool
+
+	// Groups and Entries are the children of a group being visited.
+	Groups  []Group
+	Entries []Entry
+}
+
+// WalkFunc is called by Walk for each group and entry. A non-nil error,
+// other than SkipGroup or SkipAll, stops the walk and is returned by Walk.
+type WalkFunc func(n *Node) error
+
+// Walker walks a Tree, fetching the children of several groups at once.
+type Walker struct {
+	Tree Tree
+
+	// Concurrency limits how many groups are fetched at once; zero
+	// means DefaultWalkConcurrency.
+	Concurrency int
+
+	// SortByTitle orders each group's children by title, rather than
+	// the order the server returns them in.
+	SortByTitle bool
+
+	// SkipEntries visits only groups, without fetching their entries.
+	SkipEntries bool
+}
+
+// Walk visits root and everything beneath it, calling fn for each group and
+// entry. A group is visited first, then each of its child groups in turn
+// (along with everything beneath them), and finally its entries. The order
+// is deterministic, even though the children of upcoming groups are fetched
+// concurrently while fn runs.
+func Walk(ctx context.Context, t Tree, root *Group, fn WalkFunc) error {
+	w := &Walker{Tree: t}
+	return w.Walk(ctx, root, fn)
+}
+
+// Walk is like the package-level Walk, using w's settings.
+func (w *Walker) Walk(ctx context.Context, root *Group, fn WalkFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // abandons any outstanding prefetches
+
+	n := w.Concurrency
+	if n <= 0 {
+		n = DefaultWalkConcurrency
+	}
+	ws := &walkState{w: w, ctx: ctx, sem: make(chan struct{}, n), fn: fn}
+	err := ws.visit(root, ws.fetch(root), 0, true)
+	if err == SkipGroup || err == SkipAll {
+		err = nil
+	}
+	return err
+}
+
+type walkState struct {
+	w   *Walker
+	ctx context.Context
+	sem chan struct{}
+	fn  WalkFunc
+}
+
+// children is the result of fetching a group's children.
+type children struct {
+	done    chan struct{}
+	groups  []Group
+	entries []Entry
+	err     error
+}
+
+// fetch starts fetching the children of g in the background, as soon as
+// the concurrency limit allows.
+func (ws *walkState) fetch(g *Group) *children {
+	c := &children{done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		select {
+		case ws.sem <- struct{}{}:
+			defer func() { <-ws.sem }()
+		case <-ws.ctx.Done():
+			c.err = ws.ctx.Err()
+			return
+		}
+
+		var wg sync.WaitGroup
+		var gerr, eerr error
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.groups, gerr = ws.w.Tree.GetChildGroupsContext(ws.ctx, g.UniqueID)
+		}()
+		if !ws.w.SkipEntries {
+			c.entries, eerr = ws.w.Tree.GetChildEntriesContext(ws.ctx, g.UniqueID)
+		}
+		wg.Wait()
+
+		if c.err = errors.Join(gerr, eerr); c.err != nil {
+			c.err = fmt.Errorf("fetching children of group '%s': %w", g.Title, c.err)
+			return
+		}
+		if ws.w.SortByTitle {
+			sort.SliceStable(c.groups, func(i, j int) bool { return c.groups[i].Title < c.groups[j].Title })
+			sort.SliceStable(c.entries, func(i, j int) bool { return c.entries[i].Title < c.entries[j].Title })
+		}
+	}()
+	return c
+}
+
+// visit walks g, whose children are being fetched by c. It returns SkipAll
+// if the walk should end.
+func (ws *walkState) visit(g *Group, c *children, depth int, last bool) error {
+	select {
+	case <-c.done:
+	case <-ws.ctx.Done():
+		return ws.ctx.Err()
+	}
+	if c.err != nil {
+		return c.err
+	}
+
+	err := ws.fn(&Node{
+		Group:   g,
+		Depth:   depth,
+		Last:    last,
+		Groups:  c.groups,
+		Entries: c.entries,
+	})
+	if err != nil {
+		return err
+	}
+
+	pending := make([]*children, len(c.groups))
+	for i := range c.groups {
+		pending[i] = ws.fetch(&c.groups[i])
+	}
+	for i := range c.groups {
+		isLast := i == len(c.groups)-1 && len(c.entries) == 0
+		err := ws.visit(&c.groups[i], pending[i], depth+1, isLast)
+		if err != nil && err != SkipGroup {
+			return err
+		}
+	}
+
+	for i := range c.entries {
+		err := ws.fn(&Node{
+			Group: g,
+			Entry: &c.entries[i],
+			Depth: depth + 1,
+			Last:  i == len(c.entries)-1,
+		})
+		if err == SkipGroup {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
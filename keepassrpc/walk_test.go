@@ -0,0 +1,123 @@
+package keepassrpc_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/logic/gkp/keepassrpc"
+)
+
+func TestWalk(t *testing.T) {
+	srv := newServer(t)
+
+	b := srv.AddGroup("", "b")
+	srv.AddGroup(b.UniqueID, "b2")
+	srv.AddEntry(b.UniqueID, keepassrpc.Entry{Title: "b-entry"})
+	a := srv.AddGroup("", "a")
+	srv.AddEntry(a.UniqueID, keepassrpc.Entry{Title: "a-entry"})
+	srv.AddEntry("", keepassrpc.Entry{Title: "root-entry"})
+
+	c := dial(t, srv, "victor")
+	defer c.Close()
+	root, err := c.GetRoot()
+	if err != nil {
+		t.Fatal("GetRoot:", err)
+	}
+
+	walk := func(w *keepassrpc.Walker, skip string) ([]string, error) {
+		var visited []string
+		err := w.Walk(context.Background(), root, func(n *keepassrpc.Node) error {
+			name := n.Group.Title + "/"
+			if n.Entry != nil {
+				name = n.Entry.Title
+			}
+			if n.Last {
+				name += "$"
+			}
+			visited = append(visited, strings.Repeat(" ", n.Depth)+name)
+			if name == skip {
+				return keepassrpc.SkipGroup
+			}
+			return nil
+		})
+		return visited, err
+	}
+
+	w := &keepassrpc.Walker{Tree: c, SortByTitle: true, Concurrency: 2}
+	got, err := walk(w, "")
+	if err != nil {
+		t.Fatal("Walk:", err)
+	}
+	want := []string{"Root/$", " a/", "  a-entry$", " b/", "  b2/", "  b-entry$", " root-entry$"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Walk visited:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	got, err = walk(w, "b/")
+	if err != nil {
+		t.Fatal("Walk:", err)
+	}
+	want = []string{"Root/$", " a/", "  a-entry$", " b/", " root-entry$"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Walk with SkipGroup visited:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	srv.FailMethod("GetChildEntries", errors.New("database locked"))
+	if _, err := walk(w, ""); err == nil || !strings.Contains(err.Error(), "database locked") {
+		t.Errorf("Walk with a failing server returned %v", err)
+	}
+
+	w.SkipEntries = true
+	got, err = walk(w, "")
+	if err != nil {
+		t.Fatal("Walk without entries:", err)
+	}
+	want = []string{"Root/$", " a/", " b/$", "  b2/$"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Walk without entries visited:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWalkConcurrency(t *testing.T) {
+	srv := newServer(t)
+	for i := 0; i < 10; i++ {
+		srv.AddGroup("", "group")
+	}
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	srv.OnCall(func(method string) error {
+		if method != "GetChildGroups" {
+			return nil
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	})
+
+	c := dial(t, srv, "walter")
+	defer c.Close()
+	root, err := c.GetRoot()
+	if err != nil {
+		t.Fatal("GetRoot:", err)
+	}
+	w := &keepassrpc.Walker{Tree: c, Concurrency: 3}
+	if err := w.Walk(context.Background(), root, func(*keepassrpc.Node) error { return nil }); err != nil {
+		t.Fatal("Walk:", err)
+	}
+	if peak < 2 || peak > 3 {
+		t.Errorf("%d groups fetched at once, want 2 or 3", peak)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"os"
 	"sort"
+
+	"github.com/logic/gkp/keepassrpc"
 )
 
 type command interface {
@@ -13,6 +15,12 @@ type command interface {
 	Help() string
 }
 
+// offline is implemented by commands which don't need client, or which
+// connect for themselves.
+type offline interface {
+	Offline()
+}
+
 var subcommands = map[string]command{}
 
 func globalHelp() {
@@ -37,21 +45,45 @@ func globalHelp() {
 			fmt.Printf("    %-25s %s\n", name, action.Help())
 		}
 	}
-	os.Exit(1)
+	exit(1)
 }
 
 // ParseCommand takes a command line and works out what to do next
 func ParseCommand(args []string) {
 	if len(args) < 2 {
+		// Running kp bare has always paired it.
+		connect()
+		client.Close()
 		globalHelp()
 	}
 	if fs, ok := subcommands[args[1]]; ok {
 		fs.FlagSet().Parse(args[2:])
+		if _, ok := fs.(offline); !ok {
+			connect()
+		}
 		if err := fs.Run(fs.FlagSet().Args()); err != nil {
 			fmt.Println(err)
-			os.Exit(1)
+			exit(1)
 		}
 	} else {
 		globalHelp()
 	}
 }
+
+// resolveArgs returns the group or entry named by a command's optional path
+// argument, or the root group if there isn't one. A returned group's Path is
+// always filled in.
+func resolveArgs(args []string) (*keepassrpc.Group, *keepassrpc.Entry, error) {
+	switch len(args) {
+	case 0:
+		g, err := client.GetRoot()
+		if err != nil {
+			return nil, nil, err
+		}
+		g.Path = keepassrpc.JoinPath(g.Title)
+		return g, nil, nil
+	case 1:
+		return keepassrpc.NewResolver(client).Resolve(context.Background(), args[0])
+	}
+	return nil, nil, fmt.Errorf("must specify at most one path")
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/logic/gkp/kdbx"
+	"github.com/logic/gkp/keepassrpc"
+	"golang.org/x/term"
+)
+
+type cmdExport struct {
+	fs        *flag.FlagSet
+	kdbxFile  string
+	keyFile   string
+	chacha20  bool
+	overwrite bool
+}
+
+func (cmd *cmdExport) FlagSet() *flag.FlagSet {
+	return cmd.fs
+}
+
+func (cmd *cmdExport) Help() string {
+	return "Export the open database to a standalone file"
+}
+
+// readPassword prompts for a password without echoing it, if we're on a
+// terminal; otherwise it reads a single line from stdin.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		text, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(text, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pw, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(pw), nil
+}
+
+// newMasterKey asks for the password for the exported database, and adds
+// the key file if one was given.
+func (cmd *cmdExport) newMasterKey() (*kdbx.Key, error) {
+	pw, err := readPassword("New master password: ")
+	if err != nil {
+		return nil, err
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		again, err := readPassword("Repeat master password: ")
+		if err != nil {
+			return nil, err
+		}
+		if pw != again {
+			return nil, errors.New("Passwords do not match")
+		}
+	}
+
+	key := &kdbx.Key{}
+	if pw != "" || cmd.keyFile == "" {
+		key.SetPassword(pw)
+	}
+	if cmd.keyFile != "" {
+		if err := key.ReadKeyFile(cmd.keyFile); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// cmdExportGroup copies g and everything beneath it.
+func cmdExportGroup(g *keepassrpc.Group) (*kdbx.Group, error) {
+	var path []*kdbx.Group // the groups from g down to the one being visited
+	w := &keepassrpc.Walker{Tree: client}
+	err := w.Walk(context.Background(), g, func(n *keepassrpc.Node) error {
+		if n.Entry != nil {
+			// Already copied with their group.
+			return nil
+		}
+		out := &kdbx.Group{Group: *n.Group}
+		for i := range n.Entries {
+			out.Entries = append(out.Entries, &kdbx.Entry{Entry: n.Entries[i]})
+		}
+		if n.Depth > 0 {
+			parent := path[n.Depth-1]
+			parent.Groups = append(parent.Groups, out)
+		}
+		path = append(path[:n.Depth], out)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return path[0], nil
+}
+
+func (cmd *cmdExport) Run(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if cmd.kdbxFile == "" {
+		return errors.New("Specify a file to export to with -kdbx")
+	}
+	if !cmd.overwrite {
+		if _, err := os.Stat(cmd.kdbxFile); err == nil {
+			return fmt.Errorf("%s already exists; use -f to overwrite it", cmd.kdbxFile)
+		}
+	}
+
+	name, err := client.GetDatabaseName()
+	if err != nil {
+		return err
+	}
+	root, err := client.GetRoot()
+	if err != nil {
+		return err
+	}
+	tree, err := cmdExportGroup(root)
+	if err != nil {
+		return err
+	}
+
+	key, err := cmd.newMasterKey()
+	if err != nil {
+		return err
+	}
+	opts := &kdbx.WriteOptions{}
+	if cmd.chacha20 {
+		opts.Cipher = kdbx.ChaCha20
+	}
+	db := &kdbx.Database{Name: name, Root: tree}
+	return db.WriteFile(cmd.kdbxFile, key, opts, cmd.overwrite)
+}
+
+func init() {
+	cmd := &cmdExport{
+		fs: flag.NewFlagSet("export", flag.ExitOnError),
+	}
+	cmd.fs.StringVar(&cmd.kdbxFile, "kdbx", "",
+		"Write a KDBX 4 database to this file")
+	cmd.fs.StringVar(&cmd.keyFile, "keyfile", "",
+		"Also protect the exported database with this key file")
+	cmd.fs.BoolVar(&cmd.chacha20, "chacha20", false,
+		"Encrypt with ChaCha20 rather than AES-256")
+	cmd.fs.BoolVar(&cmd.overwrite, "f", false,
+		"Overwrite the file if it already exists")
+	subcommands["export"] = cmd
+}
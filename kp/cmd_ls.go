@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"sort"
+	"strings"
 
 	"github.com/logic/gkp/keepassrpc"
 )
@@ -22,74 +23,59 @@ func (cmd *cmdList) Help() string {
 	return "List KeePass entries"
 }
 
-type byTitleGroup []keepassrpc.Group
-
-func (g byTitleGroup) Len() int           { return len(g) }
-func (g byTitleGroup) Swap(i, j int)      { g[i], g[j] = g[j], g[i] }
-func (g byTitleGroup) Less(i, j int) bool { return g[i].Title < g[j].Title }
-
-type byTitleEntry []keepassrpc.Entry
-
-func (e byTitleEntry) Len() int           { return len(e) }
-func (e byTitleEntry) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
-func (e byTitleEntry) Less(i, j int) bool { return e[i].Title < e[j].Title }
-
 func cmdListPrintSingleEntry(e *keepassrpc.Entry, long bool) {
 	if long {
 		fmt.Print(e.UniqueID, " ")
 	}
-	fmt.Println(e.Title)
+	fmt.Println(keepassrpc.EscapeTitle(e.Title))
 }
 
 func cmdListPrintSingleGroup(g *keepassrpc.Group, long bool) {
 	if long {
 		fmt.Print(g.UniqueID, " ")
 	}
-	fmt.Printf("%s/\n", g.Title)
+	fmt.Printf("%s/\n", keepassrpc.EscapeTitle(g.Title))
 }
 
-func cmdListPrintGroup(g *keepassrpc.Group, prefix string, recurse, long bool) error {
-	cg, err := client.GetChildGroups(g.UniqueID)
-	if err != nil {
-		return err
-	}
-	sort.Sort(byTitleGroup(cg))
-
-	ce, err := client.GetChildEntries(g.UniqueID)
-	if err != nil {
-		return err
-	}
-	sort.Sort(byTitleEntry(ce))
+func cmdListPrintGroup(g *keepassrpc.Group, recurse, long bool) error {
+	w := &keepassrpc.Walker{Tree: client, SortByTitle: true}
+	var prefixes []string
+	return w.Walk(context.Background(), g, func(n *keepassrpc.Node) error {
+		if n.Entry != nil {
+			// Already listed with their group.
+			return keepassrpc.SkipGroup
+		}
 
-	for _, c := range cg {
-		cmdListPrintSingleGroup(&c, long)
-	}
-	for _, c := range ce {
-		cmdListPrintSingleEntry(&c, long)
-	}
+		if n.Depth == 0 {
+			prefixes = []string{g.Path}
+		} else {
+			prefixes = append(prefixes[:n.Depth], keepassrpc.EscapeTitle(n.Group.Title))
+			fmt.Printf("\n%s:\n", strings.Join(prefixes, "/"))
+		}
+		for i := range n.Groups {
+			cmdListPrintSingleGroup(&n.Groups[i], long)
+		}
+		for i := range n.Entries {
+			cmdListPrintSingleEntry(&n.Entries[i], long)
+		}
 
-	if recurse {
-		for i := range cg {
-			c := cg[i]
-			newprefix := fmt.Sprintf("%s/%s", prefix, c.Title)
-			fmt.Printf("\n%s:\n", newprefix)
-			cmdListPrintGroup(&c, newprefix, recurse, long)
+		if !recurse {
+			return keepassrpc.SkipAll
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
-func (cmd *cmdList) Run(args []string) (err error) {
-	var g *keepassrpc.Group
-	if len(args) == 0 {
-		if g, err = client.GetRoot(); err != nil {
-			return err
-		}
-	} else {
-		return fmt.Errorf("specifying custom root unimplemented")
+func (cmd *cmdList) Run(args []string) error {
+	g, e, err := resolveArgs(args)
+	if err != nil {
+		return err
 	}
-
-	return cmdListPrintGroup(g, g.Title, cmd.recurse, cmd.long)
+	if e != nil {
+		cmdListPrintSingleEntry(e, cmd.long)
+		return nil
+	}
+	return cmdListPrintGroup(g, cmd.recurse, cmd.long)
 }
 
 func init() {
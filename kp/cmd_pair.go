@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/logic/gkp/keepassrpc"
+	"github.com/logic/gkp/keepassrpc/cli"
+)
+
+type cmdPair struct {
+	fs *flag.FlagSet
+}
+
+func (cmd *cmdPair) FlagSet() *flag.FlagSet {
+	return cmd.fs
+}
+
+func (cmd *cmdPair) Offline() {}
+
+func (cmd *cmdPair) Help() string {
+	return "Pair afresh with KeePass (or \"status\", \"export\", \"import [file]\")"
+}
+
+// storeLabel names the secret store in use.
+func storeLabel() string {
+	switch {
+	case *storeName != "":
+		return *storeName
+	case config.SecretStore != "":
+		return config.SecretStore
+	}
+	return cli.StoreKeyring
+}
+
+// status describes our pairing, and checks whether KeePass still accepts it.
+func (cmd *cmdPair) status() error {
+	fingerprint, err := config.Fingerprint()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Profile:    ", config.ProfileName)
+	if config.Username == "" || fingerprint == "" {
+		fmt.Println("Not paired")
+		return nil
+	}
+	fmt.Println("Username:   ", config.Username)
+	fmt.Println("Key:        ", fingerprint)
+	fmt.Println("Stored in:  ", storeLabel())
+
+	// Without a prompt, only the key is tried; KeePass isn't asked to
+	// start pairing, so it shows no pairing code.
+	c, err := cli.DialWithOptions(context.Background(), config, &dialOptions, nil)
+	switch {
+	case errors.Is(err, keepassrpc.ErrKeyRejected):
+		fmt.Println("Accepted:    no, not paired; run kp pair to pair again")
+		return nil
+	case err != nil:
+		return err
+	}
+	c.Close()
+	fmt.Println("Accepted:    yes")
+	return nil
+}
+
+func (cmd *cmdPair) export() error {
+	pass, err := cli.PairingPassphrase()()
+	if err != nil {
+		return err
+	}
+	defer pass.Destroy()
+	blob, err := config.ExportPairing(pass)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(blob)
+	return err
+}
+
+func (cmd *cmdPair) importFrom(args []string) error {
+	var blob []byte
+	var err error
+	if len(args) == 0 || args[0] == "-" {
+		blob, err = io.ReadAll(os.Stdin)
+	} else {
+		blob, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	pass, err := cli.PairingPassphrase()()
+	if err != nil {
+		return err
+	}
+	defer pass.Destroy()
+	if err := config.ImportPairing(blob, pass); err != nil {
+		return err
+	}
+	fmt.Println("Imported pairing as", config.Username)
+	return nil
+}
+
+func (cmd *cmdPair) Run(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		return cmd.status()
+	case len(args) == 1 && args[0] == "export":
+		return cmd.export()
+	case len(args) > 0 && len(args) <= 2 && args[0] == "import":
+		return cmd.importFrom(args[1:])
+	case len(args) > 0:
+		return fmt.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	var err error
+	client, err = cli.Pair(context.Background(), config, &dialOptions, prompt())
+	checkDial(err)
+	client.Close()
+	fmt.Println("Paired as", config.Username)
+	return nil
+}
+
+type cmdUnpair struct {
+	fs *flag.FlagSet
+}
+
+func (cmd *cmdUnpair) FlagSet() *flag.FlagSet {
+	return cmd.fs
+}
+
+func (cmd *cmdUnpair) Offline() {}
+
+func (cmd *cmdUnpair) Help() string {
+	return "Forget the stored username and session key"
+}
+
+func (cmd *cmdUnpair) Run(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if config.Username == "" {
+		fmt.Println("Not paired")
+		return nil
+	}
+	username := config.Username
+	if err := config.Unpair(); err != nil {
+		return err
+	}
+	fmt.Printf("Forgot %s; remove it from KeePass's authorised clients too\n", username)
+	return nil
+}
+
+func init() {
+	subcommands["pair"] = &cmdPair{
+		fs: flag.NewFlagSet("pair", flag.ExitOnError),
+	}
+	subcommands["unpair"] = &cmdUnpair{
+		fs: flag.NewFlagSet("unpair", flag.ExitOnError),
+	}
+}
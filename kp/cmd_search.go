@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/logic/gkp/keepassrpc"
 )
 
 type cmdSearch struct {
-	fs       *flag.FlagSet
-	ShowAll  bool
-	UniqueID string
-	URLs     bool
-	Results  int
+	fs         *flag.FlagSet
+	ShowAll    bool
+	UniqueID   string
+	URLs       bool
+	Results    int
+	Groups     bool
+	Match      string
+	IgnoreCase bool
 }
 
 func (cmd *cmdSearch) FlagSet() *flag.FlagSet {
@@ -24,10 +30,41 @@ func (cmd *cmdSearch) Help() string {
 	return "Search KeePass for free-text search terms, unique IDs, and URLs"
 }
 
+func (cmd *cmdSearch) searchGroups(args []string) error {
+	s := client.NewGroupSearch()
+	s.UniqueID = cmd.UniqueID
+	s.Pattern = strings.Join(args, " ")
+	s.IgnoreCase = cmd.IgnoreCase
+	match, err := keepassrpc.ParseGroupMatch(cmd.Match)
+	if err != nil {
+		return err
+	}
+	s.Match = match
+
+	groups, err := s.Execute()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Println("No groups found.")
+		return nil
+	}
+	if cmd.Results > 0 && len(groups) > cmd.Results {
+		groups = groups[:cmd.Results]
+	}
+	for _, g := range groups {
+		fmt.Printf("%s (%s)\n", g.Path, g.UniqueID)
+	}
+	return nil
+}
+
 func (cmd *cmdSearch) Run(args []string) error {
 	if cmd.UniqueID != "" && len(args) != 0 {
 		return fmt.Errorf("must specify a single unique ID")
 	}
+	if cmd.Groups {
+		return cmd.searchGroups(args)
+	}
 
 	s := client.NewSearch()
 	if cmd.UniqueID != "" {
@@ -46,14 +83,20 @@ func (cmd *cmdSearch) Run(args []string) error {
 		return nil
 	}
 
-	countdown := cmd.Results
-	if countdown == 0 {
-		countdown = len(entries)
+	if cmd.Results > 0 && len(entries) > cmd.Results {
+		entries = entries[:cmd.Results]
 	}
+	uuids := make([]string, len(entries))
+	for i := range entries {
+		uuids[i] = entries[i].UniqueID
+	}
+	// Entries outside the active database have no path we can find.
+	paths, err := keepassrpc.NewResolver(client).PathsOf(context.Background(), uuids...)
+	if err != nil && !errors.Is(err, keepassrpc.ErrPathNotFound) {
+		return err
+	}
+
 	for _, e := range entries {
-		if countdown < 1 {
-			break
-		}
 		fmt.Println()
 		fmt.Print(e.Title)
 		switch e.MatchAccuracy {
@@ -73,6 +116,9 @@ func (cmd *cmdSearch) Run(args []string) error {
 			fmt.Printf(" [unknown match result: %d]\n", e.MatchAccuracy)
 		}
 		fmt.Println("UUID:", e.UniqueID)
+		if p, ok := paths[e.UniqueID]; ok {
+			fmt.Println("Path:", p)
+		}
 		fmt.Println("URLs:")
 		for _, u := range e.URLs {
 			fmt.Println("   ", u)
@@ -107,7 +153,7 @@ func (cmd *cmdSearch) Run(args []string) error {
 			} else {
 				fmt.Print("\t[no name]")
 			}
-			if f.Value != "" {
+			if f.Value != "" || f.Secret.Len() > 0 {
 				fmt.Print(": ")
 				if f.Type == keepassrpc.FFTcheckbox {
 					switch f.Value {
@@ -118,16 +164,17 @@ func (cmd *cmdSearch) Run(args []string) error {
 					default:
 						fmt.Print(f.Value)
 					}
-				} else if f.Type != keepassrpc.FFTpassword || cmd.ShowAll {
-					fmt.Print(f.Value)
-				} else {
+				} else if f.Type == keepassrpc.FFTpassword && !cmd.ShowAll {
 					fmt.Print("********")
+				} else if f.Secret != nil {
+					// straight from the secret, without copying it
+					os.Stdout.Write(f.Secret.Bytes())
+				} else {
+					fmt.Print(f.Value)
 				}
 			}
 			fmt.Println()
 		}
-
-		countdown--
 	}
 
 	return nil
@@ -145,5 +192,11 @@ func init() {
 		"Treat arguments as URLs instead of free-text search terms")
 	cmd.fs.IntVar(&cmd.Results, "n", 0,
 		"Number of results to return (0 = everything)")
+	cmd.fs.BoolVar(&cmd.Groups, "groups", false,
+		"Search for groups by title instead of entries")
+	cmd.fs.StringVar(&cmd.Match, "match", "glob",
+		"How -groups matches titles: exact, prefix, glob or regexp")
+	cmd.fs.BoolVar(&cmd.IgnoreCase, "i", false,
+		"Match group titles case-insensitively")
 	subcommands["search"] = cmd
 }
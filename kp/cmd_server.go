@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/logic/gkp/keepassrpc"
 )
 
 type cmdServer struct {
@@ -13,7 +18,47 @@ func (cmd *cmdServer) FlagSet() *flag.FlagSet {
 	return cmd.fs
 }
 
+// methods reports how the methods the server advertises compare with the
+// ones keepassrpc has bindings for, failing if they differ.
+func (cmd *cmdServer) methods() error {
+	r, err := client.CheckMethods()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range r.Missing {
+		fmt.Println("missing:   ", m)
+	}
+	var misspelled []string
+	for m := range r.Misspelled {
+		misspelled = append(misspelled, m)
+	}
+	sort.Strings(misspelled)
+	for _, m := range misspelled {
+		fmt.Printf("misspelled: %s (server has %s)\n", m, r.Misspelled[m])
+	}
+	for _, m := range r.Unwrapped {
+		fmt.Println("unwrapped: ", m)
+	}
+	for _, m := range r.Skipped {
+		fmt.Println("skipped:   ", m)
+	}
+
+	if !r.OK() {
+		return errors.New("Server methods don't match the keepassrpc bindings")
+	}
+	fmt.Println("All", len(keepassrpc.BoundMethods()), "bound methods are present")
+	return nil
+}
+
 func (cmd *cmdServer) Run(args []string) error {
+	if len(args) == 1 && args[0] == "methods" {
+		return cmd.methods()
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("Unexpected arguments: %s", strings.Join(args, " "))
+	}
+
 	info, err := client.GetApplicationMetadata()
 	if err != nil {
 		return err
@@ -25,6 +70,10 @@ func (cmd *cmdServer) Run(args []string) error {
 		fmt.Println(".NET", info.NETversion)
 	}
 	fmt.Println(".NET CLR", info.NETCLR)
+	fmt.Println("KeePassRPC protocol", client.ServerVersion())
+	if features := client.Features(); len(features) > 0 {
+		fmt.Println("Features:", strings.Join(features, " "))
+	}
 
 	about, err := client.SystemAbout()
 	if err != nil {
@@ -36,7 +85,7 @@ func (cmd *cmdServer) Run(args []string) error {
 }
 
 func (cmd *cmdServer) Help() string {
-	return "Information about the running KeePass instance"
+	return "Information about the running KeePass instance (or \"methods\")"
 }
 
 func init() {
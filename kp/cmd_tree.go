@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 
@@ -36,48 +37,39 @@ func cmdTreePrintSingle(name string, prefixes []bool, last bool) {
 	fmt.Println(thisPrefix, name)
 }
 
-func cmdTreePrintGroup(g *keepassrpc.Group, prefixes []bool) error {
-	cg, err := client.GetChildGroups(g.UniqueID)
-	if err != nil {
-		return err
-	}
-	ce, err := client.GetChildEntries(g.UniqueID)
-	if err != nil {
-		return err
-	}
-
-	for i := range cg {
-		c := cg[i]
-		last := (i >= len(cg)-1) && (len(ce) == 0)
-		cmdTreePrintSingle(c.Title, prefixes, last)
+func cmdTreePrintTree(root *keepassrpc.Group) error {
+	// lasts[d] records whether the ancestor at depth d+1 was the last of
+	// its siblings, which decides how its column is drawn.
+	var lasts []bool
+	w := &keepassrpc.Walker{Tree: client}
+	return w.Walk(context.Background(), root, func(n *keepassrpc.Node) error {
+		if n.Depth == 0 {
+			fmt.Println(root.Path)
+			return nil
+		}
 
-		newprefixes := append(prefixes, last)
-		cmdTreePrintGroup(&c, newprefixes)
-	}
-	for i := range ce {
-		c := ce[i]
-		cmdTreePrintSingle(c.Title, prefixes, (i >= len(ce)-1))
-	}
-	return nil
-}
+		title := n.Group.Title
+		if n.Entry != nil {
+			title = n.Entry.Title
+		}
+		cmdTreePrintSingle(title, lasts[:n.Depth-1], n.Last)
 
-func cmdTreePrintTree(root *keepassrpc.Group) error {
-	fmt.Println(root.Title)
-	return cmdTreePrintGroup(root, nil)
+		if n.Entry == nil {
+			lasts = append(lasts[:n.Depth-1], n.Last)
+		}
+		return nil
+	})
 }
 
-func (cmd *cmdTree) Run(args []string) (err error) {
-	var g *keepassrpc.Group
-	if len(args) == 0 {
-		if g, err = client.GetRoot(); err != nil {
-			return err
-		}
-	} else {
-		return fmt.Errorf("specifying custom root unimplemented")
+func (cmd *cmdTree) Run(args []string) error {
+	g, e, err := resolveArgs(args)
+	if err != nil {
+		return err
 	}
-
-	fmt.Println(g.Title)
-	return cmdTreePrintGroup(g, nil)
+	if e != nil {
+		return fmt.Errorf("'%s' is an entry, not a group", args[0])
+	}
+	return cmdTreePrintTree(g)
 }
 
 func init() {
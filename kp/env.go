@@ -1,6 +1,8 @@
 package main
 
-import "os"
+import (
+	"os"
+)
 
 type envvar interface {
 	Trigger(string) error
@@ -14,7 +16,9 @@ var envvars = map[string]envvar{}
 func ParseEnvironment() {
 	for name, action := range envvars {
 		if value, ok := os.LookupEnv(name); ok {
-			action.Trigger(value)
+			if err := action.Trigger(value); err != nil {
+				fatalf("%s: %v", name, err)
+			}
 		}
 	}
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+type envCACert struct{}
+
+func (env *envCACert) Trigger(value string) error {
+	pem, err := ioutil.ReadFile(value)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", value)
+	}
+	dialOptions.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return nil
+}
+
+func (env *envCACert) Help() string {
+	return "PEM file of CA certificates trusted for wss:// URLs"
+}
+
+func init() {
+	envvars["KEEPASSRPC_CACERT"] = &envCACert{}
+}
@@ -5,7 +5,7 @@ import "github.com/logic/gkp/keepassrpc"
 type envDebugClient struct{}
 
 func (env *envDebugClient) Trigger(value string) error {
-	keepassrpc.DebugClient = true
+	logLevel.Set(min(logLevel.Level(), keepassrpc.LevelTransport))
 	return nil
 }
 
@@ -5,12 +5,12 @@ import "github.com/logic/gkp/keepassrpc"
 type envDebugJSONRPC struct{}
 
 func (env *envDebugJSONRPC) Trigger(value string) error {
-	keepassrpc.DebugJSONRPC = true
+	logLevel.Set(min(logLevel.Level(), keepassrpc.LevelRPC))
 	return nil
 }
 
 func (env *envDebugJSONRPC) Help() string {
-	return "Debug post-encryption JSON-RPC protocol"
+	return "Debug post-encryption JSON-RPC protocol (passwords are redacted)"
 }
 
 func init() {
@@ -0,0 +1,21 @@
+package main
+
+import "net/http"
+
+type envOrigin struct{}
+
+func (env *envOrigin) Trigger(value string) error {
+	if dialOptions.Header == nil {
+		dialOptions.Header = http.Header{}
+	}
+	dialOptions.Header.Set("Origin", value)
+	return nil
+}
+
+func (env *envOrigin) Help() string {
+	return "Origin header to present to KeePassRPC"
+}
+
+func init() {
+	envvars["KEEPASSRPC_ORIGIN"] = &envOrigin{}
+}
@@ -0,0 +1,16 @@
+package main
+
+type envURL struct{}
+
+func (env *envURL) Trigger(value string) error {
+	dialOptions.URL = value
+	return nil
+}
+
+func (env *envURL) Help() string {
+	return "KeePassRPC websocket URL (default ws://127.0.0.1:12546/)"
+}
+
+func init() {
+	envvars["KEEPASSRPC_URL"] = &envURL{}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
 	"os"
 
 	"github.com/logic/gkp/keepassrpc"
@@ -11,20 +15,112 @@ import (
 var config *cli.Configuration
 var client *keepassrpc.Client
 
+// logLevel is lowered by the KEEPASSRPC_DEBUG_* environment variables.
+var logLevel slog.LevelVar
+
+// dialOptions is filled in from the profile and the environment before we
+// connect.
+var dialOptions = keepassrpc.Options{
+	Logger: slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level:       &logLevel,
+		ReplaceAttr: levelNames,
+	})),
+}
+
+// levelNames names keepassrpc's own log levels.
+func levelNames(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.LevelKey || len(groups) > 0 {
+		return a
+	}
+	switch a.Value.Any().(slog.Level) {
+	case keepassrpc.LevelHandshake:
+		a.Value = slog.StringValue("HANDSHAKE")
+	case keepassrpc.LevelTransport:
+		a.Value = slog.StringValue("TRANSPORT")
+	case keepassrpc.LevelRPC:
+		a.Value = slog.StringValue("RPC")
+	}
+	return a
+}
+
+var storeName = flag.String("store", "",
+	"where to keep the session key (keyring, file, env or memory), overriding settings.json")
+
+var profileName = flag.String("profile", os.Getenv(cli.ProfileEnv),
+	"profile from settings.json to use (default $"+cli.ProfileEnv+", or the default profile)")
+
+// prompt returns the best way to ask for a pairing code.
+func prompt() keepassrpc.Passworder {
+	if p := cli.AutoPrompt(); p != nil {
+		return p
+	}
+	return cli.Prompt
+}
+
+// exit releases the session key, which deferred calls would never get to do,
+// and exits with code.
+func exit(code int) {
+	if client != nil {
+		client.Close()
+	}
+	if config != nil {
+		config.Destroy()
+	}
+	os.Exit(code)
+}
+
+// fatal is like log.Fatal, but exits through exit.
+func fatal(v ...interface{}) {
+	log.Print(v...)
+	exit(1)
+}
+
+// fatalf is like log.Fatalf, but exits through exit.
+func fatalf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+	exit(1)
+}
+
+// checkDial exits, explaining why, if connecting failed.
+func checkDial(err error) {
+	switch {
+	case errors.Is(err, keepassrpc.ErrEvidenceMismatch):
+		fatal("Pairing failed; check the code KeePass showed you and try again")
+	case errors.Is(err, keepassrpc.ErrVersionMismatch):
+		fatal("KeePassRPC doesn't support this version of kp: ", err)
+	case err != nil:
+		fatal("initSRP: ", err)
+	}
+}
+
+// connect dials KeePass, pairing if need be, for the commands which need
+// client.
+func connect() {
+	var err error
+	client, err = cli.DialWithOptions(context.Background(), config, &dialOptions, prompt())
+	checkDial(err)
+}
+
 func main() {
-	ParseEnvironment()
+	flag.Parse()
 
 	var err error
-	config, err = cli.LoadConfig()
+	config, err = cli.LoadProfile(*profileName)
 	if err != nil {
-		log.Fatal("loadConfig: ", err)
+		fatal("loadConfig: ", err)
 	}
 
-	client, err = cli.Dial(config, cli.Prompt)
-	if err != nil {
-		log.Fatal("initSRP: ", err)
+	// The environment overrides the profile.
+	config.Apply(&dialOptions)
+	ParseEnvironment()
+	if *storeName != "" {
+		store, err := cli.OpenStore(*storeName, config)
+		if err != nil {
+			fatal(err)
+		}
+		config.SetStore(store)
 	}
-	defer client.Close()
 
-	ParseCommand(os.Args)
+	ParseCommand(append(os.Args[:1], flag.Args()...))
+	exit(0)
 }